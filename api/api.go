@@ -0,0 +1,9 @@
+// Package humayapi holds the OpenAPI document of the server.
+package humayapi
+
+import (
+	_ "embed"
+)
+
+//go:embed openapi.yaml
+var OpenAPI []byte
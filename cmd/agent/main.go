@@ -2,94 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
-	"strconv"
-	"strings"
 
 	agentApp "github.com/zvfkjytytw/humay/internal/agent/app"
-)
-
-const (
-	envAddress        = "ADDRESS"
-	envReportInterval = "REPORT_INTERVAL"
-	envPollInterval   = "POLL_INTERVAL"
-	envRateLimit      = "RATE_LIMIT"
-	envKey            = "KEY"
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
 )
 
 func main() {
-	var (
-		// Agent config file
-		configFile string
-		// Server address and port
-		address string
-		// Interval for polling metrics
-		pollInterval int
-		// Interval for send metrics to server
-		reportInterval int
-		// Limit for open connections to server
-		rateLimit int
-		// hash key for signature
-		hashKey string
-	)
-	flag.StringVar(&configFile, "c", "./build/agent.yaml", "Agent config file")
-	flag.StringVar(&address, "a", "localhost:8080", "Server address")
-	flag.IntVar(&pollInterval, "p", 2, "Interval for polling metrics")
-	flag.IntVar(&reportInterval, "r", 10, "Interval for reporting metrics")
-	flag.IntVar(&rateLimit, "l", 5, "Rate limit")
-	flag.StringVar(&hashKey, "k", "", "Key for generate hash")
-	flag.Parse()
-
-	value, ok := os.LookupEnv(envAddress)
-	if ok {
-		address = value
-	}
-	host, port := splitAddress(address)
-
-	value, ok = os.LookupEnv(envPollInterval)
-	if ok {
-		interval, err := strconv.Atoi(value)
-		if err == nil {
-			pollInterval = interval
-		}
-	}
-
-	value, ok = os.LookupEnv(envReportInterval)
-	if ok {
-		interval, err := strconv.Atoi(value)
-		if err == nil {
-			reportInterval = interval
-		}
-	}
-
-	value, ok = os.LookupEnv(envRateLimit)
-	if ok {
-		limit, err := strconv.Atoi(value)
-		if err == nil {
-			rateLimit = limit
-		}
-	}
-
-	value, ok = os.LookupEnv(envKey)
-	if ok {
-		hashKey = value
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, humayConfig.ErrPrintConfig) || errors.Is(err, flag.ErrHelp) {
+		return
 	}
-
-	config := &agentApp.AgentConfig{
-		ServerAddress:  host,
-		ServerPort:     port,
-		ServerType:     "http",
-		PollInterval:   int32(pollInterval),
-		ReportInterval: int32(reportInterval),
-		RateLimit:      int32(rateLimit),
-		HashKey:        hashKey,
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
 	app, err := agentApp.NewApp(config)
 	if err != nil {
 		panic(err)
 	}
+	// SIGHUP loads the config again with the same arguments.
+	app.SetConfigLoader(func() (*agentApp.AgentConfig, error) {
+		return loadConfig(os.Args[1:])
+	})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -97,20 +36,35 @@ func main() {
 	app.Run(ctx)
 }
 
-func splitAddress(address string) (host string, port int32) {
-	values := strings.Split(address, ":")
-	if len(values) == 1 {
-		host = values[0]
-		port = 8080
-		return
-	}
+// loadConfig merges the defaults, the config file, the environment and the arguments.
+func loadConfig(args []string) (*agentApp.AgentConfig, error) {
+	config := agentApp.DefaultConfig()
+
+	loader := humayConfig.NewLoader("agent", config)
+	loader.Add(
+		humayConfig.Var{
+			Env: "ADDRESS", Flag: "a", Usage: "Server address host:port", Default: "localhost:8080",
+			Set: humayConfig.HostPort(&config.ServerAddress, &config.ServerPort),
+		},
+		humayConfig.Var{Path: "poll_interval", Env: "POLL_INTERVAL", Flag: "p", Usage: "Interval for polling metrics"},
+		humayConfig.Var{Path: "report_interval", Env: "REPORT_INTERVAL", Flag: "r", Usage: "Interval for reporting metrics"},
+		humayConfig.Var{Path: "report_limit", Env: "RATE_LIMIT", Flag: "l", Usage: "Batches sent to the server at once"},
+		humayConfig.Var{Path: "hash_key", Env: "KEY", Flag: "k", Usage: "Key for generate hash"},
+		humayConfig.Var{Path: "token", Env: "TOKEN", Flag: "t", Usage: "API token with write scope"},
+		humayConfig.Var{Path: "tls_ca", Flag: "tls-ca", Usage: "CA file to verify the server, enables HTTPS"},
+		humayConfig.Var{Path: "tls_cert", Flag: "tls-cert", Usage: "Agent certificate file for mutual TLS"},
+		humayConfig.Var{Path: "tls_key", Flag: "tls-key", Usage: "Agent key file"},
+		humayConfig.Var{Path: "status.address", Env: "STATUS_ADDRESS", Flag: "status", Usage: "Address of the local /healthz and /status endpoint"},
+		humayConfig.Var{Path: "tracing.exporter", Flag: "trace", Usage: "Trace exporter: otlp, stdout or file"},
+		humayConfig.Var{Path: "tracing.endpoint", Flag: "trace-endpoint", Usage: "OTLP/HTTP collector host:port"},
+		humayConfig.Var{Path: "tracing.file", Flag: "trace-file", Usage: "File of the file trace exporter"},
+		humayConfig.Var{Path: "logging.level", Env: "LOG_LEVEL", Flag: "log-level", Usage: "Log level: debug, info, warn or error"},
+		humayConfig.Var{Path: "logging.format", Env: "LOG_FORMAT", Flag: "log-format", Usage: "Log format: json or console"},
+	)
 
-	host = values[0]
-	p, err := strconv.Atoi(values[1])
-	if err != nil {
-		port = 8080
+	if err := loader.Load(args); err != nil {
+		return nil, err
 	}
-	port = int32(p)
 
-	return
+	return config, nil
 }
@@ -2,89 +2,33 @@ package main
 
 import (
 	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"os"
-	"strconv"
-	"strings"
 
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
 	serverApp "github.com/zvfkjytytw/humay/internal/server/app"
-	humayHTTPServer "github.com/zvfkjytytw/humay/internal/server/http"
-)
-
-const (
-	addressEnv         = "ADDRESS"
-	restoreEnv         = "RESTORE"
-	storageIntervalEnv = "STORE_INTERVAL"
-	fileStoragePathEnv = "FILE_STORAGE_PATH"
-	databaseDSNEnv     = "DATABASE_DSN"
-	keyEnv             = "KEY"
 )
 
 func main() {
-	var (
-		// Server config file
-		configFile string
-		// Server address and port
-		address string
-		// interval for saving data
-		storageInterval int
-		// file for save/restore date
-		fileStoragePath string
-		// flag for restore data
-		restore bool
-		// dsn for connect to postgres
-		databaseDSN string
-		// hash key for signature
-		hashKey string
-	)
-
-	flag.StringVar(&configFile, "c", "./build/server.yaml", "Server config file")
-	flag.StringVar(&address, "a", "localhost:8080", "Server address")
-	flag.StringVar(&fileStoragePath, "f", "/tmp/metrics-db.json", "Data storage file")
-	flag.IntVar(&storageInterval, "i", 300, "Interval between saving data")
-	flag.BoolVar(&restore, "r", true, "Restore data at the time of launch")
-	flag.StringVar(&databaseDSN, "d", "", "DSN for postgreSQL connection")
-	flag.StringVar(&hashKey, "k", "", "Key for generate hash")
-	flag.Parse()
-
-	value, ok := os.LookupEnv(addressEnv)
-	if ok {
-		address = value
-	}
-	host, port := splitAddress(address)
-
-	value, ok = os.LookupEnv(databaseDSNEnv)
-	if ok {
-		databaseDSN = value
-	}
-
-	value, ok = os.LookupEnv(keyEnv)
-	if ok {
-		hashKey = value
+	config, err := loadConfig(os.Args[1:])
+	if errors.Is(err, humayConfig.ErrPrintConfig) || errors.Is(err, flag.ErrHelp) {
+		return
 	}
-
-	saverConfig, err := getSaverConfig(storageInterval, fileStoragePath, restore)
 	if err != nil {
-		panic(err)
-	}
-
-	config := &serverApp.ServerConfig{
-		HTTPConfig: &humayHTTPServer.HTTPConfig{
-			Host:         host,
-			Port:         port,
-			ReadTimeout:  5,
-			WriteTimeout: 10,
-			IdleTimeout:  20,
-			HashKey:      hashKey,
-		},
-		SaverConfig: saverConfig,
-		DatabaseDSN: databaseDSN,
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
 	app, err := serverApp.NewApp(config)
 	if err != nil {
 		panic(err)
 	}
+	// SIGHUP loads the config again with the same arguments.
+	app.SetConfigLoader(func() (*serverApp.ServerConfig, error) {
+		return loadConfig(os.Args[1:])
+	})
 
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
@@ -92,54 +36,54 @@ func main() {
 	app.Run(ctx)
 }
 
-func splitAddress(address string) (host string, port int32) {
-	values := strings.Split(address, ":")
-	if len(values) == 1 {
-		host = values[0]
-		port = 8080
-		return
-	}
-
-	host = values[0]
-	p, err := strconv.Atoi(values[1])
-	if err != nil {
-		port = 8080
-	}
-	port = int32(p)
-
-	return
-}
-
-func getSaverConfig(i int, f string, r bool) (*serverApp.SaverConfig, error) {
-	var err error
+// loadConfig merges the defaults, the config file, the environment and the arguments.
+func loadConfig(args []string) (*serverApp.ServerConfig, error) {
+	config := serverApp.DefaultConfig()
+	http := config.HTTPConfig
 
-	sInterval := i
-	envI, ok := os.LookupEnv(storageIntervalEnv)
-	if ok {
-		sInterval, err = strconv.Atoi(envI)
-		if err != nil {
-			return nil, err
-		}
-	}
-
-	fStorage := f
-	envF, ok := os.LookupEnv(fileStoragePathEnv)
-	if ok {
-		fStorage = envF
-	}
+	loader := humayConfig.NewLoader("server", config)
+	loader.Add(
+		humayConfig.Var{
+			Env: "ADDRESS", Flag: "a", Usage: "Server address host:port", Default: "localhost:8080",
+			Set: humayConfig.HostPort(&http.Host, &http.Port),
+		},
+		humayConfig.Var{Path: "saver_config.interval", Env: "STORE_INTERVAL", Flag: "i", Usage: "Interval between saving data"},
+		humayConfig.Var{Path: "saver_config.storage_file", Env: "FILE_STORAGE_PATH", Flag: "f", Usage: "Data storage file"},
+		humayConfig.Var{Path: "saver_config.restore", Env: "RESTORE", Flag: "r", Usage: "Restore data at the time of launch"},
+		humayConfig.Var{Path: "saver_config.wal", Flag: "w", Usage: "Use write-ahead log between snapshots"},
+		humayConfig.Var{Path: "database_dsn", Env: "DATABASE_DSN", Flag: "d", Usage: "DSN for postgreSQL connection"},
+		humayConfig.Var{Path: "http_config.hash_key", Env: "KEY", Flag: "k", Usage: "Key for generate hash"},
+		humayConfig.Var{
+			Env: "ADMIN_TOKEN", Flag: "t", Usage: "Admin token, enables authorization by API tokens",
+			Set: func(value string) error {
+				http.Auth.AdminToken = value
+				http.Auth.Enabled = value != ""
+				return nil
+			},
+		},
+		humayConfig.Var{
+			Flag: "b", Usage: "Time to collect puts into one batch, 0 disables write buffer",
+			Set: func(value string) error {
+				if err := config.WriteBufferConfig.FlushInterval.Set(value); err != nil {
+					return err
+				}
+				config.WriteBufferConfig.Enabled = config.WriteBufferConfig.FlushInterval > 0
+				return nil
+			},
+		},
+		humayConfig.Var{Path: "cache.enabled", Flag: "cache", Usage: "Cache metric values in front of postgreSQL"},
+		humayConfig.Var{Path: "http_config.rate_limit", Flag: "l", Usage: "Requests per second for every agent, 0 disables the limit"},
+		humayConfig.Var{Path: "http_config.tls_cert", Flag: "tls-cert", Usage: "Server certificate file, enables HTTPS"},
+		humayConfig.Var{Path: "http_config.tls_key", Flag: "tls-key", Usage: "Server key file"},
+		humayConfig.Var{Path: "http_config.tls_client_ca", Flag: "tls-client-ca", Usage: "CA file to verify agent certificates"},
+		humayConfig.Var{Path: "http_config.trusted_subnet", Env: "TRUSTED_SUBNET", Flag: "trusted-subnet", Usage: "CIDR of agents allowed to write metrics"},
+		humayConfig.Var{Path: "logging.level", Env: "LOG_LEVEL", Flag: "log-level", Usage: "Log level: debug, info, warn or error"},
+		humayConfig.Var{Path: "logging.format", Env: "LOG_FORMAT", Flag: "log-format", Usage: "Log format: json or console"},
+	)
 
-	restore := r
-	envR, ok := os.LookupEnv(restoreEnv)
-	if ok {
-		restore, err = strconv.ParseBool(envR)
-		if err != nil {
-			return nil, err
-		}
+	if err := loader.Load(args); err != nil {
+		return nil, err
 	}
 
-	return &serverApp.SaverConfig{
-		Interval:    int32(sInterval),
-		StorageFile: fStorage,
-		Restore:     restore,
-	}, nil
+	return config, nil
 }
@@ -2,9 +2,11 @@ package humayagent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -13,8 +15,13 @@ import (
 
 	agentHTTP "github.com/zvfkjytytw/humay/internal/agent/http"
 	metrics "github.com/zvfkjytytw/humay/internal/agent/metrics"
+	humayAgentRelabel "github.com/zvfkjytytw/humay/internal/agent/relabel"
+	humayAgentStatus "github.com/zvfkjytytw/humay/internal/agent/status"
 	common "github.com/zvfkjytytw/humay/internal/common"
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
 	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayLogging "github.com/zvfkjytytw/humay/internal/common/logging"
+	humayTracing "github.com/zvfkjytytw/humay/internal/common/tracing"
 )
 
 const batchSize = 5
@@ -25,17 +32,101 @@ type serverClient interface {
 	UpdateJSONGauge(metricName string, metricValue float64) error
 	UpdateJSONCounter(metricName string, metricValue int64) error
 	UpdateJSONMetrics([]*httpModels.Metric) error
+	SetHashKey(hashKey string)
 	Stop()
 }
 
+// settings applied on SIGHUP, changes of others need a restart.
+var reloadable = map[string]bool{
+	"poll_interval":   true,
+	"report_interval": true,
+	"report_limit":    true,
+	"hash_key":        true,
+	"collectors":      true,
+	"logging.level":   true,
+	"relabel":         true,
+}
+
 type AgentConfig struct {
-	ServerAddress  string `yaml:"server_address"`
-	ServerPort     int32  `yaml:"server_port"`
-	ServerType     string `yaml:"server_type"`
-	PollInterval   int32  `yaml:"poll_interval"`
-	ReportInterval int32  `yaml:"report_interval"`
-	RateLimit      int32  `yaml:"report_limit"`
-	HashKey        string `yaml:"hash_key"`
+	ServerAddress  string              `yaml:"server_address"`
+	ServerPort     int32               `yaml:"server_port"`
+	ServerType     string              `yaml:"server_type"`
+	PollInterval   humayConfig.Seconds `yaml:"poll_interval"`
+	ReportInterval humayConfig.Seconds `yaml:"report_interval"`
+	// batches sent to the server at once.
+	RateLimit int32  `yaml:"report_limit"`
+	HashKey   string `yaml:"hash_key" secret:"true"`
+	Token     string `yaml:"token" secret:"true"`
+	// name of the agent shown by the dashboard of the server, the host name by default.
+	Name string `yaml:"name,omitempty"`
+	// CA bundle to verify the server, enables HTTPS.
+	TLSCA string `yaml:"tls_ca,omitempty"`
+	// client certificate and key for mutual TLS.
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+	// local health and status endpoint.
+	Status *humayAgentStatus.Config `yaml:"status,omitempty"`
+	// exporter of the spans of sends.
+	Tracing *humayTracing.Config `yaml:"tracing,omitempty"`
+	// polled sources: runtime and gops, all by default.
+	Collectors []string             `yaml:"collectors,omitempty"`
+	Logging    *humayLogging.Config `yaml:"logging,omitempty"`
+	// rules applied in order to the polled metrics before they are sent.
+	Relabel []humayAgentRelabel.Rule `yaml:"relabel,omitempty"`
+}
+
+// DefaultConfig is the config before the file, the environment and flags are applied.
+func DefaultConfig() *AgentConfig {
+	return &AgentConfig{
+		ServerAddress:  "localhost",
+		ServerPort:     8080,
+		ServerType:     "http",
+		PollInterval:   2,
+		ReportInterval: 10,
+		RateLimit:      5,
+	}
+}
+
+// Validate checks the config of the agent.
+func (c *AgentConfig) Validate() error {
+	errs := []error{
+		humayConfig.Check(c.ServerAddress != "", "server_address", "is required"),
+		humayConfig.Check(c.ServerPort > 0 && c.ServerPort < 1<<16, "server_port", "must be between 1 and 65535, got %d", c.ServerPort),
+		humayConfig.Check(c.ServerType == "http", "server_type", "unknown type %q, expect http", c.ServerType),
+		humayConfig.Check(c.PollInterval > 0, "poll_interval", "must be positive"),
+		humayConfig.Check(c.ReportInterval > 0, "report_interval", "must be positive"),
+		humayConfig.Check(c.RateLimit >= 0, "report_limit", "must not be negative, got %d", c.RateLimit),
+		humayConfig.Check((c.TLSCert == "") == (c.TLSKey == ""), "tls_cert", "certificate and key must be set together"),
+	}
+	if c.Tracing != nil {
+		errs = append(errs, humayConfig.Prefix("tracing", c.Tracing.Validate()))
+	}
+	if c.Logging != nil {
+		errs = append(errs, humayConfig.Prefix("logging", c.Logging.Validate()))
+	}
+	errs = append(errs, humayAgentRelabel.ValidateRules(c.Relabel))
+	for _, collector := range c.Collectors {
+		errs = append(errs, humayConfig.Check(
+			collector == humayAgentStatus.PollRuntime || collector == humayAgentStatus.PollGops,
+			"collectors", "unknown collector %q, expect %s or %s", collector, humayAgentStatus.PollRuntime, humayAgentStatus.PollGops,
+		))
+	}
+
+	return errors.Join(errs...)
+}
+
+// collectors returns the set of enabled collectors.
+func (c *AgentConfig) collectors() map[string]bool {
+	if len(c.Collectors) == 0 {
+		return map[string]bool{humayAgentStatus.PollRuntime: true, humayAgentStatus.PollGops: true}
+	}
+
+	collectors := make(map[string]bool, len(c.Collectors))
+	for _, collector := range c.Collectors {
+		collectors[collector] = true
+	}
+
+	return collectors
 }
 
 type AgentApp struct {
@@ -45,11 +136,32 @@ type AgentApp struct {
 	client         serverClient
 	poller         *metrics.Poller
 	logger         *zap.Logger
+	tls            *common.CertReloader
+	stats          *humayAgentStatus.Stats
+	statusServer   *humayAgentStatus.Server
+	stopTracing    humayTracing.Shutdown
+	// running config and its loader for SIGHUP.
+	config *AgentConfig
+	load   func() (*AgentConfig, error)
+	// tickers of the collectors and reports, reset on reload.
+	pollTickers  map[string]*time.Ticker
+	reportTicker *time.Ticker
+	// stops of the running senders.
+	senders   []chan struct{}
+	mx        sync.RWMutex
+	enabled   map[string]bool
+	relabeler *humayAgentRelabel.Relabeler
 }
 
 func NewApp(config *AgentConfig) (*AgentApp, error) {
 	// Init logger
-	logger, err := common.InitLogger()
+	logger, err := humayLogging.New(config.Logging)
+	if err != nil {
+		return nil, err
+	}
+
+	// Init tracing
+	stopTracing, err := humayTracing.Init(context.Background(), config.Tracing, "humay-agent")
 	if err != nil {
 		return nil, err
 	}
@@ -61,10 +173,28 @@ func NewApp(config *AgentConfig) (*AgentApp, error) {
 	}
 	poller.FlushPollCount()
 
+	// Init relabeling
+	relabeler, err := humayAgentRelabel.New(config.Relabel)
+	if err != nil {
+		return nil, err
+	}
+
+	// Init own state
+	staleAfter := 3 * config.ReportInterval
+	if config.Status != nil && config.Status.StaleAfter > 0 {
+		staleAfter = config.Status.StaleAfter
+	}
+	stats := humayAgentStatus.NewStats(time.Duration(staleAfter) * time.Second)
+	var statusServer *humayAgentStatus.Server
+	if config.Status != nil && config.Status.Address != "" {
+		statusServer = humayAgentStatus.NewServer(config.Status.Address, stats, logger)
+	}
+
 	// Init server client
 	var client serverClient
+	var reloader *common.CertReloader
 	if config.ServerType == "http" {
-		client, err = agentHTTP.NewClient(
+		httpClient, err := agentHTTP.NewClient(
 			fmt.Sprintf("%s:%d", config.ServerAddress, config.ServerPort),
 			logger,
 			config.HashKey,
@@ -72,20 +202,47 @@ func NewApp(config *AgentConfig) (*AgentApp, error) {
 		if err != nil {
 			return nil, err
 		}
+		httpClient.SetToken(config.Token)
+		name := config.Name
+		if name == "" {
+			name, _ = os.Hostname() //nolint // the server uses the address without the name
+		}
+		httpClient.SetName(name)
+		httpClient.SetStats(stats)
+		if config.TLSCA != "" || config.TLSCert != "" || config.TLSKey != "" {
+			reloader, err = common.NewCertReloader(config.TLSCert, config.TLSKey, config.TLSCA)
+			if err != nil {
+				return nil, err
+			}
+			httpClient.SetTLS(reloader)
+		}
+		client = httpClient
 	}
 
 	return &AgentApp{
-		pollInterval:   config.PollInterval,
-		reportInterval: config.ReportInterval,
+		pollInterval:   int32(config.PollInterval),
+		reportInterval: int32(config.ReportInterval),
 		rateLimit:      config.RateLimit,
 		client:         client,
 		poller:         poller,
 		logger:         logger,
+		tls:            reloader,
+		stats:          stats,
+		statusServer:   statusServer,
+		stopTracing:    stopTracing,
+		config:         config,
+		enabled:        config.collectors(),
+		relabeler:      relabeler,
 	}, nil
 }
 
+// SetConfigLoader sets the loader of the config for SIGHUP.
+func (a *AgentApp) SetConfigLoader(load func() (*AgentConfig, error)) {
+	a.load = load
+}
+
 func NewAppFromFile(configFile string) (*AgentApp, error) {
-	config := &AgentConfig{}
+	config := DefaultConfig()
 	configData, err := common.ReadConfigFile(configFile)
 	if err != nil {
 		return nil, err //nolint //wraped higher
@@ -96,6 +253,11 @@ func NewAppFromFile(configFile string) (*AgentApp, error) {
 		return nil, err //nolint //wraped higher
 	}
 
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+
 	return NewApp(config)
 }
 
@@ -118,65 +280,205 @@ func (a *AgentApp) Run(ctx context.Context) {
 		metricsChan = make(chan []*httpModels.Metric)
 	}
 	defer close(metricsChan)
+	a.stats.SetQueue(func() (int, int) {
+		return len(metricsChan), cap(metricsChan)
+	})
+
+	// answer health probes.
+	if a.statusServer != nil {
+		go a.statusServer.Start()
+	}
 
-	// poll runtime metrics.
-	go func(interval int32, stop <-chan struct{}) {
-		ticker := time.NewTicker(time.Duration(interval) * time.Second)
-		defer ticker.Stop()
+	// poll metrics of the collectors.
+	a.pollTickers = map[string]*time.Ticker{
+		humayAgentStatus.PollRuntime: time.NewTicker(a.config.PollInterval.Duration()),
+		humayAgentStatus.PollGops:    time.NewTicker(a.config.PollInterval.Duration()),
+	}
+	for kind, ticker := range a.pollTickers {
+		go a.poll(kind, ticker, stopChannel)
+	}
+
+	// send batched metrics in limit channel.
+	a.reportTicker = time.NewTicker(a.config.ReportInterval.Duration())
+	go func(metricsChan chan<- []*httpModels.Metric, stop <-chan struct{}) {
 		for {
 			select {
 			case <-stop:
 				return
-			case <-ticker.C:
-				a.poller.Update()
+			case <-a.reportTicker.C:
+				a.reportMetrics(metricsChan)
 			}
 		}
-	}(a.pollInterval, stopChannel)
+	}(metricsChan, stopChannel)
 
-	// poll gopsutils metrics.
-	go func(interval int32, stop <-chan struct{}) {
-		ticker := time.NewTicker(time.Duration(interval) * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-stop:
-				return
-			case <-ticker.C:
-				a.poller.UpdateGops()
+	// report metrics
+	a.setSenders(int(a.rateLimit), metricsChan)
+
+	for stopSignal := range sigChanel {
+		if stopSignal == syscall.SIGHUP {
+			a.reload(metricsChan)
+			continue
+		}
+
+		a.logger.Sugar().Debugf("Stop by %v", stopSignal)
+		close(stopChannel)
+		for _, stop := range a.senders {
+			close(stop)
+		}
+		for _, ticker := range a.pollTickers {
+			ticker.Stop()
+		}
+		a.reportTicker.Stop()
+		a.client.Stop()
+		if a.statusServer != nil {
+			if err := a.statusServer.Stop(ctx); err != nil {
+				a.logger.Sugar().Errorf("failed stop status server: %v", err)
 			}
 		}
-	}(a.pollInterval, stopChannel)
+		if err := a.stopTracing(ctx); err != nil {
+			a.logger.Sugar().Errorf("failed flush spans: %v", err)
+		}
+		return
+	}
+}
 
-	// send batched metrics in limit channel.
-	go func(interval int32, metricsChan chan<- []*httpModels.Metric, stop <-chan struct{}) {
-		ticker := time.NewTicker(time.Duration(interval) * time.Second)
-		defer ticker.Stop()
-		for {
-			select {
-			case <-stop:
-				return
-			case <-ticker.C:
-				a.reportMetrics(metricsChan)
+// poll updates metrics of the collector while it is enabled.
+func (a *AgentApp) poll(kind string, ticker *time.Ticker, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			a.mx.RLock()
+			enabled := a.enabled[kind]
+			a.mx.RUnlock()
+			if !enabled {
+				continue
+			}
+
+			start := time.Now()
+			if kind == humayAgentStatus.PollGops {
+				a.poller.UpdateGops()
+			} else {
+				a.poller.Update()
 			}
+			a.stats.ObservePoll(kind, time.Since(start))
 		}
-	}(a.reportInterval, metricsChan, stopChannel)
+	}
+}
 
-	// report metrics
-	go func(metricsChan <-chan []*httpModels.Metric, stop <-chan struct{}) {
-		for {
-			select {
-			case <-stop:
+// setSenders starts or stops senders of the queue, so at most n batches are sent at once.
+func (a *AgentApp) setSenders(n int, metricsChan <-chan []*httpModels.Metric) {
+	// without the limit the queue is not buffered and one sender reads it.
+	if n < 1 {
+		n = 1
+	}
+	for len(a.senders) < n {
+		stop := make(chan struct{})
+		a.senders = append(a.senders, stop)
+		go a.send(metricsChan, stop)
+	}
+	for len(a.senders) > n {
+		last := len(a.senders) - 1
+		close(a.senders[last])
+		a.senders = a.senders[:last]
+	}
+}
+
+func (a *AgentApp) send(metricsChan <-chan []*httpModels.Metric, stop <-chan struct{}) {
+	for {
+		select {
+		case <-stop:
+			return
+		case metrics, ok := <-metricsChan:
+			if !ok {
 				return
-			case metrics := <-metricsChan:
-				a.client.UpdateJSONMetrics(metrics)
+			}
+			if err := a.client.UpdateJSONMetrics(metrics); err != nil {
+				a.logger.Sugar().Errorf("failed send %d metrics: %v", len(metrics), err)
 			}
 		}
-	}(metricsChan, stopChannel)
+	}
+}
+
+// reload certificates and the config, failed reload keeps the previous ones.
+func (a *AgentApp) reload(metricsChan <-chan []*httpModels.Metric) {
+	if a.tls != nil {
+		if err := a.tls.Reload(); err != nil {
+			a.logger.Sugar().Errorf("failed reload certificates: %v", err)
+		} else {
+			a.logger.Info("certificates reloaded")
+		}
+	}
+
+	if a.load == nil {
+		return
+	}
+	config, err := a.load()
+	if err != nil {
+		a.logger.Sugar().Errorf("failed reload config, the current one is kept: %v", err)
+		return
+	}
+
+	for _, path := range humayConfig.Diff(a.config, config) {
+		if !reloadable[path] {
+			a.logger.Sugar().Warnf("changed %s is applied after restart", path)
+			continue
+		}
 
-	stopSignal := <-sigChanel
-	a.logger.Sugar().Debugf("Stop by %v", stopSignal)
-	close(stopChannel)
-	a.client.Stop()
+		switch path {
+		case "poll_interval":
+			for _, ticker := range a.pollTickers {
+				ticker.Reset(config.PollInterval.Duration())
+			}
+			a.config.PollInterval = config.PollInterval
+		case "report_interval":
+			a.reportTicker.Reset(config.ReportInterval.Duration())
+			a.config.ReportInterval = config.ReportInterval
+		case "report_limit":
+			a.setSenders(int(config.RateLimit), metricsChan)
+			a.config.RateLimit = config.RateLimit
+		case "hash_key":
+			a.client.SetHashKey(config.HashKey)
+			a.config.HashKey = config.HashKey
+		case "collectors":
+			enabled := config.collectors()
+			a.mx.Lock()
+			a.enabled = enabled
+			a.mx.Unlock()
+			if !enabled[humayAgentStatus.PollRuntime] {
+				a.poller.DropRuntime()
+			}
+			if !enabled[humayAgentStatus.PollGops] {
+				a.poller.DropGops()
+			}
+			a.config.Collectors = config.Collectors
+		case "relabel":
+			relabeler, err := humayAgentRelabel.New(config.Relabel)
+			if err != nil {
+				a.logger.Sugar().Errorf("failed apply %s: %v", path, err)
+				continue
+			}
+			a.mx.Lock()
+			a.relabeler = relabeler
+			a.mx.Unlock()
+			a.config.Relabel = config.Relabel
+		case "logging.level":
+			var level string
+			if config.Logging != nil {
+				level = config.Logging.Level
+			}
+			if err := humayLogging.SetLevel(level); err != nil {
+				a.logger.Sugar().Errorf("failed apply %s: %v", path, err)
+				continue
+			}
+			if a.config.Logging == nil {
+				a.config.Logging = &humayLogging.Config{}
+			}
+			a.config.Logging.Level = level
+		}
+		a.logger.Sugar().Infof("applied %s", path)
+	}
 }
 
 func (a *AgentApp) reportMetrics(metricsChan chan<- []*httpModels.Metric) {
@@ -204,15 +506,30 @@ func (a *AgentApp) reportMetrics(metricsChan chan<- []*httpModels.Metric) {
 			)
 		}
 	}
+	pollCount := a.poller.Metrics.Counter["PollCount"]
 	a.poller.Metrics.Mx.RUnlock()
 
+	a.mx.RLock()
+	relabeler := a.relabeler
+	a.mx.RUnlock()
+	now := time.Now()
+	metrics = relabeler.Apply(metrics, now)
+
 	limitIndex := batchSize * (len(metrics) / batchSize)
 	for i := 0; i < limitIndex; i += batchSize {
 		metricsChan <- metrics[i : i+batchSize]
 	}
-	metricsChan <- metrics[limitIndex:]
+	if limitIndex < len(metrics) {
+		metricsChan <- metrics[limitIndex:]
+	}
 
-	if err := a.client.UpdateJSONCounter("PollCount", a.poller.Metrics.Counter["PollCount"]); err == nil {
+	// the poll counter is flushed after it is sent or dropped by the rules.
+	counter := relabeler.Apply([]*httpModels.Metric{{ID: "PollCount", MType: "counter", Delta: &pollCount}}, now)
+	if len(counter) == 0 {
+		a.poller.FlushPollCount()
+		return
+	}
+	if err := a.client.UpdateJSONMetrics(counter); err == nil {
 		a.poller.FlushPollCount()
 	}
 }
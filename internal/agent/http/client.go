@@ -2,21 +2,29 @@ package humayhttpagent
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
 	"encoding/json"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/sethvargo/go-retry"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 
+	humayAgentStatus "github.com/zvfkjytytw/humay/internal/agent/status"
 	humayCommon "github.com/zvfkjytytw/humay/internal/common"
+	humayHTTPClient "github.com/zvfkjytytw/humay/internal/common/http/client"
 	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayTracing "github.com/zvfkjytytw/humay/internal/common/tracing"
 )
 
 const (
@@ -26,6 +34,8 @@ const (
 	expectIncrease = 2 * time.Second
 	startExpect    = 1 * time.Second
 	maxRetries     = 4
+	// longest server asked pause the agent waits for.
+	maxRetryAfter = 5 * time.Second
 )
 
 type HTTPClient struct {
@@ -33,7 +43,11 @@ type HTTPClient struct {
 	protocol string
 	client   http.Client
 	logger   *zap.Logger
+	mx       sync.RWMutex
 	hashKey  string
+	token    string
+	name     string
+	stats    *humayAgentStatus.Stats
 }
 
 func NewClient(address string, logger *zap.Logger, hashKey string) (*HTTPClient, error) {
@@ -52,6 +66,47 @@ func NewClient(address string, logger *zap.Logger, hashKey string) (*HTTPClient,
 	}, nil
 }
 
+// SetHashKey replaces the key of signatures while the agent runs.
+func (h *HTTPClient) SetHashKey(hashKey string) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+	h.hashKey = hashKey
+}
+
+func (h *HTTPClient) key() string {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+
+	return h.hashKey
+}
+
+// SetTLS switches the client to HTTPS with the certificates of the reloader.
+func (h *HTTPClient) SetTLS(reloader *humayCommon.CertReloader) {
+	host, _, err := net.SplitHostPort(h.address)
+	if err != nil {
+		host = h.address
+	}
+	if tr, ok := h.client.Transport.(*http.Transport); ok {
+		tr.TLSClientConfig = reloader.ClientConfig(host)
+	}
+	h.protocol = HTTPSProtocol
+}
+
+// SetToken sets API token sent as bearer in every request.
+func (h *HTTPClient) SetToken(token string) {
+	h.token = token
+}
+
+// SetName sets the name of the agent sent in every request.
+func (h *HTTPClient) SetName(name string) {
+	h.name = name
+}
+
+// SetStats enables counting of sends and retries of JSON requests.
+func (h *HTTPClient) SetStats(stats *humayAgentStatus.Stats) {
+	h.stats = stats
+}
+
 // update metric block for text/plain case.
 func (h *HTTPClient) UpdateGauge(metricName string, metricValue float64) error {
 	value := strconv.FormatFloat(metricValue, 'f', -1, 64)
@@ -74,9 +129,9 @@ func (h *HTTPClient) updateMetric(metricType, metricName, metricValue string) er
 		return err //nolint //wraped higher
 	}
 
-	if h.hashKey != "" {
-		hash := fmt.Sprintf("%x", humayCommon.Hash256([]byte(body), h.hashKey))
-		req.Header.Set("HashSHA256", hash)
+	nonce, err := h.sign(req, []byte(body))
+	if err != nil {
+		return err
 	}
 
 	req.Header.Set("Content-Type", "text/plain")
@@ -90,6 +145,10 @@ func (h *HTTPClient) updateMetric(metricType, metricName, metricValue string) er
 		return fmt.Errorf("metric %s not saved", metricName)
 	}
 
+	if _, err = h.verify(resp, nonce); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -115,140 +174,218 @@ func (h *HTTPClient) UpdateJSONCounter(metricName string, metricValue int64) err
 func (h *HTTPClient) updateJSONMetric(metric *httpModels.Metric) error {
 	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
 	defer cancel()
-	backoff := retry.WithMaxRetries(
-		maxRetries,
-		retry.WithCappedDuration(
-			expectIncrease,
-			retry.NewFibonacci(startExpect),
-		),
-	)
+	backoff := humayHTTPClient.Backoff(maxRetries, startExpect, expectIncrease)
 
-	if err := retry.Do(
+	attempts := 0
+	err := retry.Do(
 		ctx,
 		backoff,
 		func(ctx context.Context) error {
+			attempts++
 			body, err := json.Marshal(metric)
 			if err != nil {
 				h.logger.Sugar().Errorf("failed marshal metric body: %v", metric)
 				return err
 			}
 
-			buf := &bytes.Buffer{}
-			gzWriter, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
-			if _, err := gzWriter.Write(body); err != nil {
-				h.logger.Sugar().Errorf("failed compress body: %v", err)
-				return err
-			}
-			if err := gzWriter.Close(); err != nil {
-				h.logger.Sugar().Errorf("failed close compressor: %v", err)
+			compressed, err := humayHTTPClient.Compress(body)
+			if err != nil {
+				h.logger.Sugar().Error(err)
 				return err
 			}
 
 			req, err := http.NewRequest(
 				http.MethodPost,
 				fmt.Sprintf("%s://%s%s", h.protocol, h.address, httpModels.UpdateHandler),
-				bytes.NewReader(buf.Bytes()),
+				bytes.NewReader(compressed),
 			)
 			if err != nil {
 				return err //nolint //wraped higher
 			}
 
-			if h.hashKey != "" {
-				hash := fmt.Sprintf("%x", humayCommon.Hash256(body, h.hashKey))
-				req.Header.Set("HashSHA256", hash)
+			nonce, err := h.sign(req, body)
+			if err != nil {
+				return err
 			}
 
 			req.Header.Set("Content-Type", "application/json")
 			req.Header.Set("Content-Encoding", "gzip")
 			resp, err := h.client.Do(req)
 			if err != nil {
-				return err //nolint //wraped higher
+				return humayHTTPClient.RetryableSend(err)
 			}
 			defer resp.Body.Close()
 
 			if resp.StatusCode != http.StatusOK {
-				return fmt.Errorf("metric %s not saved", metric.ID)
+				return humayHTTPClient.RetryableStatus(ctx, resp, fmt.Errorf("metric %s not saved: %s", metric.ID, resp.Status), maxRetryAfter)
+			}
+
+			if _, err = h.verify(resp, nonce); err != nil {
+				return err
 			}
 
 			return nil
 		},
-	); err != nil {
-		return err
-	}
+	)
+	h.stats.ObserveSend(attempts, err)
 
-	return nil
+	return err
 }
 
+// UpdateJSONMetrics sends the batch to /updates.
+// Marshalling, compression and every attempt of the send are traced apart.
 func (h *HTTPClient) UpdateJSONMetrics(metrics []*httpModels.Metric) error {
-	ctx, cancel := context.WithTimeout(context.Background(), requestTimeout)
-	defer cancel()
-	backoff := retry.WithMaxRetries(
-		maxRetries,
-		retry.WithCappedDuration(
-			expectIncrease,
-			retry.NewFibonacci(startExpect),
-		),
+	ctx, span := humayTracing.Tracer().Start(context.Background(), "UpdateJSONMetrics",
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(attribute.Int("metrics.count", len(metrics))),
 	)
+	defer span.End()
+
+	ctx, cancel := context.WithTimeout(ctx, requestTimeout)
+	defer cancel()
+	backoff := humayHTTPClient.Backoff(maxRetries, startExpect, expectIncrease)
 
-	if err := retry.Do(
+	attempts := 0
+	err := retry.Do(
 		ctx,
 		backoff,
 		func(ctx context.Context) error {
-			body, err := json.Marshal(metrics)
+			attempts++
+			ctx, attemptSpan := humayTracing.Tracer().Start(ctx, "attempt", trace.WithAttributes(attribute.Int("attempt", attempts)))
+			defer attemptSpan.End()
+
+			err := h.sendJSONMetrics(ctx, metrics)
 			if err != nil {
-				h.logger.Sugar().Errorf("failed marshal metric body: %v", metrics)
-				return err
+				attemptSpan.RecordError(err)
+				attemptSpan.SetStatus(codes.Error, err.Error())
 			}
 
-			buf := &bytes.Buffer{}
-			gzWriter, _ := gzip.NewWriterLevel(buf, gzip.BestCompression)
-			if _, err := gzWriter.Write(body); err != nil {
-				h.logger.Sugar().Errorf("failed compress body: %v", err)
-				return err
-			}
-			if err := gzWriter.Close(); err != nil {
-				h.logger.Sugar().Errorf("failed close compressor: %v", err)
-				return err
-			}
+			return err
+		},
+	)
+	h.stats.ObserveSend(attempts, err)
 
-			req, err := http.NewRequest(
-				http.MethodPost,
-				fmt.Sprintf("%s://%s%s", h.protocol, h.address, httpModels.UpdatesHandler),
-				bytes.NewReader(buf.Bytes()),
-			)
-			if err != nil {
-				return err //nolint //wraped higher
-			}
+	span.SetAttributes(attribute.Int("attempts", attempts))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
 
-			if h.hashKey != "" {
-				hash := fmt.Sprintf("%x", humayCommon.Hash256(body, h.hashKey))
-				req.Header.Set("HashSHA256", hash)
-			}
+	return err
+}
 
-			req.Header.Add("Content-Type", "application/json")
-			req.Header.Add("Content-Encoding", "gzip")
-			resp, err := h.client.Do(req)
-			if err != nil {
-				return err //nolint //wraped higher
-			}
-			defer resp.Body.Close()
+// one attempt of UpdateJSONMetrics.
+func (h *HTTPClient) sendJSONMetrics(ctx context.Context, metrics []*httpModels.Metric) error {
+	tracer := humayTracing.Tracer()
 
-			if resp.StatusCode != http.StatusOK {
-				bodyBytes, err := io.ReadAll(resp.Body)
-				if err != nil {
-					h.logger.Sugar().Errorf("failed read response body: %v", err)
-				}
-				return fmt.Errorf("metrics not saved: %s", string(bodyBytes))
-			}
-			return nil
-		},
-	); err != nil {
+	_, span := tracer.Start(ctx, "marshal")
+	body, err := json.Marshal(metrics)
+	span.SetAttributes(attribute.Int("body.size", len(body)))
+	span.End()
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshal metric body: %v", metrics)
+		return err
+	}
+
+	_, span = tracer.Start(ctx, "gzip")
+	compressed, err := humayHTTPClient.Compress(body)
+	if err != nil {
+		span.End()
+		h.logger.Sugar().Error(err)
+		return err
+	}
+	span.SetAttributes(attribute.Int("body.compressed_size", len(compressed)))
+	span.End()
+
+	ctx, span = tracer.Start(ctx, "POST "+httpModels.UpdatesHandler, trace.WithSpanKind(trace.SpanKindClient))
+	defer span.End()
+
+	req, err := http.NewRequestWithContext(
+		ctx,
+		http.MethodPost,
+		fmt.Sprintf("%s://%s%s", h.protocol, h.address, httpModels.UpdatesHandler),
+		bytes.NewReader(compressed),
+	)
+	if err != nil {
+		return err //nolint //wraped higher
+	}
+
+	nonce, err := h.sign(req, body)
+	if err != nil {
+		return err
+	}
+
+	req.Header.Add("Content-Type", "application/json")
+	req.Header.Add("Content-Encoding", "gzip")
+	humayTracing.Inject(ctx, propagation.HeaderCarrier(req.Header))
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return humayHTTPClient.RetryableSend(err)
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(attribute.Int("http.response.status_code", resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusMultiStatus {
+		bodyBytes, err := io.ReadAll(resp.Body)
+		if err != nil {
+			h.logger.Sugar().Errorf("failed read response body: %v", err)
+		}
+		return humayHTTPClient.RetryableStatus(ctx, resp, fmt.Errorf("metrics not saved: %s", string(bodyBytes)), maxRetryAfter)
+	}
+
+	respBody, err := h.verify(resp, nonce)
+	if err != nil {
 		return err
 	}
 
+	// the valid metrics of the partly saved batch are stored, sending it again would count them twice.
+	if resp.StatusCode == http.StatusMultiStatus {
+		var results []*httpModels.MetricResult
+		if err = json.Unmarshal(respBody, &results); err != nil {
+			h.logger.Sugar().Errorf("failed read results of the batch: %v", err)
+			return nil
+		}
+		rejected := 0
+		for _, result := range results {
+			if result == nil || result.Error == nil {
+				continue
+			}
+			rejected++
+			h.logger.Sugar().Warnf("metric %s rejected: %s", result.Error.MetricID, result.Error.Message)
+		}
+		h.stats.ObserveRejected(rejected)
+		span.SetAttributes(attribute.Int("metrics.rejected", rejected))
+	}
+
 	return nil
 }
 
+// sign adds API token, agent name and the signature of the plain body to the request.
+func (h *HTTPClient) sign(req *http.Request, body []byte) (string, error) {
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	if h.name != "" {
+		req.Header.Set(httpModels.AgentHeader, h.name)
+	}
+
+	return humayHTTPClient.Sign(req, h.key(), body)
+}
+
+// verify checks that the response is signed by the server for this request.
+func (h *HTTPClient) verify(resp *http.Response, nonce string) ([]byte, error) {
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed read response body: %v", err)
+	}
+
+	if err = humayHTTPClient.Verify(resp, h.key(), body, nonce); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
 func (h *HTTPClient) Stop() {
 	h.client.CloseIdleConnections()
 }
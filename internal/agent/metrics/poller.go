@@ -4,6 +4,7 @@ import (
 	"math/rand"
 	"runtime"
 	"strconv"
+	"strings"
 	"sync"
 
 	"github.com/shirou/gopsutil/v4/cpu"
@@ -103,3 +104,30 @@ func (p *Poller) UpdateGops() {
 		p.Metrics.Gauge["FreeMemory"] = float64(v.Free)
 	}
 }
+
+// DropGops removes metrics of gopsutil, so the disabled collector is not reported.
+func (p *Poller) DropGops() {
+	p.drop(isGops)
+}
+
+// DropRuntime removes gauges of the runtime, so the disabled collector is not reported.
+func (p *Poller) DropRuntime() {
+	p.drop(func(name string) bool {
+		return !isGops(name)
+	})
+}
+
+func (p *Poller) drop(match func(name string) bool) {
+	p.Metrics.Mx.Lock()
+	defer p.Metrics.Mx.Unlock()
+
+	for name := range p.Metrics.Gauge {
+		if match(name) {
+			delete(p.Metrics.Gauge, name)
+		}
+	}
+}
+
+func isGops(name string) bool {
+	return name == "TotalMemory" || name == "FreeMemory" || strings.HasPrefix(name, CPUutilization)
+}
@@ -0,0 +1,211 @@
+package humayagentrelabel
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"sync"
+	"time"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+// actions of the rules.
+const (
+	// drop matching metrics.
+	ActionDrop = "drop"
+	// drop metrics that don't match.
+	ActionKeep = "keep"
+	// replace the name by the replacement with groups of the match like $1.
+	ActionRename = "rename"
+	// add the prefix to the name.
+	ActionPrefix = "prefix"
+	// add static labels.
+	ActionLabel = "label"
+	// send the change of the gauge per second instead of its value.
+	ActionRate = "rate"
+)
+
+// Rule changes metrics matching the name and the type.
+type Rule struct {
+	Action string `yaml:"action"`
+	// regexp of the whole name, every name if empty.
+	Match string `yaml:"match,omitempty"`
+	// gauge or counter, both if empty.
+	Type        string            `yaml:"type,omitempty"`
+	Replacement string            `yaml:"replacement,omitempty"`
+	Prefix      string            `yaml:"prefix,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+}
+
+// Validate checks the action and its arguments.
+func (r *Rule) Validate() error {
+	_, err := r.compile()
+	errs := []error{
+		humayConfig.Check(err == nil, "match", "%v", err),
+		humayConfig.Check(r.Type == "" || r.Type == httpModels.GaugeMetric || r.Type == httpModels.CounterMetric, "type", "unknown type %q", r.Type),
+	}
+
+	switch r.Action {
+	case ActionDrop, ActionKeep:
+	case ActionRename:
+		errs = append(errs,
+			humayConfig.Check(r.Match != "", "match", "is required by rename"),
+			humayConfig.Check(r.Replacement != "", "replacement", "is required by rename"),
+		)
+	case ActionPrefix:
+		errs = append(errs, humayConfig.Check(r.Prefix != "", "prefix", "is required by prefix"))
+	case ActionLabel:
+		errs = append(errs, humayConfig.Check(len(r.Labels) > 0, "labels", "are required by label"))
+	case ActionRate:
+		errs = append(errs, humayConfig.Check(r.Type != httpModels.CounterMetric, "type", "rate applies to gauges only"))
+	default:
+		errs = append(errs, fmt.Errorf("action: unknown action %q", r.Action))
+	}
+
+	return errors.Join(errs...)
+}
+
+func (r *Rule) compile() (*regexp.Regexp, error) {
+	if r.Match == "" {
+		return nil, nil
+	}
+
+	return regexp.Compile("^(?:" + r.Match + ")$")
+}
+
+// ValidateRules checks every rule and prefixes errors by its index.
+func ValidateRules(rules []Rule) error {
+	errs := make([]error, 0, len(rules))
+	for i := range rules {
+		errs = append(errs, humayConfig.Prefix(fmt.Sprintf("relabel[%d]", i), rules[i].Validate()))
+	}
+
+	return errors.Join(errs...)
+}
+
+type rule struct {
+	Rule
+	match *regexp.Regexp
+}
+
+func (r *rule) matches(metric *httpModels.Metric) bool {
+	if r.Type != "" && r.Type != metric.MType {
+		return false
+	}
+	if r.Action == ActionRate && metric.MType != httpModels.GaugeMetric {
+		return false
+	}
+
+	return r.match == nil || r.match.MatchString(metric.ID)
+}
+
+type sample struct {
+	value float64
+	time  time.Time
+}
+
+// Relabeler applies the rules in order to every reported metric.
+type Relabeler struct {
+	mx    sync.Mutex
+	rules []*rule
+	// previous values of the gauges sent as rates.
+	last map[string]sample
+}
+
+// New compiles the rules, nil relabeler passes metrics as they are.
+func New(rules []Rule) (*Relabeler, error) {
+	if err := ValidateRules(rules); err != nil {
+		return nil, err
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	r := &Relabeler{last: make(map[string]sample)}
+	for _, config := range rules {
+		match, _ := config.compile()
+		r.rules = append(r.rules, &rule{Rule: config, match: match})
+	}
+
+	return r, nil
+}
+
+// Apply returns the changed metrics without the dropped ones.
+// Gauges sent as rates are dropped until their second report.
+func (r *Relabeler) Apply(metrics []*httpModels.Metric, now time.Time) []*httpModels.Metric {
+	if r == nil {
+		return metrics
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	result := metrics[:0]
+	for _, metric := range metrics {
+		if r.apply(metric, now) {
+			result = append(result, metric)
+		}
+	}
+
+	return result
+}
+
+// apply changes the metric in place and reports whether it is kept.
+func (r *Relabeler) apply(metric *httpModels.Metric, now time.Time) bool {
+	for _, rule := range r.rules {
+		matches := rule.matches(metric)
+		switch rule.Action {
+		case ActionDrop:
+			if matches {
+				return false
+			}
+		case ActionKeep:
+			if !matches {
+				return false
+			}
+		case ActionRename:
+			if matches && rule.match != nil {
+				metric.ID = rule.match.ReplaceAllString(metric.ID, rule.Replacement)
+			}
+		case ActionPrefix:
+			if matches {
+				metric.ID = rule.Prefix + metric.ID
+			}
+		case ActionLabel:
+			if matches {
+				labels := make(map[string]string, len(metric.Labels)+len(rule.Labels))
+				maps.Copy(labels, metric.Labels)
+				maps.Copy(labels, rule.Labels)
+				metric.Labels = labels
+			}
+		case ActionRate:
+			if matches && !r.rate(metric, now) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// rate replaces the value of the gauge by its change per second since the previous report.
+func (r *Relabeler) rate(metric *httpModels.Metric, now time.Time) bool {
+	if metric.Value == nil {
+		return false
+	}
+
+	previous, ok := r.last[metric.ID]
+	r.last[metric.ID] = sample{value: *metric.Value, time: now}
+	elapsed := now.Sub(previous.time).Seconds()
+	if !ok || elapsed <= 0 {
+		return false
+	}
+
+	rate := (*metric.Value - previous.value) / elapsed
+	metric.Value = &rate
+
+	return true
+}
@@ -0,0 +1,114 @@
+package humayagentrelabel
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+func gauge(name string, value float64) *httpModels.Metric {
+	return &httpModels.Metric{ID: name, MType: httpModels.GaugeMetric, Value: &value}
+}
+
+func counter(name string, delta int64) *httpModels.Metric {
+	return &httpModels.Metric{ID: name, MType: httpModels.CounterMetric, Delta: &delta}
+}
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   []Rule
+		metrics []*httpModels.Metric
+		want    []*httpModels.Metric
+	}{
+		{
+			name:    "no rules",
+			metrics: []*httpModels.Metric{gauge("Alloc", 1)},
+			want:    []*httpModels.Metric{gauge("Alloc", 1)},
+		},
+		{
+			name:    "drop",
+			rules:   []Rule{{Action: ActionDrop, Match: "Heap.*"}},
+			metrics: []*httpModels.Metric{gauge("HeapAlloc", 1), gauge("Alloc", 2)},
+			want:    []*httpModels.Metric{gauge("Alloc", 2)},
+		},
+		{
+			name:    "keep",
+			rules:   []Rule{{Action: ActionKeep, Match: "Alloc|PollCount"}},
+			metrics: []*httpModels.Metric{gauge("HeapAlloc", 1), gauge("Alloc", 2), counter("PollCount", 3)},
+			want:    []*httpModels.Metric{gauge("Alloc", 2), counter("PollCount", 3)},
+		},
+		{
+			name:    "rename trailing space",
+			rules:   []Rule{{Action: ActionRename, Match: `(.*?)\s+`, Replacement: "$1"}},
+			metrics: []*httpModels.Metric{gauge("TotalAlloc ", 1), gauge("Alloc", 2)},
+			want:    []*httpModels.Metric{gauge("TotalAlloc", 1), gauge("Alloc", 2)},
+		},
+		{
+			name: "prefix and labels by type",
+			rules: []Rule{
+				{Action: ActionPrefix, Type: httpModels.GaugeMetric, Prefix: "go_"},
+				{Action: ActionLabel, Labels: map[string]string{"host": "a"}},
+			},
+			metrics: []*httpModels.Metric{gauge("Alloc", 1), counter("PollCount", 2)},
+			want: []*httpModels.Metric{
+				{ID: "go_Alloc", MType: httpModels.GaugeMetric, Value: gauge("", 1).Value, Labels: map[string]string{"host": "a"}},
+				{ID: "PollCount", MType: httpModels.CounterMetric, Delta: counter("", 2).Delta, Labels: map[string]string{"host": "a"}},
+			},
+		},
+		{
+			name: "rules apply in order",
+			rules: []Rule{
+				{Action: ActionRename, Match: "Alloc", Replacement: "Allocated"},
+				{Action: ActionDrop, Match: "Alloc"},
+			},
+			metrics: []*httpModels.Metric{gauge("Alloc", 1)},
+			want:    []*httpModels.Metric{gauge("Allocated", 1)},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			relabeler, err := New(test.rules)
+			require.NoError(t, err)
+			assert.Equal(t, test.want, relabeler.Apply(test.metrics, time.Now()))
+		})
+	}
+}
+
+func TestRate(t *testing.T) {
+	relabeler, err := New([]Rule{{Action: ActionRate, Match: "TotalAlloc"}})
+	require.NoError(t, err)
+	start := time.Now()
+
+	// the first report has no previous value.
+	got := relabeler.Apply([]*httpModels.Metric{gauge("TotalAlloc", 100), gauge("Alloc", 5), counter("PollCount", 1)}, start)
+	assert.Equal(t, []*httpModels.Metric{gauge("Alloc", 5), counter("PollCount", 1)}, got)
+
+	got = relabeler.Apply([]*httpModels.Metric{gauge("TotalAlloc", 300)}, start.Add(10*time.Second))
+	assert.Equal(t, []*httpModels.Metric{gauge("TotalAlloc", 20)}, got)
+}
+
+func TestValidateRules(t *testing.T) {
+	assert.NoError(t, ValidateRules([]Rule{{Action: ActionDrop, Match: "Heap.*"}}))
+
+	err := ValidateRules([]Rule{
+		{Action: ActionDrop, Match: "("},
+		{Action: ActionRename, Match: "Alloc"},
+		{Action: ActionRate, Type: httpModels.CounterMetric},
+		{Action: "multiply"},
+		{Action: ActionRename, Replacement: "Memory"},
+	})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "relabel[0].match:")
+	assert.Contains(t, err.Error(), "relabel[1].replacement: is required by rename")
+	assert.Contains(t, err.Error(), "relabel[2].type: rate applies to gauges only")
+	assert.Contains(t, err.Error(), `relabel[3].action: unknown action "multiply"`)
+	assert.Contains(t, err.Error(), "relabel[4].match: is required by rename")
+
+	_, err = New([]Rule{{Action: "multiply"}})
+	assert.Error(t, err)
+}
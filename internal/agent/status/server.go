@@ -0,0 +1,101 @@
+package humayagentstatus
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	humayLogging "github.com/zvfkjytytw/humay/internal/common/logging"
+)
+
+const readHeaderTimeout = 5 * time.Second
+
+// Server answers probes of a supervisor or Kubernetes on the local address.
+type Server struct {
+	server *http.Server
+	logger *zap.Logger
+}
+
+func NewServer(address string, stats *Stats, logger *zap.Logger) *Server {
+	return &Server{
+		server: &http.Server{
+			Addr:              address,
+			Handler:           Handler(stats),
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+		logger: logger,
+	}
+}
+
+// Handler answers /healthz with 200 or 503, /status with the whole state
+// and /log/level with the log level, which is changed by PUT from the local host only,
+// as the listener has no authentication and may be bound to all interfaces.
+func Handler(stats *Stats) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		status := stats.Status(time.Now())
+		code := http.StatusOK
+		if !status.Healthy {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, struct {
+			Healthy bool   `json:"healthy"`
+			Reason  string `json:"reason,omitempty"`
+		}{status.Healthy, status.Reason})
+	})
+	mux.HandleFunc("/status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, stats.Status(time.Now()))
+	})
+	mux.Handle("/log/level", localWrites(humayLogging.LevelHandler()))
+
+	return mux
+}
+
+// localWrites answers 403 to requests which change the state from other hosts.
+func localWrites(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead && !isLoopback(r.RemoteAddr) {
+			writeJSON(w, http.StatusForbidden, struct {
+				Error string `json:"error"`
+			}{"changes are allowed from the local host only"})
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isLoopback(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+func writeJSON(w http.ResponseWriter, code int, body any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(body)
+}
+
+func (s *Server) Start() error {
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Sugar().Errorf("failed start status server: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
@@ -0,0 +1,166 @@
+package humayagentstatus
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+)
+
+// poll kinds of the agent.
+const (
+	PollRuntime = "runtime"
+	PollGops    = "gops"
+)
+
+type Config struct {
+	// address of the local listener with /healthz and /status, empty disables it.
+	Address string `yaml:"address,omitempty"`
+	// seconds without a successful send after which the agent is unhealthy,
+	// three report intervals by default.
+	StaleAfter humayConfig.Seconds `yaml:"stale_after,omitempty"`
+}
+
+type PollStats struct {
+	Count        int64   `json:"count"`
+	LastSeconds  float64 `json:"last_seconds"`
+	MaxSeconds   float64 `json:"max_seconds"`
+	TotalSeconds float64 `json:"total_seconds"`
+}
+
+// Status is the state of the agent answered by /status.
+type Status struct {
+	Healthy       bool                  `json:"healthy"`
+	Reason        string                `json:"reason,omitempty"`
+	Started       time.Time             `json:"started"`
+	Sends         int64                 `json:"sends"`
+	SendFailures  int64                 `json:"send_failures"`
+	Retries       int64                 `json:"retries"`
+	Rejected      int64                 `json:"rejected"`
+	LastSuccess   *time.Time            `json:"last_success,omitempty"`
+	LastError     string                `json:"last_error,omitempty"`
+	QueueDepth    int                   `json:"queue_depth"`
+	QueueCapacity int                   `json:"queue_capacity"`
+	Polls         map[string]*PollStats `json:"polls"`
+}
+
+// Stats collects the state of the agent.
+// Nil stats ignore observations, so the client works without them.
+type Stats struct {
+	started     time.Time
+	staleAfter  time.Duration
+	sends       atomic.Int64
+	failures    atomic.Int64
+	retries     atomic.Int64
+	rejected    atomic.Int64
+	lastSuccess atomic.Int64
+	mx          sync.Mutex
+	lastError   string
+	polls       map[string]*PollStats
+	queue       func() (int, int)
+}
+
+func NewStats(staleAfter time.Duration) *Stats {
+	return &Stats{
+		started:    time.Now(),
+		staleAfter: staleAfter,
+		polls:      make(map[string]*PollStats),
+	}
+}
+
+// SetQueue sets the source of the depth and the capacity of the send queue.
+func (s *Stats) SetQueue(queue func() (int, int)) {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.queue = queue
+}
+
+// ObserveSend counts the send of a batch after all its attempts.
+func (s *Stats) ObserveSend(attempts int, err error) {
+	if s == nil {
+		return
+	}
+
+	if attempts > 1 {
+		s.retries.Add(int64(attempts - 1))
+	}
+	if err != nil {
+		s.failures.Add(1)
+		s.mx.Lock()
+		s.lastError = err.Error()
+		s.mx.Unlock()
+		return
+	}
+	s.sends.Add(1)
+	s.lastSuccess.Store(time.Now().UnixNano())
+}
+
+// ObserveRejected counts metrics of the sent batches rejected by the server.
+func (s *Stats) ObserveRejected(n int) {
+	if s == nil {
+		return
+	}
+
+	s.rejected.Add(int64(n))
+}
+
+// ObservePoll counts the poll of the kind.
+func (s *Stats) ObservePoll(kind string, duration time.Duration) {
+	if s == nil {
+		return
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	poll, ok := s.polls[kind]
+	if !ok {
+		poll = &PollStats{}
+		s.polls[kind] = poll
+	}
+	seconds := duration.Seconds()
+	poll.Count++
+	poll.LastSeconds = seconds
+	poll.TotalSeconds += seconds
+	if seconds > poll.MaxSeconds {
+		poll.MaxSeconds = seconds
+	}
+}
+
+// Status returns the state at the moment.
+// The agent is unhealthy when nothing was sent successfully for the stale time.
+func (s *Stats) Status(now time.Time) *Status {
+	status := &Status{
+		Healthy:      true,
+		Started:      s.started,
+		Sends:        s.sends.Load(),
+		SendFailures: s.failures.Load(),
+		Retries:      s.retries.Load(),
+		Rejected:     s.rejected.Load(),
+		Polls:        make(map[string]*PollStats),
+	}
+
+	since := s.started
+	if last := s.lastSuccess.Load(); last != 0 {
+		lastSuccess := time.Unix(0, last)
+		status.LastSuccess = &lastSuccess
+		since = lastSuccess
+	}
+	if s.staleAfter > 0 && now.Sub(since) > s.staleAfter {
+		status.Healthy = false
+		status.Reason = "no successful send for " + now.Sub(since).Truncate(time.Second).String()
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	status.LastError = s.lastError
+	if s.queue != nil {
+		status.QueueDepth, status.QueueCapacity = s.queue()
+	}
+	for kind, poll := range s.polls {
+		copied := *poll
+		status.Polls[kind] = &copied
+	}
+
+	return status
+}
@@ -0,0 +1,97 @@
+package humayagentstatus
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStatus(t *testing.T) {
+	stats := NewStats(time.Minute)
+	stats.SetQueue(func() (int, int) { return 2, 5 })
+	stats.ObserveSend(1, nil)
+	stats.ObserveSend(3, errors.New("server is down"))
+	stats.ObserveRejected(2)
+	stats.ObservePoll(PollRuntime, time.Second)
+	stats.ObservePoll(PollRuntime, 3*time.Second)
+
+	status := stats.Status(time.Now())
+	assert.True(t, status.Healthy)
+	assert.Equal(t, int64(1), status.Sends)
+	assert.Equal(t, int64(1), status.SendFailures)
+	assert.Equal(t, int64(2), status.Retries)
+	assert.Equal(t, int64(2), status.Rejected)
+	assert.Equal(t, "server is down", status.LastError)
+	assert.Equal(t, 2, status.QueueDepth)
+	assert.Equal(t, 5, status.QueueCapacity)
+	assert.Equal(t, &PollStats{Count: 2, LastSeconds: 3, MaxSeconds: 3, TotalSeconds: 4}, status.Polls[PollRuntime])
+
+	status = stats.Status(time.Now().Add(2 * time.Minute))
+	assert.False(t, status.Healthy)
+	assert.NotEmpty(t, status.Reason)
+}
+
+func TestHandler(t *testing.T) {
+	tests := []struct {
+		name   string
+		stale  time.Duration
+		status int
+	}{
+		{name: "fresh", stale: time.Minute, status: http.StatusOK},
+		{name: "stale", stale: time.Nanosecond, status: http.StatusServiceUnavailable},
+		{name: "never stale", stale: 0, status: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats := NewStats(test.stale)
+			time.Sleep(time.Millisecond)
+			server := httptest.NewServer(Handler(stats))
+			defer server.Close()
+
+			resp, err := http.Get(server.URL + "/healthz")
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, test.status, resp.StatusCode)
+
+			resp, err = http.Get(server.URL + "/status")
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+			status := &Status{}
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(status))
+			assert.Equal(t, test.status == http.StatusOK, status.Healthy)
+		})
+	}
+}
+
+func TestLogLevelLocalOnly(t *testing.T) {
+	handler := Handler(NewStats(time.Minute))
+
+	tests := []struct {
+		name       string
+		method     string
+		remoteAddr string
+		status     int
+	}{
+		{name: "read from network", method: http.MethodGet, remoteAddr: "192.0.2.1:1234", status: http.StatusOK},
+		{name: "change from network", method: http.MethodPut, remoteAddr: "192.0.2.1:1234", status: http.StatusForbidden},
+		{name: "change from local host", method: http.MethodPut, remoteAddr: "127.0.0.1:1234", status: http.StatusOK},
+		{name: "change from local ipv6", method: http.MethodPut, remoteAddr: "[::1]:1234", status: http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(test.method, "/log/level", strings.NewReader(`{"level":"info"}`))
+			req.RemoteAddr = test.remoteAddr
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			assert.Equal(t, test.status, w.Code)
+		})
+	}
+}
@@ -4,9 +4,6 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
-
-	"go.uber.org/zap"
-	"go.uber.org/zap/zapcore"
 )
 
 func ReadConfigFile(configFile string) ([]byte, error) {
@@ -22,20 +19,3 @@ func ReadConfigFile(configFile string) ([]byte, error) {
 
 	return yamlConfig, nil
 }
-
-func InitLogger() (*zap.Logger, error) {
-	config := zap.Config{
-		Level:            zap.NewAtomicLevelAt(zapcore.InfoLevel),
-		Development:      true,
-		Encoding:         "json",
-		EncoderConfig:    zap.NewProductionEncoderConfig(),
-		OutputPaths:      []string{"stdout", "humay.log"},
-		ErrorOutputPaths: []string{"stderr", "humay.log"},
-	}
-	logger, err := config.Build()
-	if err != nil {
-		return nil, err
-	}
-
-	return logger, nil
-}
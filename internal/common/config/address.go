@@ -0,0 +1,25 @@
+package humayconfig
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+)
+
+// HostPort returns the setter of the host:port value into two fields.
+func HostPort(host *string, port *int32) func(string) error {
+	return func(value string) error {
+		h, p, err := net.SplitHostPort(value)
+		if err != nil {
+			return fmt.Errorf("invalid address %q: %v", value, err)
+		}
+		n, err := strconv.ParseUint(p, 10, 16)
+		if err != nil || n == 0 {
+			return fmt.Errorf("invalid port %q of address %q", p, value)
+		}
+		*host = h
+		*port = int32(n)
+
+		return nil
+	}
+}
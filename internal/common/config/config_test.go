@@ -0,0 +1,193 @@
+package humayconfig
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testSection struct {
+	Interval Seconds `yaml:"interval"`
+	Secret   string  `yaml:"secret" secret:"true"`
+}
+
+type testConfig struct {
+	Host    string       `yaml:"host"`
+	Port    int32        `yaml:"port"`
+	Debug   bool         `yaml:"debug"`
+	Timeout Milliseconds `yaml:"timeout"`
+	Section *testSection `yaml:"section,omitempty"`
+}
+
+func (c *testConfig) Validate() error {
+	return errors.Join(
+		Check(c.Port > 0, "port", "must be positive"),
+		Check(c.Host != "", "host", "is required"),
+	)
+}
+
+func newTestLoader(config *testConfig, env map[string]string) (*Loader, *bytes.Buffer) {
+	output := &bytes.Buffer{}
+	loader := NewLoader("test", config)
+	loader.output = output
+	loader.lookup = func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	loader.Add(
+		Var{Env: "ADDRESS", Flag: "a", Set: HostPort(&config.Host, &config.Port)},
+		Var{Path: "timeout", Env: "TIMEOUT", Flag: "t"},
+		Var{Path: "debug", Env: "DEBUG", Flag: "d"},
+		Var{Path: "section.interval", Env: "INTERVAL", Flag: "i"},
+		Var{Path: "section.secret", Env: "SECRET"},
+	)
+
+	return loader, output
+}
+
+func TestLoad(t *testing.T) {
+	file := t.TempDir() + "/config.yaml"
+	require.NoError(t, os.WriteFile(file, []byte("host: file\nport: 1000\ntimeout: 2s\nsection:\n  interval: 1m\n"), 0o600))
+
+	tests := []struct {
+		name    string
+		env     map[string]string
+		args    []string
+		want    testConfig
+		wantErr string
+	}{
+		{
+			name: "defaults",
+			want: testConfig{Host: "localhost", Port: 80, Timeout: 100},
+		},
+		{
+			name: "file over defaults",
+			args: []string{"-c", file},
+			want: testConfig{Host: "file", Port: 1000, Timeout: 2000, Section: &testSection{Interval: 60}},
+		},
+		{
+			name: "file from environment",
+			env:  map[string]string{"CONFIG": file},
+			want: testConfig{Host: "file", Port: 1000, Timeout: 2000, Section: &testSection{Interval: 60}},
+		},
+		{
+			name: "environment over file",
+			env:  map[string]string{"ADDRESS": "env:2000", "TIMEOUT": "5", "DEBUG": "true"},
+			args: []string{"-c", file},
+			want: testConfig{Host: "env", Port: 2000, Timeout: 5, Debug: true, Section: &testSection{Interval: 60}},
+		},
+		{
+			name: "flags over environment",
+			env:  map[string]string{"ADDRESS": "env:2000", "INTERVAL": "30"},
+			args: []string{"-c", file, "-a", "flag:3000", "-d", "-i", "10s"},
+			want: testConfig{Host: "flag", Port: 3000, Timeout: 2000, Debug: true, Section: &testSection{Interval: 10}},
+		},
+		{
+			name:    "invalid environment",
+			env:     map[string]string{"TIMEOUT": "soon"},
+			wantErr: "environment variable TIMEOUT",
+		},
+		{
+			name:    "invalid flag",
+			args:    []string{"-a", "localhost"},
+			wantErr: "flag -a",
+		},
+		{
+			name:    "missing file",
+			args:    []string{"-c", file + ".missing"},
+			wantErr: "config.yaml.missing",
+		},
+		{
+			name:    "validation",
+			args:    []string{"-a", ":80"},
+			wantErr: "invalid test config:\nhost: is required",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config := &testConfig{Host: "localhost", Port: 80, Timeout: 100}
+			loader, _ := newTestLoader(config, test.env)
+
+			err := loader.Load(test.args)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, *config)
+		})
+	}
+}
+
+func TestPrintConfig(t *testing.T) {
+	config := &testConfig{Host: "localhost", Port: 80}
+	loader, output := newTestLoader(config, map[string]string{"SECRET": "password"})
+
+	err := loader.Load([]string{"-print-config", "-i", "90"})
+	assert.ErrorIs(t, err, ErrPrintConfig)
+	assert.Contains(t, output.String(), "interval: 1m30s")
+	assert.Contains(t, output.String(), "secret: '******'")
+	assert.NotContains(t, output.String(), "password")
+	// the config itself keeps the secret.
+	assert.Equal(t, "password", config.Section.Secret)
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		value   string
+		unit    time.Duration
+		want    int32
+		wantErr bool
+	}{
+		{value: "10", unit: time.Second, want: 10},
+		{value: "1m30s", unit: time.Second, want: 90},
+		{value: "250ms", unit: time.Millisecond, want: 250},
+		{value: "1s", unit: time.Millisecond, want: 1000},
+		{value: "1500ms", unit: time.Second, wantErr: true},
+		{value: "-1", unit: time.Second, wantErr: true},
+		{value: "-5s", unit: time.Second, wantErr: true},
+		{value: "soon", unit: time.Second, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.value, func(t *testing.T) {
+			got, err := parseDuration(test.value, test.unit)
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestDiff(t *testing.T) {
+	old := &testConfig{Host: "localhost", Port: 80, Section: &testSection{Interval: 10}}
+
+	tests := []struct {
+		name string
+		old  *testConfig
+		new  *testConfig
+		want []string
+	}{
+		{name: "equal", new: &testConfig{Host: "localhost", Port: 80, Section: &testSection{Interval: 10}}},
+		{name: "fields", new: &testConfig{Host: "example", Port: 80, Debug: true, Section: &testSection{Interval: 10}}, want: []string{"host", "debug"}},
+		{name: "nested", new: &testConfig{Host: "localhost", Port: 80, Section: &testSection{Interval: 20}}, want: []string{"section.interval"}},
+		{name: "missing section", new: &testConfig{Host: "localhost", Port: 80}, want: []string{"section.interval"}},
+		{name: "added section", old: &testConfig{Host: "localhost", Port: 80}, new: old, want: []string{"section.interval"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if test.old == nil {
+				test.old = old
+			}
+			assert.Equal(t, test.want, Diff(test.old, test.new))
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package humayconfig
+
+import (
+	"reflect"
+)
+
+// Diff returns yaml paths of the settings which differ between two configs of the same type.
+// A missing section is equal to the section with zero values.
+func Diff(old, new any) []string {
+	var paths []string
+	diff(reflect.ValueOf(old), reflect.ValueOf(new), "", &paths)
+
+	return paths
+}
+
+func diff(old, new reflect.Value, path string, paths *[]string) {
+	old, new = deref(old), deref(new)
+	if !old.IsValid() && !new.IsValid() {
+		return
+	}
+	if !old.IsValid() {
+		old = reflect.Zero(new.Type())
+	}
+	if !new.IsValid() {
+		new = reflect.Zero(old.Type())
+	}
+	typ := old.Type()
+
+	if typ.Kind() != reflect.Struct {
+		if !reflect.DeepEqual(old.Interface(), new.Interface()) {
+			*paths = append(*paths, path)
+		}
+		return
+	}
+
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() || yamlName(field) == "-" {
+			continue
+		}
+		name := yamlName(field)
+		if path != "" {
+			name = path + "." + name
+		}
+		diff(old.Field(i), new.Field(i), name, paths)
+	}
+}
+
+// deref returns the pointed value, or the invalid value for nil.
+func deref(value reflect.Value) reflect.Value {
+	for value.IsValid() && value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return reflect.Value{}
+		}
+		value = value.Elem()
+	}
+
+	return value
+}
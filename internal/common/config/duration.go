@@ -0,0 +1,108 @@
+package humayconfig
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Seconds is a duration kept in whole seconds.
+// Files, environment and flags accept bare seconds or Go durations like "1m30s".
+type Seconds int32
+
+// Milliseconds is a duration kept in whole milliseconds.
+// Files, environment and flags accept bare milliseconds or Go durations like "250ms".
+type Milliseconds int32
+
+func (s Seconds) Duration() time.Duration {
+	return time.Duration(s) * time.Second
+}
+
+func (s Seconds) String() string {
+	return s.Duration().String()
+}
+
+// Set parses the value of the environment variable or the flag.
+func (s *Seconds) Set(value string) error {
+	n, err := parseDuration(value, time.Second)
+	if err != nil {
+		return err
+	}
+	*s = Seconds(n)
+
+	return nil
+}
+
+func (s *Seconds) UnmarshalYAML(node *yaml.Node) error {
+	return s.Set(node.Value)
+}
+
+func (s Seconds) MarshalYAML() (any, error) {
+	return s.String(), nil
+}
+
+func (m Milliseconds) Duration() time.Duration {
+	return time.Duration(m) * time.Millisecond
+}
+
+func (m Milliseconds) String() string {
+	return m.Duration().String()
+}
+
+// Set parses the value of the environment variable or the flag.
+func (m *Milliseconds) Set(value string) error {
+	n, err := parseDuration(value, time.Millisecond)
+	if err != nil {
+		return err
+	}
+	*m = Milliseconds(n)
+
+	return nil
+}
+
+func (m *Milliseconds) UnmarshalYAML(node *yaml.Node) error {
+	return m.Set(node.Value)
+}
+
+func (m Milliseconds) MarshalYAML() (any, error) {
+	return m.String(), nil
+}
+
+// parseDuration returns the number of units in the bare number or the Go duration.
+func parseDuration(value string, unit time.Duration) (int32, error) {
+	value = strings.TrimSpace(value)
+	if n, err := strconv.ParseInt(value, 10, 32); err == nil {
+		if n < 0 {
+			return 0, fmt.Errorf("negative duration %s", value)
+		}
+		return int32(n), nil
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q, expect %s count or duration like 10s", value, unitName(unit))
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("negative duration %s", value)
+	}
+	if d%unit != 0 {
+		return 0, fmt.Errorf("duration %s is not a whole number of %s", value, unitName(unit))
+	}
+	n := d / unit
+	if n > 1<<31-1 {
+		return 0, fmt.Errorf("duration %s is too long", value)
+	}
+
+	return int32(n), nil
+}
+
+func unitName(unit time.Duration) string {
+	if unit == time.Millisecond {
+		return "milliseconds"
+	}
+
+	return "seconds"
+}
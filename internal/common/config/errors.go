@@ -0,0 +1,36 @@
+package humayconfig
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Check returns the error of the field if the condition is false.
+func Check(ok bool, field, format string, args ...any) error {
+	if ok {
+		return nil
+	}
+
+	return fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...))
+}
+
+// Prefix adds the path of the section to every error of the joined errors.
+func Prefix(section string, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var errs []error
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		errs = joined.Unwrap()
+	} else {
+		errs = []error{err}
+	}
+
+	prefixed := make([]error, 0, len(errs))
+	for _, err := range errs {
+		prefixed = append(prefixed, fmt.Errorf("%s.%v", section, err))
+	}
+
+	return errors.Join(prefixed...)
+}
@@ -0,0 +1,212 @@
+package humayconfig
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+
+	humayCommon "github.com/zvfkjytytw/humay/internal/common"
+)
+
+const (
+	configFileFlag  = "c"
+	configFileEnv   = "CONFIG"
+	printConfigFlag = "print-config"
+)
+
+// ErrPrintConfig is returned by Load after the effective config is printed.
+var ErrPrintConfig = errors.New("config is printed")
+
+// Validator checks the loaded config.
+type Validator interface {
+	Validate() error
+}
+
+// Var binds the setting to the environment variable and the flag.
+type Var struct {
+	// yaml path of the field, e.g. "http_config.port".
+	Path  string
+	Env   string
+	Flag  string
+	Usage string
+	// Set replaces setting of the field at Path, e.g. to split the address into host and port.
+	Set func(value string) error
+	// Default is shown in the usage of the flag with Set.
+	Default string
+	// flag without a value, like -r.
+	Bool bool
+}
+
+// Loader fills the config by layers: defaults < YAML file < environment < flags.
+type Loader struct {
+	name   string
+	target any
+	vars   []Var
+	output io.Writer
+	lookup func(string) (string, bool)
+}
+
+// NewLoader loads into the target which already holds the defaults.
+func NewLoader(name string, target any) *Loader {
+	return &Loader{
+		name:   name,
+		target: target,
+		output: os.Stdout,
+		lookup: os.LookupEnv,
+	}
+}
+
+// Add binds settings to the environment and flags.
+func (l *Loader) Add(vars ...Var) {
+	l.vars = append(l.vars, vars...)
+}
+
+// rawValue keeps the flag value until the file and the environment are applied.
+type rawValue struct {
+	value  string
+	isBool bool
+}
+
+func (v *rawValue) String() string {
+	return v.value
+}
+
+func (v *rawValue) Set(value string) error {
+	v.value = value
+	return nil
+}
+
+func (v *rawValue) IsBoolFlag() bool {
+	return v.isBool
+}
+
+// Load parses the arguments, reads the file, applies the environment and flags and validates the result.
+func (l *Loader) Load(args []string) error {
+	fs := flag.NewFlagSet(l.name, flag.ContinueOnError)
+	configFile := fs.String(configFileFlag, "", fmt.Sprintf("YAML config file, also %s environment variable", configFileEnv))
+	printConfig := fs.Bool(printConfigFlag, false, "Print the effective config and exit")
+
+	raws := make(map[string]*rawValue, len(l.vars))
+	for _, v := range l.vars {
+		if v.Flag == "" {
+			continue
+		}
+		raw := &rawValue{isBool: v.Bool || l.isBool(v)}
+		raws[v.Flag] = raw
+		fs.Var(raw, v.Flag, l.usage(v))
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	set := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	// file
+	file := *configFile
+	if !set[configFileFlag] {
+		if value, ok := l.lookup(configFileEnv); ok {
+			file = value
+		}
+	}
+	if file != "" {
+		data, err := humayCommon.ReadConfigFile(file)
+		if err != nil {
+			return err
+		}
+		if err := yaml.Unmarshal(data, l.target); err != nil {
+			return fmt.Errorf("failed parse config file %s: %v", file, err)
+		}
+	}
+
+	// environment
+	for _, v := range l.vars {
+		if v.Env == "" {
+			continue
+		}
+		value, ok := l.lookup(v.Env)
+		if !ok {
+			continue
+		}
+		if err := l.apply(v, value); err != nil {
+			return fmt.Errorf("environment variable %s: %v", v.Env, err)
+		}
+	}
+
+	// flags
+	for _, v := range l.vars {
+		if v.Flag == "" || !set[v.Flag] {
+			continue
+		}
+		if err := l.apply(v, raws[v.Flag].value); err != nil {
+			return fmt.Errorf("flag -%s: %v", v.Flag, err)
+		}
+	}
+
+	if validator, ok := l.target.(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			return fmt.Errorf("invalid %s config:\n%v", l.name, err)
+		}
+	}
+
+	if *printConfig {
+		if err := l.Print(l.output); err != nil {
+			return err
+		}
+		return ErrPrintConfig
+	}
+
+	return nil
+}
+
+func (l *Loader) apply(v Var, value string) error {
+	if v.Set != nil {
+		return v.Set(value)
+	}
+
+	return setPath(l.target, v.Path, value)
+}
+
+func (l *Loader) isBool(v Var) bool {
+	if v.Path == "" {
+		return false
+	}
+	field, err := fieldByPath(l.target, v.Path, false)
+
+	return err == nil && field.IsValid() && isBoolField(field)
+}
+
+func (l *Loader) usage(v Var) string {
+	usage := v.Usage
+	if v.Env != "" {
+		usage = fmt.Sprintf("%s, also %s environment variable", usage, v.Env)
+	}
+
+	def := v.Default
+	if v.Set == nil && v.Path != "" {
+		if value, ok := getPath(l.target, v.Path); ok {
+			def = value
+		}
+	}
+	if def != "" {
+		usage = fmt.Sprintf("%s (default %s)", usage, def)
+	}
+
+	return usage
+}
+
+// Print writes the config as YAML with secrets hidden.
+func (l *Loader) Print(w io.Writer) error {
+	data, err := marshalRedacted(l.target)
+	if err != nil {
+		return fmt.Errorf("failed print config: %v", err)
+	}
+	_, err = w.Write(data)
+
+	return err
+}
@@ -0,0 +1,182 @@
+package humayconfig
+
+import (
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+const redacted = "******"
+
+// fieldByPath finds the field by yaml names of the path, missing sections are allocated if alloc is set.
+func fieldByPath(target any, path string, alloc bool) (reflect.Value, error) {
+	value := reflect.ValueOf(target)
+	for _, name := range strings.Split(path, ".") {
+		for value.Kind() == reflect.Pointer {
+			if value.IsNil() {
+				if !alloc {
+					return reflect.Value{}, nil
+				}
+				value.Set(reflect.New(value.Type().Elem()))
+			}
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.Struct {
+			return reflect.Value{}, fmt.Errorf("%s is not a section", path)
+		}
+
+		found := false
+		for i := 0; i < value.NumField(); i++ {
+			if yamlName(value.Type().Field(i)) == name {
+				value = value.Field(i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return reflect.Value{}, fmt.Errorf("unknown setting %s", path)
+		}
+	}
+
+	return value, nil
+}
+
+func yamlName(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if name == "" {
+		return strings.ToLower(field.Name)
+	}
+
+	return name
+}
+
+func isBoolField(field reflect.Value) bool {
+	if field.Kind() == reflect.Pointer {
+		return field.Type().Elem().Kind() == reflect.Bool
+	}
+
+	return field.Kind() == reflect.Bool
+}
+
+// setPath parses the value into the field of the path.
+func setPath(target any, path, value string) error {
+	field, err := fieldByPath(target, path, true)
+	if err != nil {
+		return err
+	}
+
+	return setValue(field, value)
+}
+
+func setValue(field reflect.Value, value string) error {
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			field.Set(reflect.New(field.Type().Elem()))
+		}
+		field = field.Elem()
+	}
+	if setter, ok := field.Addr().Interface().(flag.Value); ok {
+		return setter.Set(value)
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid unsigned integer %q", value)
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, field.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("setting of type %s can't be set from text", field.Type())
+	}
+
+	return nil
+}
+
+// getPath returns the current value of the field as text.
+func getPath(target any, path string) (string, bool) {
+	field, err := fieldByPath(target, path, false)
+	if err != nil || !field.IsValid() {
+		return "", false
+	}
+	if field.Kind() == reflect.Pointer {
+		if field.IsNil() {
+			return "", false
+		}
+		field = field.Elem()
+	}
+	if field.IsZero() {
+		return "", false
+	}
+	if stringer, ok := field.Interface().(fmt.Stringer); ok {
+		return stringer.String(), true
+	}
+
+	return fmt.Sprint(field.Interface()), true
+}
+
+// marshalRedacted writes the copy of the config with fields tagged secret:"true" hidden.
+func marshalRedacted(target any) ([]byte, error) {
+	data, err := yaml.Marshal(target)
+	if err != nil {
+		return nil, err
+	}
+
+	cp := reflect.New(reflect.TypeOf(target).Elem())
+	if err := yaml.Unmarshal(data, cp.Interface()); err != nil {
+		return nil, err
+	}
+	redact(cp)
+
+	return yaml.Marshal(cp.Interface())
+}
+
+func redact(value reflect.Value) {
+	for value.Kind() == reflect.Pointer {
+		if value.IsNil() {
+			return
+		}
+		value = value.Elem()
+	}
+	if value.Kind() != reflect.Struct {
+		return
+	}
+
+	for i := 0; i < value.NumField(); i++ {
+		field := value.Field(i)
+		if !value.Type().Field(i).IsExported() {
+			continue
+		}
+		if value.Type().Field(i).Tag.Get("secret") == "true" && field.Kind() == reflect.String {
+			if field.String() != "" {
+				field.SetString(redacted)
+			}
+			continue
+		}
+		redact(field)
+	}
+}
@@ -1,11 +1,68 @@
 package humaycommon
 
 import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
 )
 
-func Hash256(body []byte, key string) [sha256.Size]byte {
-	data := append([]byte(key), body...)
+const (
+	SignatureHeader = "HashSHA256"
+	TimestampHeader = "X-Humay-Timestamp"
+	NonceHeader     = "X-Humay-Nonce"
+	nonceSize       = 16
+)
+
+// Sign returns hex encoded HMAC-SHA256 of the parts and the body joined by new lines.
+// Without parts only the body is signed.
+func Sign(key string, body []byte, parts ...string) string {
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(signedPayload(body, parts...))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CheckSign compares the signature with the expected one in constant time.
+func CheckSign(key, sign string, body []byte, parts ...string) bool {
+	got, err := hex.DecodeString(sign)
+	if err != nil {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write(signedPayload(body, parts...))
+
+	return hmac.Equal(got, mac.Sum(nil))
+}
+
+func NewNonce() (string, error) {
+	nonce := make([]byte, nonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(nonce), nil
+}
+
+func Timestamp(t time.Time) string {
+	return strconv.FormatInt(t.Unix(), 10)
+}
+
+func signedPayload(body []byte, parts ...string) []byte {
+	if len(parts) == 0 {
+		return body
+	}
+
+	buf := &bytes.Buffer{}
+	for _, part := range parts {
+		buf.WriteString(part)
+		buf.WriteByte('\n')
+	}
+	buf.Write(body)
 
-	return sha256.Sum256(data)
+	return buf.Bytes()
 }
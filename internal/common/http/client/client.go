@@ -0,0 +1,130 @@
+// Package humayhttpclient holds the rules of requests to the server shared by the agent and pkg/client:
+// signing, checking of answers, compression and retries.
+package humayhttpclient
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sethvargo/go-retry"
+
+	humayCommon "github.com/zvfkjytytw/humay/internal/common"
+)
+
+var ErrBadSignature = errors.New("wrong response signature")
+
+// Backoff returns Fibonacci pauses from delay up to maxDelay for the number of retries.
+func Backoff(retries uint64, delay, maxDelay time.Duration) retry.Backoff {
+	return retry.WithMaxRetries(retries, retry.WithCappedDuration(maxDelay, retry.NewFibonacci(delay)))
+}
+
+// Compress returns gzip of the body.
+func Compress(body []byte) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	gz, _ := gzip.NewWriterLevel(buf, gzip.BestCompression) //nolint // the level is valid
+	if _, err := gz.Write(body); err != nil {
+		return nil, fmt.Errorf("failed compress body: %v", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed close compressor: %v", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// Sign adds timestamp, nonce and HMAC of the plain body, the method and the URI with query to the request.
+// The request is not signed with empty key. The nonce is returned to check the answer.
+func Sign(req *http.Request, key string, body []byte) (string, error) {
+	if key == "" {
+		return "", nil
+	}
+
+	nonce, err := humayCommon.NewNonce()
+	if err != nil {
+		return "", fmt.Errorf("failed generate nonce: %v", err)
+	}
+	timestamp := humayCommon.Timestamp(time.Now())
+
+	req.Header.Set(humayCommon.TimestampHeader, timestamp)
+	req.Header.Set(humayCommon.NonceHeader, nonce)
+	req.Header.Set(
+		humayCommon.SignatureHeader,
+		humayCommon.Sign(key, body, timestamp, nonce, req.Method, req.URL.RequestURI()),
+	)
+
+	return nonce, nil
+}
+
+// Verify checks that the body of the answer is signed by the server for the request with the nonce.
+func Verify(resp *http.Response, key string, body []byte, nonce string) error {
+	if key == "" {
+		return nil
+	}
+
+	if resp.Header.Get(humayCommon.NonceHeader) != nonce {
+		return fmt.Errorf("%w: signed for another request", ErrBadSignature)
+	}
+	if !humayCommon.CheckSign(
+		key,
+		resp.Header.Get(humayCommon.SignatureHeader),
+		body,
+		resp.Header.Get(humayCommon.TimestampHeader),
+		nonce,
+	) {
+		return ErrBadSignature
+	}
+
+	return nil
+}
+
+// RetryableSend marks the error of the request which never reached the server as retryable.
+// Other errors may come after the server saved the metrics, sending them again would count counters twice.
+func RetryableSend(err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" {
+		return retry.RetryableError(err)
+	}
+
+	return err
+}
+
+// RetryableStatus marks the error of the overloaded server as retryable, the server saved nothing then.
+// If the server asks to wait by Retry-After, the pause up to maxWait is done before the next attempt.
+func RetryableStatus(ctx context.Context, resp *http.Response, err error, maxWait time.Duration) error {
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode != http.StatusServiceUnavailable {
+		return err
+	}
+
+	wait := RetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if wait > maxWait {
+		wait = maxWait
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+
+	return retry.RetryableError(err)
+}
+
+// RetryAfter parses Retry-After with seconds or HTTP date.
+func RetryAfter(value string, now time.Time) time.Duration {
+	if seconds, err := strconv.Atoi(value); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if date, err := http.ParseTime(value); err == nil && date.After(now) {
+		return date.Sub(now)
+	}
+
+	return 0
+}
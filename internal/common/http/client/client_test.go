@@ -0,0 +1,59 @@
+package humayhttpclient
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	humayCommon "github.com/zvfkjytytw/humay/internal/common"
+)
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name  string
+		value string
+		want  time.Duration
+	}{
+		{name: "empty"},
+		{name: "seconds", value: "3", want: 3 * time.Second},
+		{name: "date", value: now.Add(time.Minute).Format(http.TimeFormat), want: time.Minute},
+		{name: "past date", value: now.Add(-time.Minute).Format(http.TimeFormat)},
+		{name: "garbage", value: "soon"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, RetryAfter(test.value, now))
+		})
+	}
+}
+
+func TestSignVerify(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/updates?x=1", nil)
+	nonce, err := Sign(req, "key", []byte("body"))
+	require.NoError(t, err)
+	assert.True(t, humayCommon.CheckSign(
+		"key",
+		req.Header.Get(humayCommon.SignatureHeader),
+		[]byte("body"),
+		req.Header.Get(humayCommon.TimestampHeader),
+		nonce,
+		http.MethodPost,
+		"/updates?x=1",
+	))
+
+	resp := &http.Response{Header: http.Header{}}
+	timestamp := humayCommon.Timestamp(time.Now())
+	resp.Header.Set(humayCommon.TimestampHeader, timestamp)
+	resp.Header.Set(humayCommon.NonceHeader, nonce)
+	resp.Header.Set(humayCommon.SignatureHeader, humayCommon.Sign("key", []byte("answer"), timestamp, nonce))
+	assert.NoError(t, Verify(resp, "key", []byte("answer"), nonce))
+	assert.ErrorIs(t, Verify(resp, "key", []byte("forged"), nonce), ErrBadSignature)
+	assert.ErrorIs(t, Verify(resp, "key", []byte("answer"), "other"), ErrBadSignature)
+	assert.NoError(t, Verify(resp, "", []byte("forged"), nonce))
+}
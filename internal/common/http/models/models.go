@@ -5,7 +5,13 @@ const (
 	GaugeMetric    = "gauge"
 	UpdateHandler  = "/update"
 	ValueHandler   = "/value"
+	ValuesHandler  = "/values"
 	UpdatesHandler = "/updates"
+	AdminHandler   = "/admin"
+	StreamHandler  = "/stream"
+	HealthzHandler = "/healthz"
+	ReadyzHandler  = "/readyz"
+	AgentHeader    = "X-Humay-Agent"
 )
 
 var (
@@ -17,4 +23,35 @@ type Metric struct {
 	MType string   `json:"type"`            // параметр, принимающий значение gauge или counter
 	Delta *int64   `json:"delta,omitempty"` // значение метрики в случае передачи counter
 	Value *float64 `json:"value,omitempty"` // значение метрики в случае передачи gauge
+	// labels are kept in the history of the server, the storage keeps only values.
+	Labels map[string]string `json:"labels,omitempty"`
+}
+
+// error codes of the API.
+const (
+	CodeBadRequest       = "bad_request"
+	CodeInvalidMetric    = "invalid_metric"
+	CodeNotFound         = "not_found"
+	CodeMethodNotAllowed = "method_not_allowed"
+	CodeNotAcceptable    = "not_acceptable"
+	CodeUnauthorized     = "unauthorized"
+	CodeForbidden        = "forbidden"
+	CodeTooLarge         = "too_large"
+	CodeRateLimited      = "rate_limited"
+	CodeInternal         = "internal"
+	CodeUnavailable      = "unavailable"
+)
+
+// Error is the body of every failed response.
+type Error struct {
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	MetricID string `json:"metric_id,omitempty"`
+}
+
+// MetricResult is the result of one metric of the batch update.
+// The metric holds the stored value if it is saved.
+type MetricResult struct {
+	Metric
+	Error *Error `json:"error,omitempty"`
 }
@@ -0,0 +1,209 @@
+package humaylogging
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+)
+
+const (
+	FormatJSON    = "json"
+	FormatConsole = "console"
+	Stdout        = "stdout"
+	Stderr        = "stderr"
+	defaultFile   = "humay.log"
+)
+
+// level is shared by the loggers of the process, so it can be changed without restart.
+var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+
+type Config struct {
+	// debug, info, warn or error, info by default.
+	Level string `yaml:"level,omitempty" json:"level,omitempty"`
+	// json or console, json by default.
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+	// stacktraces from warnings and panics on DPanic.
+	Development bool `yaml:"development,omitempty" json:"development,omitempty"`
+	// stdout, stderr or file paths, stdout and humay.log by default.
+	Outputs []string `yaml:"outputs,omitempty" json:"outputs,omitempty"`
+	// outputs of the HTTP server log with the access log, the main outputs by default.
+	AccessOutputs []string `yaml:"access_outputs,omitempty" json:"access_outputs,omitempty"`
+	// rotation of the output files, files grow without limit by default.
+	Rotation *Rotation `yaml:"rotation,omitempty" json:"rotation,omitempty"`
+	// sampling of repeated messages, everything is written by default.
+	Sampling *Sampling `yaml:"sampling,omitempty" json:"sampling,omitempty"`
+}
+
+type Rotation struct {
+	// megabytes of the file before it is rotated, 100 by default.
+	MaxSize int `yaml:"max_size,omitempty" json:"max_size,omitempty"`
+	// days to keep rotated files, forever by default.
+	MaxAge int `yaml:"max_age,omitempty" json:"max_age,omitempty"`
+	// number of rotated files to keep, all by default.
+	MaxBackups int `yaml:"max_backups,omitempty" json:"max_backups,omitempty"`
+	// gzip rotated files.
+	Compress bool `yaml:"compress,omitempty" json:"compress,omitempty"`
+}
+
+type Sampling struct {
+	// messages with the same level and text written every tick.
+	Initial int `yaml:"initial" json:"initial"`
+	// then every n-th of them is written.
+	Thereafter int `yaml:"thereafter" json:"thereafter"`
+	// one second by default.
+	Tick humayConfig.Milliseconds `yaml:"tick,omitempty" json:"tick,omitempty"`
+}
+
+// Validate checks the level, the format and the limits.
+func (c *Config) Validate() error {
+	_, err := parseLevel(c.Level)
+	errs := []error{
+		humayConfig.Check(err == nil, "level", "unknown level %q", c.Level),
+		humayConfig.Check(c.Format == "" || c.Format == FormatJSON || c.Format == FormatConsole, "format", "unknown format %q, expect json or console", c.Format),
+	}
+	for _, output := range append(c.Outputs, c.AccessOutputs...) {
+		errs = append(errs, humayConfig.Check(output != "", "outputs", "output must not be empty"))
+	}
+	if c.Rotation != nil {
+		errs = append(errs, humayConfig.Check(
+			c.Rotation.MaxSize >= 0 && c.Rotation.MaxAge >= 0 && c.Rotation.MaxBackups >= 0,
+			"rotation", "limits must not be negative",
+		))
+	}
+	if c.Sampling != nil {
+		errs = append(errs, humayConfig.Check(
+			c.Sampling.Initial >= 0 && c.Sampling.Thereafter >= 0,
+			"sampling", "counts must not be negative",
+		))
+	}
+
+	return errors.Join(errs...)
+}
+
+// New builds the logger of the config, nil config gives the defaults.
+// It sets the shared level of all loggers.
+func New(config *Config) (*zap.Logger, error) {
+	if config == nil {
+		config = &Config{}
+	}
+	if err := SetLevel(config.Level); err != nil {
+		return nil, err
+	}
+
+	outputs := config.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{Stdout, defaultFile}
+	}
+
+	return config.build(outputs)
+}
+
+// NewAccess builds the logger of the HTTP server, nil if the main logger is used.
+func NewAccess(config *Config) (*zap.Logger, error) {
+	if config == nil || len(config.AccessOutputs) == 0 {
+		return nil, nil
+	}
+
+	return config.build(config.AccessOutputs)
+}
+
+func (c *Config) build(outputs []string) (*zap.Logger, error) {
+	encoderConfig := zap.NewProductionEncoderConfig()
+	var encoder zapcore.Encoder
+	switch c.Format {
+	case "", FormatJSON:
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case FormatConsole:
+		encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		return nil, fmt.Errorf("unknown log format %q", c.Format)
+	}
+
+	syncers := make([]zapcore.WriteSyncer, 0, len(outputs))
+	for _, output := range outputs {
+		syncer, err := c.open(output)
+		if err != nil {
+			return nil, err
+		}
+		syncers = append(syncers, syncer)
+	}
+
+	var core zapcore.Core = zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(syncers...), level)
+	if c.Sampling != nil && c.Sampling.Thereafter > 0 {
+		tick := c.Sampling.Tick.Duration()
+		if tick <= 0 {
+			tick = time.Second
+		}
+		core = zapcore.NewSamplerWithOptions(core, tick, c.Sampling.Initial, c.Sampling.Thereafter)
+	}
+
+	options := []zap.Option{zap.AddCaller(), zap.ErrorOutput(zapcore.Lock(os.Stderr))}
+	if c.Development {
+		options = append(options, zap.Development(), zap.AddStacktrace(zapcore.WarnLevel))
+	} else {
+		options = append(options, zap.AddStacktrace(zapcore.ErrorLevel))
+	}
+
+	return zap.New(core, options...), nil
+}
+
+// open returns the standard stream or the file, rotated if the rotation is set.
+func (c *Config) open(output string) (zapcore.WriteSyncer, error) {
+	switch output {
+	case Stdout:
+		return zapcore.Lock(os.Stdout), nil
+	case Stderr:
+		return zapcore.Lock(os.Stderr), nil
+	}
+
+	if c.Rotation != nil {
+		return zapcore.AddSync(&lumberjack.Logger{
+			Filename:   output,
+			MaxSize:    c.Rotation.MaxSize,
+			MaxAge:     c.Rotation.MaxAge,
+			MaxBackups: c.Rotation.MaxBackups,
+			Compress:   c.Rotation.Compress,
+		}), nil
+	}
+
+	file, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed open log file %s: %v", output, err)
+	}
+
+	return zapcore.Lock(file), nil
+}
+
+// SetLevel changes the level of all loggers, empty level means info.
+func SetLevel(name string) error {
+	l, err := parseLevel(name)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(l)
+
+	return nil
+}
+
+// LevelHandler answers GET with the current level and changes it by PUT of {"level":"debug"}.
+func LevelHandler() http.Handler {
+	return level
+}
+
+func parseLevel(name string) (zapcore.Level, error) {
+	if name == "" {
+		return zapcore.InfoLevel, nil
+	}
+
+	return zapcore.ParseLevel(name)
+}
@@ -0,0 +1,91 @@
+package humaylogging
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	defer SetLevel("")
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		config *Config
+		// lines written of the info messages.
+		want     int
+		contains string
+	}{
+		{name: "json", config: &Config{}, want: 5, contains: `"msg":"message"`},
+		{name: "console", config: &Config{Format: FormatConsole}, want: 5, contains: "INFO"},
+		{name: "rotation", config: &Config{Rotation: &Rotation{MaxSize: 1, MaxBackups: 1}}, want: 5, contains: `"level":"info"`},
+		{name: "level", config: &Config{Level: "warn"}, want: 0},
+		{name: "sampling", config: &Config{Sampling: &Sampling{Initial: 2, Thereafter: 100}}, want: 2, contains: "message"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			file := dir + "/" + test.name + ".log"
+			test.config.Outputs = []string{file}
+
+			logger, err := New(test.config)
+			require.NoError(t, err)
+			for i := 0; i < 5; i++ {
+				logger.Info("message")
+			}
+			require.NoError(t, logger.Sync())
+
+			data, err := os.ReadFile(file)
+			require.NoError(t, err)
+			lines := strings.Count(string(data), "\n")
+			assert.Equal(t, test.want, lines)
+			assert.Contains(t, string(data), test.contains)
+		})
+	}
+}
+
+func TestLevelHandler(t *testing.T) {
+	defer SetLevel("")
+	file := t.TempDir() + "/humay.log"
+	logger, err := New(&Config{Outputs: []string{file}})
+	require.NoError(t, err)
+
+	w := httptest.NewRecorder()
+	LevelHandler().ServeHTTP(w, httptest.NewRequest(http.MethodPut, "/log/level", strings.NewReader(`{"level":"error"}`)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	logger.Warn("hidden")
+
+	w = httptest.NewRecorder()
+	LevelHandler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/log/level", nil))
+	assert.JSONEq(t, `{"level":"error"}`, w.Body.String())
+
+	assert.Error(t, SetLevel("verbose"))
+	require.NoError(t, SetLevel("debug"))
+	logger.Debug("shown")
+	require.NoError(t, logger.Sync())
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "hidden")
+	assert.Contains(t, string(data), "shown")
+}
+
+func TestValidate(t *testing.T) {
+	assert.NoError(t, (&Config{Level: "debug", Format: FormatConsole}).Validate())
+
+	err := (&Config{
+		Level:    "verbose",
+		Format:   "xml",
+		Rotation: &Rotation{MaxSize: -1},
+		Sampling: &Sampling{Initial: -1},
+	}).Validate()
+	require.Error(t, err)
+	for _, field := range []string{"level", "format", "rotation", "sampling"} {
+		assert.Contains(t, err.Error(), field+":")
+	}
+}
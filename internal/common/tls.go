@@ -0,0 +1,144 @@
+package humaycommon
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+// CertReloader keeps the certificate and the CA bundle loaded from files.
+// Reload replaces them without restart, new connections use the new files.
+type CertReloader struct {
+	mx       sync.RWMutex
+	certFile string
+	keyFile  string
+	caFile   string
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+}
+
+func NewCertReloader(certFile, keyFile, caFile string) (*CertReloader, error) {
+	if (certFile == "") != (keyFile == "") {
+		return nil, errors.New("both certificate and key files must be set")
+	}
+
+	r := &CertReloader{
+		certFile: certFile,
+		keyFile:  keyFile,
+		caFile:   caFile,
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Reload reads the files again. On error the previous certificates are kept.
+func (r *CertReloader) Reload() error {
+	var cert *tls.Certificate
+	if r.certFile != "" {
+		loaded, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+		if err != nil {
+			return fmt.Errorf("failed load certificate %s: %v", r.certFile, err)
+		}
+		cert = &loaded
+	}
+
+	var pool *x509.CertPool
+	if r.caFile != "" {
+		data, err := os.ReadFile(r.caFile)
+		if err != nil {
+			return fmt.Errorf("failed read CA file %s: %v", r.caFile, err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			return fmt.Errorf("no certificates in CA file %s", r.caFile)
+		}
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	r.cert = cert
+	r.pool = pool
+
+	return nil
+}
+
+func (r *CertReloader) certificate() *tls.Certificate {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	return r.cert
+}
+
+func (r *CertReloader) caPool() *x509.CertPool {
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	return r.pool
+}
+
+// ServerConfig serves the certificate and requires client certificates signed by the CA if it is set.
+func (r *CertReloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			config := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{},
+			}
+			if cert := r.certificate(); cert != nil {
+				config.Certificates = append(config.Certificates, *cert)
+			}
+			if pool := r.caPool(); pool != nil {
+				config.ClientAuth = tls.RequireAndVerifyClientCert
+				config.ClientCAs = pool
+			}
+
+			return config, nil
+		},
+	}
+}
+
+// ClientConfig verifies the server by the CA if it is set or by the system roots
+// and its name or IP address by the host, and presents the certificate if it is set.
+func (r *CertReloader) ClientConfig(host string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: host,
+		// the standard verification can't see the reloaded CA, it is done in VerifyConnection.
+		InsecureSkipVerify: true, //nolint:gosec // verified below
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server has no certificate")
+			}
+			// the server name is empty when the host is an IP address.
+			if host == "" {
+				return errors.New("server host is not set")
+			}
+
+			intermediates := x509.NewCertPool()
+			for _, cert := range cs.PeerCertificates[1:] {
+				intermediates.AddCert(cert)
+			}
+			_, err := cs.PeerCertificates[0].Verify(x509.VerifyOptions{
+				DNSName:       host,
+				Roots:         r.caPool(),
+				Intermediates: intermediates,
+			})
+
+			return err
+		},
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			if cert := r.certificate(); cert != nil {
+				return cert, nil
+			}
+
+			return &tls.Certificate{}, nil
+		},
+	}
+}
@@ -0,0 +1,149 @@
+package humaycommon
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newTestCA(t *testing.T, dir, name string) *testCA {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+
+	return &testCA{cert: cert, key: key}
+}
+
+// issue writes certificate and key signed by the CA to <name>.pem and <name>-key.pem,
+// the certificate is for 127.0.0.1 if hosts are not set.
+func (ca *testCA) issue(t *testing.T, dir, name string, usage x509.ExtKeyUsage, hosts ...string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+	}
+	if len(hosts) == 0 {
+		hosts = []string{"127.0.0.1"}
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, name+".pem"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, name+"-key.pem"), "EC PRIVATE KEY", keyDER)
+}
+
+func writePEM(t *testing.T, file, blockType string, der []byte) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(file, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+}
+
+func TestCertReloaderMutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	file := func(name string) string { return filepath.Join(dir, name) }
+
+	ca := newTestCA(t, dir, "ca")
+	ca.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	ca.issue(t, dir, "agent", x509.ExtKeyUsageClientAuth)
+	newTestCA(t, dir, "other")
+
+	serverTLS, err := NewCertReloader(file("server.pem"), file("server-key.pem"), file("ca.pem"))
+	require.NoError(t, err)
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	server.TLS = serverTLS.ServerConfig()
+	server.StartTLS()
+	defer server.Close()
+
+	get := func(reloader *CertReloader) error {
+		client := &http.Client{Transport: &http.Transport{TLSClientConfig: reloader.ClientConfig("127.0.0.1")}}
+		resp, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		return nil
+	}
+
+	agentTLS, err := NewCertReloader(file("agent.pem"), file("agent-key.pem"), file("ca.pem"))
+	require.NoError(t, err)
+	assert.NoError(t, get(agentTLS))
+
+	noCert, err := NewCertReloader("", "", file("ca.pem"))
+	require.NoError(t, err)
+	assert.Error(t, get(noCert), "server must require client certificate")
+
+	otherCA, err := NewCertReloader(file("agent.pem"), file("agent-key.pem"), file("other.pem"))
+	require.NoError(t, err)
+	assert.Error(t, get(otherCA), "agent must verify server certificate")
+
+	_, err = NewCertReloader(file("agent.pem"), "", "")
+	assert.Error(t, err)
+
+	// rotate all certificates to the new CA.
+	rotated := newTestCA(t, dir, "ca")
+	rotated.issue(t, dir, "server", x509.ExtKeyUsageServerAuth)
+	rotated.issue(t, dir, "agent", x509.ExtKeyUsageClientAuth)
+	require.NoError(t, serverTLS.Reload())
+	assert.Error(t, get(agentTLS), "old agent CA must reject the new server certificate")
+
+	require.NoError(t, agentTLS.Reload())
+	assert.NoError(t, get(agentTLS))
+
+	// broken files keep the loaded certificates.
+	require.NoError(t, os.WriteFile(file("server.pem"), []byte("broken"), 0o600))
+	assert.Error(t, serverTLS.Reload())
+	assert.NoError(t, get(agentTLS))
+
+	// a trusted certificate of another host is rejected.
+	rotated.issue(t, dir, "server", x509.ExtKeyUsageServerAuth, "evil.example")
+	require.NoError(t, serverTLS.Reload())
+	assert.Error(t, get(agentTLS), "agent must verify the server address")
+}
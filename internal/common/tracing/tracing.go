@@ -0,0 +1,149 @@
+package humaytracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+)
+
+// exporters of spans.
+const (
+	ExporterNone   = ""
+	ExporterOTLP   = "otlp"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+)
+
+const instrumentation = "github.com/zvfkjytytw/humay"
+
+type Config struct {
+	// otlp, stdout or file, empty disables tracing.
+	Exporter string `yaml:"exporter,omitempty" json:"exporter,omitempty"`
+	// host:port of the OTLP/HTTP collector, OTEL_EXPORTER_OTLP_ENDPOINT by default.
+	Endpoint string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	// send spans to the collector without TLS.
+	Insecure bool `yaml:"insecure,omitempty" json:"insecure,omitempty"`
+	// file for spans of the file exporter, one JSON span per line.
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+	// part of the traces recorded if the caller did not decide, 1 by default.
+	SampleRatio float64 `yaml:"sample_ratio,omitempty" json:"sample_ratio,omitempty"`
+}
+
+// Validate checks the exporter and its settings.
+func (c *Config) Validate() error {
+	known := c.Exporter == ExporterNone || c.Exporter == ExporterOTLP || c.Exporter == ExporterStdout || c.Exporter == ExporterFile
+
+	return errors.Join(
+		humayConfig.Check(known, "exporter", "unknown exporter %q, expect otlp, stdout or file", c.Exporter),
+		humayConfig.Check(c.Exporter != ExporterFile || c.File != "", "file", "is required by the file exporter"),
+		humayConfig.Check(c.SampleRatio >= 0 && c.SampleRatio <= 1, "sample_ratio", "must be between 0 and 1, got %v", c.SampleRatio),
+	)
+}
+
+// Shutdown flushes the spans left and stops the exporter.
+type Shutdown func(ctx context.Context) error
+
+// Init sets the global tracer provider of the service and the W3C propagator.
+// Without the exporter spans are not recorded, but the trace context is still passed on.
+func Init(ctx context.Context, config *Config, service string) (Shutdown, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	if config == nil || config.Exporter == ExporterNone {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, closer, err := newExporter(ctx, config)
+	if err != nil {
+		return nil, err
+	}
+
+	ratio := config.SampleRatio
+	if ratio <= 0 {
+		ratio = 1
+	}
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))),
+		sdktrace.WithResource(resource.NewSchemaless(semconv.ServiceName(service))),
+	)
+	otel.SetTracerProvider(provider)
+
+	return func(ctx context.Context) error {
+		err := provider.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return err
+	}, nil
+}
+
+func newExporter(ctx context.Context, config *Config) (sdktrace.SpanExporter, io.Closer, error) {
+	switch config.Exporter {
+	case ExporterOTLP:
+		var options []otlptracehttp.Option
+		if config.Endpoint != "" {
+			options = append(options, otlptracehttp.WithEndpoint(config.Endpoint))
+		}
+		if config.Insecure {
+			options = append(options, otlptracehttp.WithInsecure())
+		}
+		exporter, err := otlptracehttp.New(ctx, options...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed init otlp exporter: %v", err)
+		}
+		return exporter, nil, nil
+	case ExporterStdout:
+		exporter, err := stdouttrace.New(stdouttrace.WithPrettyPrint())
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed init stdout exporter: %v", err)
+		}
+		return exporter, nil, nil
+	case ExporterFile:
+		if config.File == "" {
+			return nil, nil, errors.New("file of the file exporter is not set")
+		}
+		file, err := os.OpenFile(config.File, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed open traces file %s: %v", config.File, err)
+		}
+		exporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			file.Close()
+			return nil, nil, fmt.Errorf("failed init file exporter: %v", err)
+		}
+		return exporter, file, nil
+	}
+
+	return nil, nil, fmt.Errorf("unknown trace exporter %s", config.Exporter)
+}
+
+// Tracer returns the tracer of the global provider, so spans follow Init called later.
+func Tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+// Inject writes the trace context of ctx into the headers.
+func Inject(ctx context.Context, header propagation.HeaderCarrier) {
+	otel.GetTextMapPropagator().Inject(ctx, header)
+}
+
+// Extract reads the trace context of the headers into ctx.
+func Extract(ctx context.Context, header propagation.HeaderCarrier) context.Context {
+	return otel.GetTextMapPropagator().Extract(ctx, header)
+}
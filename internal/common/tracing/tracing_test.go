@@ -0,0 +1,46 @@
+package humaytracing
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+)
+
+func TestInit(t *testing.T) {
+	previous := otel.GetTracerProvider()
+	defer otel.SetTracerProvider(previous)
+	file := t.TempDir() + "/traces.json"
+
+	tests := []struct {
+		name    string
+		config  *Config
+		wantErr bool
+	}{
+		{name: "disabled", config: nil},
+		{name: "file", config: &Config{Exporter: ExporterFile, File: file}},
+		{name: "file without path", config: &Config{Exporter: ExporterFile}, wantErr: true},
+		{name: "unknown", config: &Config{Exporter: "zipkin"}, wantErr: true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			shutdown, err := Init(context.Background(), test.config, "test")
+			if test.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			_, span := Tracer().Start(context.Background(), "span")
+			span.End()
+			assert.NoError(t, shutdown(context.Background()))
+		})
+	}
+
+	data, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"Name":"span"`)
+}
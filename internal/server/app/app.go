@@ -2,16 +2,33 @@ package humayserver
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"fmt"
 	"os"
 	"os/signal"
+	"path/filepath"
 	"syscall"
+	"time"
 
 	"go.uber.org/zap"
 	"gopkg.in/yaml.v3"
 
 	common "github.com/zvfkjytytw/humay/internal/common"
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+	humayLogging "github.com/zvfkjytytw/humay/internal/common/logging"
+	humayTracing "github.com/zvfkjytytw/humay/internal/common/tracing"
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+	humayCache "github.com/zvfkjytytw/humay/internal/server/cache"
+	humayHealth "github.com/zvfkjytytw/humay/internal/server/health"
+	humayHistory "github.com/zvfkjytytw/humay/internal/server/history"
 	humayHTTPServer "github.com/zvfkjytytw/humay/internal/server/http"
+	humayHub "github.com/zvfkjytytw/humay/internal/server/hub"
+	humayPipeline "github.com/zvfkjytytw/humay/internal/server/pipeline"
+	humayRollup "github.com/zvfkjytytw/humay/internal/server/rollup"
 	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+	humayTelemetry "github.com/zvfkjytytw/humay/internal/server/telemetry"
+	humayWriteBuffer "github.com/zvfkjytytw/humay/internal/server/writebuffer"
 )
 
 type Service interface {
@@ -19,62 +36,285 @@ type Service interface {
 	Stop(ctx context.Context) error
 }
 
+// Reloader is a service that rereads its files on SIGHUP.
+type Reloader interface {
+	Reload() error
+}
+
 type ServerConfig struct {
-	HTTPConfig  *humayHTTPServer.HTTPConfig `yaml:"http_config" json:"http_config"`
-	SaverConfig *SaverConfig                `yaml:"saver_config" json:"saver_config"`
-	DatabaseDSN string                      `yaml:"database_dsn" json:"database_dsn"`
+	HTTPConfig        *humayHTTPServer.HTTPConfig `yaml:"http_config" json:"http_config"`
+	SaverConfig       *SaverConfig                `yaml:"saver_config" json:"saver_config"`
+	WriteBufferConfig *humayWriteBuffer.Config    `yaml:"write_buffer,omitempty" json:"write_buffer,omitempty"`
+	CacheConfig       *humayCache.Config          `yaml:"cache,omitempty" json:"cache,omitempty"`
+	HistoryConfig     *humayHistory.Config        `yaml:"history,omitempty" json:"history,omitempty"`
+	HubConfig         *humayHub.Config            `yaml:"stream,omitempty" json:"stream,omitempty"`
+	TelemetryConfig   *humayTelemetry.Config      `yaml:"telemetry,omitempty" json:"telemetry,omitempty"`
+	HealthConfig      *humayHealth.Config         `yaml:"health,omitempty" json:"health,omitempty"`
+	TracingConfig     *humayTracing.Config        `yaml:"tracing,omitempty" json:"tracing,omitempty"`
+	DatabaseDSN       string                      `yaml:"database_dsn" json:"database_dsn" secret:"true"`
+	LoggingConfig     *humayLogging.Config        `yaml:"logging,omitempty" json:"logging,omitempty"`
+	PipelineConfig    *humayPipeline.Config       `yaml:"pipeline,omitempty" json:"pipeline,omitempty"`
+	RollupConfig      *humayRollup.Config         `yaml:"rollup,omitempty" json:"rollup,omitempty"`
+}
+
+// DefaultConfig is the config before the file, the environment and flags are applied.
+func DefaultConfig() *ServerConfig {
+	return &ServerConfig{
+		HTTPConfig: &humayHTTPServer.HTTPConfig{
+			Host:         "localhost",
+			Port:         8080,
+			ReadTimeout:  5,
+			WriteTimeout: 10,
+			IdleTimeout:  20,
+			Auth:         &humayAuth.Config{},
+		},
+		SaverConfig: &SaverConfig{
+			Interval:    300,
+			StorageFile: "/tmp/metrics-db.json",
+			Restore:     true,
+		},
+		WriteBufferConfig: &humayWriteBuffer.Config{},
+		CacheConfig:       &humayCache.Config{},
+	}
+}
+
+// Validate checks all sections of the config.
+func (c *ServerConfig) Validate() error {
+	errs := []error{
+		humayConfig.Check(c.HTTPConfig != nil, "http_config", "is required"),
+		humayConfig.Check(c.SaverConfig != nil, "saver_config", "is required"),
+	}
+	if c.HTTPConfig != nil {
+		errs = append(errs, humayConfig.Prefix("http_config", c.HTTPConfig.Validate()))
+	}
+	if c.SaverConfig != nil {
+		errs = append(errs,
+			humayConfig.Check(c.SaverConfig.StorageFile != "" || c.DatabaseDSN != "", "saver_config.storage_file", "is required without database_dsn"),
+			humayConfig.Check(c.SaverConfig.Generations == nil || *c.SaverConfig.Generations >= 1, "saver_config.generations", "must be at least 1"),
+		)
+	}
+	if c.WriteBufferConfig != nil && c.WriteBufferConfig.Enabled {
+		errs = append(errs,
+			humayConfig.Check(c.WriteBufferConfig.MaxBatch >= 0, "write_buffer.max_batch", "must not be negative"),
+			humayConfig.Check(c.WriteBufferConfig.QueueSize >= 0, "write_buffer.queue_size", "must not be negative"),
+		)
+	}
+	if c.HistoryConfig != nil {
+		errs = append(errs, humayConfig.Check(c.HistoryConfig.Samples >= 0, "history.samples", "must not be negative"))
+	}
+	if c.HealthConfig != nil {
+		errs = append(errs,
+			humayConfig.Check(c.HealthConfig.MinFreeDisk >= 0, "health.min_free_disk", "must not be negative"),
+			humayConfig.Check(c.HealthConfig.CacheTTL >= 0, "health.cache_ttl", "must not be negative"),
+		)
+	}
+	if c.TracingConfig != nil {
+		errs = append(errs, humayConfig.Prefix("tracing", c.TracingConfig.Validate()))
+	}
+	if c.LoggingConfig != nil {
+		errs = append(errs, humayConfig.Prefix("logging", c.LoggingConfig.Validate()))
+	}
+	if c.PipelineConfig != nil {
+		errs = append(errs, humayConfig.Prefix("pipeline", c.PipelineConfig.Validate()))
+	}
+	if c.RollupConfig != nil {
+		errs = append(errs, humayConfig.Prefix("rollup", c.RollupConfig.Validate()))
+	}
+
+	return errors.Join(errs...)
+}
+
+// settings applied on SIGHUP, changes of others need a restart.
+var reloadable = map[string]bool{
+	"logging.level":              true,
+	"http_config.trusted_subnet": true,
 }
 
 type ServerApp struct {
 	logger   *zap.Logger
 	services []Service
+	// flushes spans on stop.
+	stopTracing humayTracing.Shutdown
+	// running config and its loader for SIGHUP.
+	config     *ServerConfig
+	load       func() (*ServerConfig, error)
+	httpServer *humayHTTPServer.HTTPServer
 }
 
 func NewApp(config *ServerConfig) (*ServerApp, error) {
 	// Init logger
-	logger, err := common.InitLogger()
+	logger, err := humayLogging.New(config.LoggingConfig)
+	if err != nil {
+		return nil, err
+	}
+	httpLogger, err := humayLogging.NewAccess(config.LoggingConfig)
+	if err != nil {
+		return nil, err
+	}
+	if httpLogger == nil {
+		httpLogger = logger
+	}
+
+	// Init tracing
+	stopTracing, err := humayTracing.Init(context.Background(), config.TracingConfig, "humay-server")
 	if err != nil {
 		return nil, err
 	}
 
 	// Init App
 	app := &ServerApp{
-		logger: logger,
+		logger:      logger,
+		stopTracing: stopTracing,
+		config:      config,
 	}
 
+	// Init metrics of the server itself
+	telemetry := humayTelemetry.NewRegistry()
+
+	// Init readiness checks
+	health := humayHealth.NewChecker(config.HealthConfig)
+
 	// Init storage
-	var storage humayHTTPServer.Storage
+	var storage humayStorage.Storage
+	var tokenStore humayAuth.TokenStore
 
-	storage, err = humayStorage.NewPGStorage(config.DatabaseDSN)
-	if err != nil {
+	pgStorage, err := humayStorage.NewPGStorage(config.DatabaseDSN)
+	if err == nil {
+		storage = pgStorage
+		tokenStore = pgStorage
+		health.Add("storage", func(ctx context.Context) error {
+			return pgStorage.CheckDBConnect()
+		})
+	} else {
 		logger.Sugar().Errorf("failed init postgres storage% %v", err)
 		memStorage := humayStorage.NewStorage(config.SaverConfig.StorageFile, config.DatabaseDSN)
+		if config.SaverConfig.Generations != nil {
+			memStorage.SetGenerations(*config.SaverConfig.Generations)
+		}
 		if config.SaverConfig.Restore {
 			err := memStorage.Restore(config.SaverConfig.StorageFile)
 			if err != nil {
 				logger.Sugar().Errorf("failed restore storage from file %s: %v", config.SaverConfig.StorageFile, err)
 			}
 		}
+		// Init write-ahead log
+		walEnabled := false
+		if config.SaverConfig.WAL {
+			err := memStorage.EnableWAL()
+			if err != nil {
+				logger.Sugar().Errorf("failed enable write-ahead log: %v", err)
+			} else {
+				walEnabled = true
+			}
+		}
+
 		// Init Saver
-		if config.SaverConfig.Interval == 0 {
+		switch {
+		case walEnabled:
+			interval := config.SaverConfig.Interval
+			if interval == 0 {
+				interval = defaultCompactInterval
+			}
+			saver := newSaver(memStorage, interval, logger)
+			saver.telemetry = telemetry
+			health.Add("snapshot", saver.check)
+			app.services = append(app.services, saver)
+		case config.SaverConfig.Interval == 0:
 			memStorage.SetAutoSave()
-		} else {
+			health.Add("snapshot", memStorage.CheckAutoSave)
+		default:
 			saver := newSaver(memStorage, config.SaverConfig.Interval, logger)
+			saver.telemetry = telemetry
+			health.Add("snapshot", saver.check)
 			app.services = append(app.services, saver)
 		}
 
+		if config.SaverConfig.StorageFile != "" {
+			health.AddDisk("disk", filepath.Dir(config.SaverConfig.StorageFile))
+		}
+
 		storage = memStorage
+		tokenStore = memStorage
+	}
+
+	storage = humayTelemetry.NewInstrumentedStorage(storage, telemetry)
+
+	// Init cache
+	if pgStorage != nil && config.CacheConfig != nil && config.CacheConfig.Enabled {
+		cache := humayCache.NewCache(storage, config.CacheConfig)
+		expvar.Publish("humay_cache", expvar.Func(func() any {
+			return cache.Stats()
+		}))
+		app.services = append(app.services, newInvalidator(pgStorage, cache, logger))
+		storage = cache
+	}
+
+	// Init write buffer
+	if config.WriteBufferConfig != nil && config.WriteBufferConfig.Enabled {
+		writeBuffer := humayWriteBuffer.NewWriteBuffer(storage, config.WriteBufferConfig)
+		expvar.Publish("humay_write_buffer", expvar.Func(func() any {
+			return writeBuffer.Stats()
+		}))
+		storage = writeBuffer
+	}
+
+	// Init hub of written metrics, it feeds the history and streams
+	hub := humayHub.NewHub(config.HubConfig)
+	history := humayHistory.NewHistory(config.HistoryConfig)
+	hub.Listen(func(event humayHub.Event) {
+		history.Record(&event.Metric, event.Agent, time.UnixMilli(event.Time))
+	})
+	storage = humayHub.NewPublisher(storage, hub)
+
+	// Init rollups of the written metrics, the service saves them on every rollup and on stop
+	var rollup *humayRollup.Rollup
+	if config.RollupConfig != nil && config.RollupConfig.Enabled {
+		rollup = humayRollup.NewRollup(config.RollupConfig, logger)
+		if err := rollup.Restore(); err != nil {
+			logger.Sugar().Errorf("failed restore rollups: %v", err)
+		}
+		hub.Listen(func(event humayHub.Event) {
+			rollup.Record(&event.Metric, time.UnixMilli(event.Time))
+		})
+		app.services = append(app.services, rollup)
+	}
+
+	// Init processing of written metrics
+	pipeline, err := humayPipeline.New(config.PipelineConfig)
+	if err != nil {
+		return nil, err
 	}
 
 	// Init HTTP server
-	httpServer := humayHTTPServer.NewHTTPServer(config.HTTPConfig, logger, storage)
+	httpServer, err := humayHTTPServer.NewHTTPServer(config.HTTPConfig, httpLogger, storage)
+	if err != nil {
+		return nil, err
+	}
+	httpServer.SetTokenStore(tokenStore)
+	httpServer.SetHistory(history)
+	httpServer.SetHub(hub)
+	httpServer.SetTelemetry(telemetry)
+	httpServer.SetHealth(health)
+	httpServer.SetPipeline(pipeline)
+	httpServer.SetRollup(rollup)
+	app.httpServer = httpServer
 	app.services = append(app.services, httpServer)
 
+	// Init telemetry endpoint and reporter
+	if config.TelemetryConfig != nil {
+		if config.TelemetryConfig.Address != "" {
+			app.services = append(app.services, humayTelemetry.NewServer(config.TelemetryConfig.Address, telemetry, logger))
+		}
+		if config.TelemetryConfig.StoreInterval > 0 {
+			app.services = append(app.services, humayTelemetry.NewReporter(storage, telemetry, config.TelemetryConfig.StoreInterval, logger))
+		}
+	}
+
 	return app, nil
 }
 
 func NewAppFromFile(configFile string) (*ServerApp, error) {
-	config := &ServerConfig{}
+	config := DefaultConfig()
 	configData, err := common.ReadConfigFile(configFile)
 	if err != nil {
 		return nil, err //nolint //wraped higher
@@ -85,6 +325,11 @@ func NewAppFromFile(configFile string) (*ServerApp, error) {
 		return nil, err //nolint //wraped higher
 	}
 
+	err = config.Validate()
+	if err != nil {
+		return nil, fmt.Errorf("invalid config: %v", err)
+	}
+
 	return NewApp(config)
 }
 
@@ -108,9 +353,78 @@ func (a *ServerApp) Run(ctx context.Context) {
 		}(service)
 	}
 
-	stopSignal := <-sigChanel
-	a.logger.Sugar().Debugf("Stop by %v", stopSignal)
-	a.StopAll(ctx)
+	for stopSignal := range sigChanel {
+		if stopSignal == syscall.SIGHUP {
+			a.ReloadAll()
+			continue
+		}
+
+		a.logger.Sugar().Debugf("Stop by %v", stopSignal)
+		a.StopAll(ctx)
+		return
+	}
+}
+
+// SetConfigLoader sets the loader of the config for SIGHUP.
+func (a *ServerApp) SetConfigLoader(load func() (*ServerConfig, error)) {
+	a.load = load
+}
+
+func (a *ServerApp) ReloadAll() {
+	for _, service := range a.services {
+		if reloader, ok := service.(Reloader); ok {
+			if err := reloader.Reload(); err != nil {
+				a.logger.Sugar().Errorf("reload failed: %v", err)
+			}
+		}
+	}
+	a.reloadConfig()
+	a.logger.Info("reloaded")
+}
+
+// reloadConfig applies the safe changes of the config and logs the others.
+func (a *ServerApp) reloadConfig() {
+	if a.load == nil {
+		return
+	}
+
+	config, err := a.load()
+	if err != nil {
+		a.logger.Sugar().Errorf("failed reload config, the current one is kept: %v", err)
+		return
+	}
+
+	for _, path := range humayConfig.Diff(a.config, config) {
+		if !reloadable[path] {
+			a.logger.Sugar().Warnf("changed %s is applied after restart", path)
+			continue
+		}
+
+		switch path {
+		case "logging.level":
+			var level string
+			if config.LoggingConfig != nil {
+				level = config.LoggingConfig.Level
+			}
+			err = humayLogging.SetLevel(level)
+			if err == nil {
+				if a.config.LoggingConfig == nil {
+					a.config.LoggingConfig = &humayLogging.Config{}
+				}
+				a.config.LoggingConfig.Level = level
+			}
+		case "http_config.trusted_subnet":
+			err = a.httpServer.SetTrustedSubnet(config.HTTPConfig.TrustedSubnet)
+			if err == nil {
+				a.config.HTTPConfig.TrustedSubnet = config.HTTPConfig.TrustedSubnet
+			}
+		}
+		if err != nil {
+			a.logger.Sugar().Errorf("failed apply %s: %v", path, err)
+			continue
+		}
+		a.logger.Sugar().Infof("applied %s", path)
+	}
 }
 
 func (a *ServerApp) StopAll(ctx context.Context) {
@@ -120,4 +434,8 @@ func (a *ServerApp) StopAll(ctx context.Context) {
 			a.logger.Error("stop failed")
 		}
 	}
+
+	if err := a.stopTracing(ctx); err != nil {
+		a.logger.Sugar().Errorf("failed flush spans: %v", err)
+	}
 }
@@ -0,0 +1,73 @@
+package humayserver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	humayCache "github.com/zvfkjytytw/humay/internal/server/cache"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+const relistenTimeout = 5 * time.Second
+
+// invalidator drops cached values changed in the database by other servers.
+type invalidator struct {
+	storage *humayStorage.PGStorage
+	cache   *humayCache.Cache
+	done    chan struct{}
+	once    sync.Once
+	logger  *zap.Logger
+}
+
+func newInvalidator(
+	storage *humayStorage.PGStorage,
+	cache *humayCache.Cache,
+	logger *zap.Logger,
+) *invalidator {
+	return &invalidator{
+		storage: storage,
+		cache:   cache,
+		done:    make(chan struct{}),
+		logger:  logger,
+	}
+}
+
+func (i *invalidator) Start(ctx context.Context) error {
+	listenCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		<-i.done
+		cancel()
+	}()
+
+	for {
+		err := i.storage.Listen(listenCtx, func(change humayStorage.MetricChange) {
+			i.cache.Invalidate(change.MType, change.Name)
+		})
+		if err == nil {
+			return nil
+		}
+
+		// values changed while nobody listened are unknown.
+		i.logger.Sugar().Errorf("failed listen metric changes: %v", err)
+		i.cache.Flush()
+
+		select {
+		case <-listenCtx.Done():
+			return nil
+		case <-time.After(relistenTimeout):
+		}
+	}
+}
+
+func (i *invalidator) Stop(ctx context.Context) error {
+	i.once.Do(
+		func() {
+			close(i.done)
+		},
+	)
+	return nil
+}
@@ -2,31 +2,44 @@ package humayserver
 
 import (
 	"context"
+	"fmt"
 	"sync"
 	"time"
 
 	"go.uber.org/zap"
 
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
 	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+	humayTelemetry "github.com/zvfkjytytw/humay/internal/server/telemetry"
 )
 
 type SaverConfig struct {
-	Interval    int32  `yaml:"interval,omitempty" json:"interval,omitempty"`
-	StorageFile string `yaml:"storage_file" json:"storage_file"`
-	Restore     bool   `yaml:"restore,omitempty" json:"restore,omitempty"`
+	Interval    humayConfig.Seconds `yaml:"interval,omitempty" json:"interval,omitempty"`
+	StorageFile string              `yaml:"storage_file" json:"storage_file"`
+	Restore     bool                `yaml:"restore,omitempty" json:"restore,omitempty"`
+	Generations *int                `yaml:"generations,omitempty" json:"generations,omitempty"`
+	WAL         bool                `yaml:"wal,omitempty" json:"wal,omitempty"`
 }
 
+// interval for compacting the write-ahead log when store interval is not set.
+const defaultCompactInterval = 300
+
 type saver struct {
 	storage  *humayStorage.MemStorage
-	interval int32
-	done     chan struct{}
-	once     sync.Once
-	logger   *zap.Logger
+	interval humayConfig.Seconds
+	// durations of the saves, may be nil.
+	telemetry *humayTelemetry.Registry
+	// result of the last save for the readiness check.
+	mx      sync.Mutex
+	lastErr error
+	done    chan struct{}
+	once    sync.Once
+	logger  *zap.Logger
 }
 
 func newSaver(
 	storage *humayStorage.MemStorage,
-	interval int32,
+	interval humayConfig.Seconds,
 	logger *zap.Logger,
 ) *saver {
 	return &saver{
@@ -38,13 +51,18 @@ func newSaver(
 }
 
 func (s *saver) Start(ctx context.Context) error {
-	saveTicker := time.NewTicker(time.Duration(s.interval) * time.Second)
+	saveTicker := time.NewTicker(s.interval.Duration())
 	defer saveTicker.Stop()
 
 	for {
 		select {
 		case <-saveTicker.C:
+			start := time.Now()
 			err := s.storage.Save()
+			s.telemetry.ObserveSnapshot(time.Since(start), err)
+			s.mx.Lock()
+			s.lastErr = err
+			s.mx.Unlock()
 			if err != nil {
 				s.logger.Sugar().Errorf("failed save data: %v", err)
 			} else {
@@ -56,6 +74,17 @@ func (s *saver) Start(ctx context.Context) error {
 	}
 }
 
+// check fails while the last save failed.
+func (s *saver) check(ctx context.Context) error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.lastErr != nil {
+		return fmt.Errorf("last save failed: %v", s.lastErr)
+	}
+
+	return nil
+}
+
 func (s *saver) Stop(ctx context.Context) error {
 	s.once.Do(
 		func() {
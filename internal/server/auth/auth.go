@@ -0,0 +1,149 @@
+package humayauth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// ScopeWrite allows to update metrics, used by agents.
+	ScopeWrite = "write"
+	// ScopeRead allows to read metrics, used by dashboards.
+	ScopeRead = "read"
+	// ScopeAdmin allows everything including snapshots, resets and token management.
+	ScopeAdmin = "admin"
+	// AdminIdentity is the identity of the bootstrap admin token from the config.
+	AdminIdentity = "admin"
+	idSize        = 8
+	secretSize    = 24
+)
+
+var (
+	Scopes = []string{ScopeWrite, ScopeRead, ScopeAdmin}
+
+	ErrTokenNotFound = errors.New("token not found")
+	ErrInvalidToken  = errors.New("invalid token")
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// static token with admin scope to issue the first tokens.
+	AdminToken string `yaml:"admin_token,omitempty" json:"admin_token,omitempty" secret:"true"`
+}
+
+// Token is a stored credential. Only the hash of the secret is kept.
+type Token struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Scopes     []string  `json:"scopes"`
+	SecretHash string    `json:"secret_hash,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// Allows reports whether the token has the scope. Admin has every scope.
+func (t *Token) Allows(scope string) bool {
+	return slices.Contains(t.Scopes, ScopeAdmin) || slices.Contains(t.Scopes, scope)
+}
+
+type TokenStore interface {
+	CreateToken(token *Token) error
+	GetToken(id string) (*Token, error)
+	ListTokens() ([]*Token, error)
+	DeleteToken(id string) error
+}
+
+// NewToken generates the token and returns it with the secret to give out once.
+// The secret looks like `<id>.<random>`.
+func NewToken(name string, scopes []string) (*Token, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", errors.New("empty token scopes")
+	}
+	for _, scope := range scopes {
+		if !slices.Contains(Scopes, scope) {
+			return nil, "", fmt.Errorf("unknown scope %s", scope)
+		}
+	}
+
+	id, err := randomHex(idSize)
+	if err != nil {
+		return nil, "", err
+	}
+	random, err := randomHex(secretSize)
+	if err != nil {
+		return nil, "", err
+	}
+
+	token := &Token{
+		ID:         id,
+		Name:       name,
+		Scopes:     scopes,
+		SecretHash: hashSecret(random),
+		CreatedAt:  time.Now().UTC().Truncate(time.Second),
+	}
+
+	return token, id + "." + random, nil
+}
+
+// Authenticator checks bearer tokens against the store and the bootstrap admin token.
+type Authenticator struct {
+	store      TokenStore
+	adminToken string
+}
+
+func NewAuthenticator(store TokenStore, adminToken string) *Authenticator {
+	return &Authenticator{
+		store:      store,
+		adminToken: adminToken,
+	}
+}
+
+func (a *Authenticator) Store() TokenStore {
+	return a.store
+}
+
+// Authenticate returns the token the secret belongs to.
+func (a *Authenticator) Authenticate(secret string) (*Token, error) {
+	if a.adminToken != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(a.adminToken)) == 1 {
+		return &Token{ID: AdminIdentity, Name: AdminIdentity, Scopes: []string{ScopeAdmin}}, nil
+	}
+
+	id, random, ok := strings.Cut(secret, ".")
+	if !ok || id == "" || random == "" || a.store == nil {
+		return nil, ErrInvalidToken
+	}
+
+	token, err := a.store.GetToken(id)
+	if errors.Is(err, ErrTokenNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashSecret(random)), []byte(token.SecretHash)) != 1 {
+		return nil, ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(size int) (string, error) {
+	buf := make([]byte, size)
+	if _, err := rand.Read(buf); err != nil {
+		return "", fmt.Errorf("failed generate token: %v", err)
+	}
+
+	return hex.EncodeToString(buf), nil
+}
@@ -0,0 +1,59 @@
+package humayauth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mapStore map[string]*Token
+
+func (m mapStore) CreateToken(token *Token) error { m[token.ID] = token; return nil }
+func (m mapStore) ListTokens() ([]*Token, error)  { return nil, nil }
+func (m mapStore) DeleteToken(id string) error    { delete(m, id); return nil }
+func (m mapStore) GetToken(id string) (*Token, error) {
+	token, ok := m[id]
+	if !ok {
+		return nil, ErrTokenNotFound
+	}
+	return token, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	store := mapStore{}
+	token, secret, err := NewToken("agent", []string{ScopeWrite})
+	assert.NoError(t, err)
+	assert.NotContains(t, token.SecretHash, secret)
+	assert.NoError(t, store.CreateToken(token))
+
+	_, _, err = NewToken("agent", nil)
+	assert.Error(t, err)
+
+	authenticator := NewAuthenticator(store, "bootstrap")
+	tests := []struct {
+		name   string
+		secret string
+		id     string
+		err    error
+	}{
+		{name: "issued token", secret: secret, id: token.ID},
+		{name: "admin token", secret: "bootstrap", id: AdminIdentity},
+		{name: "wrong secret", secret: token.ID + ".00", err: ErrInvalidToken},
+		{name: "unknown id", secret: "00." + secret, err: ErrInvalidToken},
+		{name: "not a token", secret: "garbage", err: ErrInvalidToken},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			found, err := authenticator.Authenticate(test.secret)
+			assert.ErrorIs(t, err, test.err)
+			if test.err == nil {
+				assert.Equal(t, test.id, found.ID)
+			}
+		})
+	}
+
+	assert.True(t, token.Allows(ScopeWrite))
+	assert.False(t, token.Allows(ScopeRead))
+	assert.True(t, (&Token{Scopes: []string{ScopeAdmin}}).Allows(ScopeRead))
+}
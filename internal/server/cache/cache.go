@@ -0,0 +1,203 @@
+package humaycache
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// seconds to keep a value, 0 keeps it until invalidation.
+	TTL humayConfig.Seconds `yaml:"ttl,omitempty" json:"ttl,omitempty"`
+}
+
+type Stats struct {
+	Gauges        int   `json:"gauges"`
+	Counters      int   `json:"counters"`
+	Hits          int64 `json:"hits"`
+	Misses        int64 `json:"misses"`
+	Invalidations int64 `json:"invalidations"`
+}
+
+type entry[T int64 | float64] struct {
+	value   T
+	expires time.Time
+}
+
+// Cache keeps the latest metric values in memory in front of the storage.
+// Gauges are updated on write, counters are dropped on write because
+// the stored sum can be changed by other servers at the same time.
+type Cache struct {
+	humayStorage.Storage
+	mx       sync.RWMutex
+	ttl      time.Duration
+	version  uint64
+	gauges   map[string]entry[float64]
+	counters map[string]entry[int64]
+
+	hits          atomic.Int64
+	misses        atomic.Int64
+	invalidations atomic.Int64
+}
+
+func NewCache(storage humayStorage.Storage, config *Config) *Cache {
+	return &Cache{
+		Storage:  storage,
+		ttl:      time.Duration(config.TTL) * time.Second,
+		gauges:   make(map[string]entry[float64]),
+		counters: make(map[string]entry[int64]),
+	}
+}
+
+func (c *Cache) GetGaugeMetric(name string) (float64, error) {
+	value, version, ok := lookup(c, c.gauges, name)
+	if ok {
+		return value, nil
+	}
+
+	value, err := c.Storage.GetGaugeMetric(name)
+	if err != nil {
+		return value, err
+	}
+	store(c, c.gauges, name, value, version)
+
+	return value, nil
+}
+
+func (c *Cache) GetCounterMetric(name string) (int64, error) {
+	value, version, ok := lookup(c, c.counters, name)
+	if ok {
+		return value, nil
+	}
+
+	value, err := c.Storage.GetCounterMetric(name)
+	if err != nil {
+		return value, err
+	}
+	store(c, c.counters, name, value, version)
+
+	return value, nil
+}
+
+func (c *Cache) PutGaugeMetric(name string, value float64) error {
+	return c.PutGaugeMetrics(map[string]float64{name: value})
+}
+
+func (c *Cache) PutGaugeMetrics(metrics map[string]float64) error {
+	err := c.Storage.PutGaugeMetrics(metrics)
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.version++
+	for name, value := range metrics {
+		if err != nil {
+			delete(c.gauges, name)
+			continue
+		}
+		c.gauges[name] = entry[float64]{value: value, expires: c.expires()}
+	}
+
+	return err
+}
+
+func (c *Cache) PutCounterMetric(name string, value int64) error {
+	return c.PutCounterMetrics(map[string]int64{name: value})
+}
+
+func (c *Cache) PutCounterMetrics(metrics map[string]int64) error {
+	err := c.Storage.PutCounterMetrics(metrics)
+
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.version++
+	for name := range metrics {
+		delete(c.counters, name)
+	}
+
+	return err
+}
+
+func (c *Cache) ReplaceMetrics(gauges map[string]float64, counters map[string]int64) error {
+	defer c.Flush()
+
+	return c.Storage.ReplaceMetrics(gauges, counters)
+}
+
+// Invalidate drops the cached value of the metric.
+// Empty name drops all metrics of the type, empty type drops everything.
+func (c *Cache) Invalidate(mType, name string) {
+	c.invalidations.Add(1)
+	c.mx.Lock()
+	defer c.mx.Unlock()
+	c.version++
+
+	switch {
+	case mType == httpModels.GaugeMetric && name != "":
+		delete(c.gauges, name)
+	case mType == httpModels.GaugeMetric:
+		clear(c.gauges)
+	case mType == httpModels.CounterMetric && name != "":
+		delete(c.counters, name)
+	case mType == httpModels.CounterMetric:
+		clear(c.counters)
+	default:
+		clear(c.gauges)
+		clear(c.counters)
+	}
+}
+
+func (c *Cache) Flush() {
+	c.Invalidate("", "")
+}
+
+func (c *Cache) Stats() Stats {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	return Stats{
+		Gauges:        len(c.gauges),
+		Counters:      len(c.counters),
+		Hits:          c.hits.Load(),
+		Misses:        c.misses.Load(),
+		Invalidations: c.invalidations.Load(),
+	}
+}
+
+func (c *Cache) expires() time.Time {
+	if c.ttl == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(c.ttl)
+}
+
+// lookup returns the cached value or the cache version to store the value read from the storage.
+func lookup[T int64 | float64](c *Cache, values map[string]entry[T], name string) (T, uint64, bool) {
+	c.mx.RLock()
+	defer c.mx.RUnlock()
+
+	e, ok := values[name]
+	if ok && (e.expires.IsZero() || time.Now().Before(e.expires)) {
+		c.hits.Add(1)
+		return e.value, c.version, true
+	}
+	c.misses.Add(1)
+
+	return 0, c.version, false
+}
+
+// store keeps the value only if nothing was written or invalidated since it was read.
+func store[T int64 | float64](c *Cache, values map[string]entry[T], name string, value T, version uint64) {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if c.version != version {
+		return
+	}
+	values[name] = entry[T]{value: value, expires: c.expires()}
+}
@@ -0,0 +1,76 @@
+package humaycache
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+type countingStorage struct {
+	*humayStorage.MemStorage
+	reads int
+}
+
+func (s *countingStorage) GetGaugeMetric(name string) (float64, error) {
+	s.reads++
+	return s.MemStorage.GetGaugeMetric(name)
+}
+
+func (s *countingStorage) GetCounterMetric(name string) (int64, error) {
+	s.reads++
+	return s.MemStorage.GetCounterMetric(name)
+}
+
+func TestCache(t *testing.T) {
+	storage := &countingStorage{MemStorage: humayStorage.NewStorage("", "")}
+	cache := NewCache(storage, &Config{Enabled: true})
+
+	// gauges are cached on write.
+	assert.NoError(t, cache.PutGaugeMetric("Alloc", 1))
+	value, err := cache.GetGaugeMetric("Alloc")
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), value)
+	assert.Equal(t, 0, storage.reads)
+
+	// counters are read once after write.
+	assert.NoError(t, cache.PutCounterMetric("PollCount", 2))
+	for range 3 {
+		delta, err := cache.GetCounterMetric("PollCount")
+		assert.NoError(t, err)
+		assert.Equal(t, int64(2), delta)
+	}
+	assert.Equal(t, 1, storage.reads)
+
+	// another server changed the counter.
+	assert.NoError(t, storage.PutCounterMetric("PollCount", 3))
+	cache.Invalidate("counter", "PollCount")
+	delta, err := cache.GetCounterMetric("PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), delta)
+	assert.Equal(t, 2, storage.reads)
+
+	// unknown metrics are not cached.
+	_, err = cache.GetGaugeMetric("unknown")
+	assert.Error(t, err)
+	_, err = cache.GetGaugeMetric("unknown")
+	assert.Error(t, err)
+	assert.Equal(t, 4, storage.reads)
+
+	cache.Flush()
+	assert.Equal(t, Stats{Hits: 3, Misses: 4, Invalidations: 2}, cache.Stats())
+}
+
+func TestCacheVersionRace(t *testing.T) {
+	storage := &countingStorage{MemStorage: humayStorage.NewStorage("", "")}
+	cache := NewCache(storage, &Config{Enabled: true})
+	assert.NoError(t, storage.PutGaugeMetric("Alloc", 1))
+
+	// the value read before invalidation must not be cached.
+	_, version, ok := lookup(cache, cache.gauges, "Alloc")
+	assert.False(t, ok)
+	cache.Invalidate("gauge", "Alloc")
+	store(cache, cache.gauges, "Alloc", 1, version)
+	assert.Empty(t, cache.gauges)
+}
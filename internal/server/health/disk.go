@@ -0,0 +1,29 @@
+package humayhealth
+
+import (
+	"context"
+	"fmt"
+	"os"
+)
+
+// DiskSpace checks that the directory is writable and has at least minFree bytes.
+func DiskSpace(dir string, minFree int64) Check {
+	return func(ctx context.Context) error {
+		file, err := os.CreateTemp(dir, ".humay-ready-*")
+		if err != nil {
+			return fmt.Errorf("directory %s is not writable: %v", dir, err)
+		}
+		file.Close()
+		os.Remove(file.Name())
+
+		free, err := freeSpace(dir)
+		if err != nil {
+			return fmt.Errorf("failed get free space of %s: %v", dir, err)
+		}
+		if free >= 0 && free < minFree {
+			return fmt.Errorf("%d bytes free in %s, %d required", free, dir, minFree)
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin && !freebsd
+
+package humayhealth
+
+// free space is unknown, only writability is checked.
+func freeSpace(dir string) (int64, error) {
+	return -1, nil
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package humayhealth
+
+import (
+	"syscall"
+)
+
+func freeSpace(dir string) (int64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(dir, &stat); err != nil {
+		return 0, err
+	}
+
+	return int64(stat.Bavail) * int64(stat.Bsize), nil //nolint // block counts fit int64
+}
@@ -0,0 +1,173 @@
+package humayhealth
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+)
+
+const (
+	StatusOK     = "ok"
+	StatusFailed = "failed"
+
+	defaultTimeout     = 2000
+	defaultCacheTTL    = 1000
+	defaultMinFreeDisk = 16 << 20
+)
+
+type Config struct {
+	// milliseconds for all readiness checks.
+	Timeout humayConfig.Milliseconds `yaml:"timeout,omitempty" json:"timeout,omitempty"`
+	// bytes which must stay free on the disk of the storage file.
+	MinFreeDisk int64 `yaml:"min_free_disk,omitempty" json:"min_free_disk,omitempty"`
+	// milliseconds while the last report is answered without running the checks again.
+	CacheTTL humayConfig.Milliseconds `yaml:"cache_ttl,omitempty" json:"cache_ttl,omitempty"`
+}
+
+// Check returns the reason why the component is not ready.
+type Check func(ctx context.Context) error
+
+type Result struct {
+	Name     string  `json:"name"`
+	Status   string  `json:"status"`
+	Error    string  `json:"error,omitempty"`
+	Duration float64 `json:"duration_ms"`
+}
+
+// Report is the answer of /readyz.
+type Report struct {
+	Status string   `json:"status"`
+	Failed []string `json:"failed,omitempty"`
+	Checks []Result `json:"checks"`
+}
+
+// Checker runs the readiness checks of the components at once.
+type Checker struct {
+	mx          sync.RWMutex
+	checks      map[string]Check
+	timeout     time.Duration
+	minFreeDisk int64
+
+	cacheMx  sync.Mutex
+	cacheTTL time.Duration
+	cached   *Report
+	cachedAt time.Time
+}
+
+func NewChecker(config *Config) *Checker {
+	timeout := humayConfig.Milliseconds(defaultTimeout)
+	minFreeDisk := int64(defaultMinFreeDisk)
+	cacheTTL := humayConfig.Milliseconds(defaultCacheTTL)
+	if config != nil {
+		if config.Timeout > 0 {
+			timeout = config.Timeout
+		}
+		if config.MinFreeDisk > 0 {
+			minFreeDisk = config.MinFreeDisk
+		}
+		if config.CacheTTL > 0 {
+			cacheTTL = config.CacheTTL
+		}
+	}
+
+	return &Checker{
+		checks:      make(map[string]Check),
+		timeout:     time.Duration(timeout) * time.Millisecond,
+		minFreeDisk: minFreeDisk,
+		cacheTTL:    time.Duration(cacheTTL) * time.Millisecond,
+	}
+}
+
+// Add registers the check, the check with the same name is replaced.
+// The cached report is dropped as it misses the check.
+func (c *Checker) Add(name string, check Check) {
+	c.mx.Lock()
+	c.checks[name] = check
+	c.mx.Unlock()
+
+	c.cacheMx.Lock()
+	c.cached = nil
+	c.cacheMx.Unlock()
+}
+
+// AddDisk registers the check of free space and writability of the directory.
+func (c *Checker) AddDisk(name, dir string) {
+	c.Add(name, DiskSpace(dir, c.minFreeDisk))
+}
+
+// Cached returns the last report while it is fresh, otherwise runs the checks.
+// Concurrent callers wait for one run instead of starting their own.
+// The report is shared, so the checks are not canceled with the request which started them.
+func (c *Checker) Cached(ctx context.Context) *Report {
+	c.cacheMx.Lock()
+	defer c.cacheMx.Unlock()
+	if c.cached != nil && time.Since(c.cachedAt) < c.cacheTTL {
+		return c.cached
+	}
+
+	c.cached = c.Run(context.WithoutCancel(ctx))
+	c.cachedAt = time.Now()
+
+	return c.cached
+}
+
+// Run runs all checks, a check not finished in time fails.
+func (c *Checker) Run(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	c.mx.RLock()
+	results := make([]Result, 0, len(c.checks))
+	done := make(chan Result, len(c.checks))
+	for name, check := range c.checks {
+		go func(name string, check Check) {
+			start := time.Now()
+			result := Result{Name: name, Status: StatusOK}
+			if err := check(ctx); err != nil {
+				result.Status = StatusFailed
+				result.Error = err.Error()
+			}
+			result.Duration = float64(time.Since(start).Microseconds()) / 1000
+			done <- result
+		}(name, check)
+	}
+	pending := make(map[string]bool, len(c.checks))
+	for name := range c.checks {
+		pending[name] = true
+	}
+	c.mx.RUnlock()
+
+	for len(pending) > 0 {
+		select {
+		case result := <-done:
+			delete(pending, result.Name)
+			results = append(results, result)
+		case <-ctx.Done():
+			for name := range pending {
+				results = append(results, Result{
+					Name:     name,
+					Status:   StatusFailed,
+					Error:    "check timed out",
+					Duration: float64(c.timeout.Microseconds()) / 1000,
+				})
+			}
+			pending = nil
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		return results[i].Name < results[j].Name
+	})
+	report := &Report{Status: StatusOK, Checks: results}
+	for _, result := range results {
+		if result.Status != StatusOK {
+			report.Status = StatusFailed
+			report.Failed = append(report.Failed, result.Name)
+		}
+	}
+
+	return report
+}
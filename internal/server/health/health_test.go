@@ -0,0 +1,119 @@
+package humayhealth
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChecker(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name   string
+		checks map[string]Check
+		status string
+		failed []string
+	}{
+		{
+			name:   "no checks",
+			status: StatusOK,
+		},
+		{
+			name: "all ready",
+			checks: map[string]Check{
+				"storage": func(ctx context.Context) error { return nil },
+				"disk":    DiskSpace(dir, 1),
+			},
+			status: StatusOK,
+		},
+		{
+			name: "failed checks",
+			checks: map[string]Check{
+				"storage":  func(ctx context.Context) error { return errors.New("connection refused") },
+				"snapshot": func(ctx context.Context) error { return nil },
+				"disk":     DiskSpace(dir, math.MaxInt64),
+				"missing":  DiskSpace(dir+"/absent", 1),
+			},
+			status: StatusFailed,
+			failed: []string{"disk", "missing", "storage"},
+		},
+		{
+			name: "timeout",
+			checks: map[string]Check{
+				"storage": func(ctx context.Context) error {
+					time.Sleep(time.Second)
+					return nil
+				},
+			},
+			status: StatusFailed,
+			failed: []string{"storage"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checker := NewChecker(&Config{Timeout: 50})
+			for name, check := range test.checks {
+				checker.Add(name, check)
+			}
+
+			report := checker.Run(context.Background())
+			assert.Equal(t, test.status, report.Status)
+			assert.Equal(t, test.failed, report.Failed)
+			assert.Len(t, report.Checks, len(test.checks))
+			for _, result := range report.Checks {
+				assert.Equal(t, contains(test.failed, result.Name), result.Error != "", result.Name)
+			}
+		})
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func TestCached(t *testing.T) {
+	runs := 0
+	checker := NewChecker(&Config{CacheTTL: 50})
+	checker.Add("storage", func(ctx context.Context) error {
+		runs++
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, StatusOK, checker.Cached(context.Background()).Status)
+	}
+	assert.Equal(t, 1, runs)
+
+	time.Sleep(60 * time.Millisecond)
+	checker.Cached(context.Background())
+	assert.Equal(t, 2, runs)
+}
+
+func TestCachedCanceledProbe(t *testing.T) {
+	checker := NewChecker(&Config{Timeout: 500})
+	checker.Add("storage", func(ctx context.Context) error {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(20 * time.Millisecond):
+			return nil
+		}
+	})
+
+	// the probe which started the checks went away.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, StatusOK, checker.Cached(ctx).Status)
+	assert.Equal(t, StatusOK, checker.Cached(context.Background()).Status)
+}
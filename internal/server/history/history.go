@@ -0,0 +1,204 @@
+package humayhistory
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+const defaultSamples = 300
+
+type Config struct {
+	// number of the latest samples kept for every metric.
+	Samples int32 `yaml:"samples,omitempty" json:"samples,omitempty"`
+}
+
+// Sample is the stored value of the metric at the time in milliseconds.
+type Sample struct {
+	Time  int64   `json:"t"`
+	Value float64 `json:"v"`
+}
+
+// Series describes the metric with its last value and samples.
+type Series struct {
+	ID      string            `json:"id"`
+	MType   string            `json:"type"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Agent   string            `json:"agent,omitempty"`
+	Unit    string            `json:"unit,omitempty"`
+	Updated int64             `json:"updated"`
+	Value   float64           `json:"value"`
+	Samples []Sample          `json:"samples,omitempty"`
+}
+
+type series struct {
+	Series
+	ring  []Sample
+	next  int
+	count int
+}
+
+// History keeps the latest samples of every metric in memory.
+type History struct {
+	mx     sync.RWMutex
+	size   int
+	series map[string]*series
+}
+
+func NewHistory(config *Config) *History {
+	h := &History{
+		size:   defaultSamples,
+		series: make(map[string]*series),
+	}
+	if config != nil && config.Samples > 0 {
+		h.size = int(config.Samples)
+	}
+
+	return h
+}
+
+func key(mType, id string) string {
+	return mType + "/" + id
+}
+
+// Record adds the stored value of the metric sent by the agent.
+// Labels of the metric replace the known ones if they are set.
+func (h *History) Record(metric *httpModels.Metric, agent string, at time.Time) {
+	var value float64
+	switch {
+	case metric.Delta != nil:
+		value = float64(*metric.Delta)
+	case metric.Value != nil:
+		value = *metric.Value
+	default:
+		return
+	}
+	sample := Sample{Time: at.UnixMilli(), Value: value}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	s, ok := h.series[key(metric.MType, metric.ID)]
+	if !ok {
+		s = &series{
+			Series: Series{ID: metric.ID, MType: metric.MType},
+			ring:   make([]Sample, h.size),
+		}
+		h.series[key(metric.MType, metric.ID)] = s
+	}
+	if len(metric.Labels) > 0 {
+		s.Labels = metric.Labels
+	}
+	if agent != "" {
+		s.Agent = agent
+	}
+	s.Unit = unit(metric.ID, s.Labels)
+	s.Updated = sample.Time
+	s.Value = value
+	s.ring[s.next] = sample
+	s.next = (s.next + 1) % len(s.ring)
+	if s.count < len(s.ring) {
+		s.count++
+	}
+}
+
+// List returns all known metrics sorted by type and name with their latest samples.
+func (h *History) List(samples int) []Series {
+	h.mx.RLock()
+	list := make([]Series, 0, len(h.series))
+	for _, s := range h.series {
+		list = append(list, s.last(samples))
+	}
+	h.mx.RUnlock()
+
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].MType != list[j].MType {
+			return list[i].MType < list[j].MType
+		}
+		return list[i].ID < list[j].ID
+	})
+
+	return list
+}
+
+// Get returns the metric with all its samples.
+func (h *History) Get(mType, id string) (Series, bool) {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+
+	s, ok := h.series[key(mType, id)]
+	if !ok {
+		return Series{}, false
+	}
+
+	return s.last(len(s.ring)), true
+}
+
+// last copies the series with n latest samples from the oldest to the latest.
+func (s *series) last(n int) Series {
+	result := s.Series
+	if n > s.count {
+		n = s.count
+	}
+	if n <= 0 {
+		return result
+	}
+
+	result.Samples = make([]Sample, 0, n)
+	start := (s.next - n + len(s.ring)) % len(s.ring)
+	for i := 0; i < n; i++ {
+		result.Samples = append(result.Samples, s.ring[(start+i)%len(s.ring)])
+	}
+
+	return result
+}
+
+// known units of the metrics sent by the agent.
+var units = map[string]string{
+	"Alloc":         "bytes",
+	"TotalAlloc":    "bytes",
+	"BuckHashSys":   "bytes",
+	"GCSys":         "bytes",
+	"HeapAlloc":     "bytes",
+	"HeapIdle":      "bytes",
+	"HeapInuse":     "bytes",
+	"HeapReleased":  "bytes",
+	"HeapSys":       "bytes",
+	"MCacheInuse":   "bytes",
+	"MCacheSys":     "bytes",
+	"MSpanInuse":    "bytes",
+	"MSpanSys":      "bytes",
+	"NextGC":        "bytes",
+	"OtherSys":      "bytes",
+	"StackInuse":    "bytes",
+	"StackSys":      "bytes",
+	"Sys":           "bytes",
+	"TotalMemory":   "bytes",
+	"FreeMemory":    "bytes",
+	"Frees":         "count",
+	"HeapObjects":   "count",
+	"Lookups":       "count",
+	"Mallocs":       "count",
+	"NumForcedGC":   "count",
+	"NumGC":         "count",
+	"PollCount":     "count",
+	"GCCPUFraction": "ratio",
+	"LastGC":        "ns",
+	"PauseTotalNs":  "ns",
+}
+
+// unit of the metric is the "unit" label or is known by the name.
+func unit(id string, labels map[string]string) string {
+	if u, ok := labels["unit"]; ok {
+		return u
+	}
+	id = strings.TrimSpace(id)
+	if strings.HasPrefix(id, "CPUutilization") {
+		return "%"
+	}
+
+	return units[id]
+}
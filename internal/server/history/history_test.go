@@ -0,0 +1,51 @@
+package humayhistory
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+func gauge(name string, value float64, labels map[string]string) *httpModels.Metric {
+	return &httpModels.Metric{ID: name, MType: httpModels.GaugeMetric, Value: &value, Labels: labels}
+}
+
+func TestHistory(t *testing.T) {
+	h := NewHistory(&Config{Samples: 3})
+	start := time.UnixMilli(1000)
+
+	for i := 0; i < 5; i++ {
+		h.Record(gauge("Alloc", float64(i), nil), "agent-1", start.Add(time.Duration(i)*time.Millisecond))
+	}
+	sum := int64(7)
+	h.Record(&httpModels.Metric{ID: "PollCount", MType: httpModels.CounterMetric, Delta: &sum}, "agent-2", start)
+	h.Record(gauge("Queue", 1, map[string]string{"unit": "items", "env": "test"}), "", start)
+
+	series, ok := h.Get(httpModels.GaugeMetric, "Alloc")
+	require.True(t, ok)
+	assert.Equal(t, []Sample{{Time: 1002, Value: 2}, {Time: 1003, Value: 3}, {Time: 1004, Value: 4}}, series.Samples)
+	assert.Equal(t, "bytes", series.Unit)
+	assert.Equal(t, "agent-1", series.Agent)
+	assert.Equal(t, float64(4), series.Value)
+
+	_, ok = h.Get(httpModels.CounterMetric, "Alloc")
+	assert.False(t, ok)
+
+	list := h.List(1)
+	require.Len(t, list, 3)
+	assert.Equal(t, "PollCount", list[0].ID)
+	assert.Equal(t, "count", list[0].Unit)
+	assert.Equal(t, []Sample{{Time: 1004, Value: 4}}, list[1].Samples)
+	assert.Equal(t, "items", list[2].Unit)
+	assert.Equal(t, map[string]string{"unit": "items", "env": "test"}, list[2].Labels)
+
+	// labels are kept when the next sample comes without them.
+	h.Record(gauge("Queue", 2, nil), "", start)
+	series, _ = h.Get(httpModels.GaugeMetric, "Queue")
+	assert.Equal(t, "test", series.Labels["env"])
+	assert.Empty(t, h.List(0)[0].Samples)
+}
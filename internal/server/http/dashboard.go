@@ -0,0 +1,131 @@
+package humayhttpserver
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io/fs"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+
+	humayHistory "github.com/zvfkjytytw/humay/internal/server/history"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+)
+
+// samples of every metric in the list for sparklines.
+const defaultListSamples = 60
+
+//go:embed dashboard
+var dashboardFiles embed.FS
+
+var dashboardTemplate = template.Must(template.ParseFS(dashboardFiles, "dashboard/index.html"))
+
+// row of the metrics table rendered on the server for clients without scripts.
+type dashboardRow struct {
+	Type  string
+	Name  string
+	Value string
+}
+
+// data of the dashboard page, the rows are empty when a token is needed to read metrics.
+type dashboardData struct {
+	Rows   []dashboardRow
+	Locked bool
+}
+
+// SetHistory sets the history of metrics shown by the dashboard.
+// Must be called before Start.
+func (h *HTTPServer) SetHistory(history *humayHistory.History) {
+	h.history = history
+}
+
+// page of the dashboard, the table is filled on the server and updated by the script from the stream.
+// The page is public, with authorization enabled the script loads metrics with the entered token.
+func (h *HTTPServer) dashboardPage(w http.ResponseWriter, r *http.Request) {
+	if h.auth != nil {
+		w.Header().Set("Content-Type", "text/html")
+		if err := dashboardTemplate.Execute(w, dashboardData{Locked: true}); err != nil {
+			h.logger.Sugar().Errorf("failed render dashboard: %v", err)
+		}
+		return
+	}
+
+	allMetrics := h.store(r).GetAllMetrics()
+	rows := make([]dashboardRow, 0)
+	for mType, metrics := range allMetrics {
+		for name, value := range metrics {
+			rows = append(rows, dashboardRow{Type: mType, Name: name, Value: value})
+		}
+	}
+	sort.Slice(rows, func(i, j int) bool {
+		if rows[i].Type != rows[j].Type {
+			return rows[i].Type < rows[j].Type
+		}
+		return rows[i].Name < rows[j].Name
+	})
+
+	w.Header().Set("Content-Type", "text/html")
+	if err := dashboardTemplate.Execute(w, dashboardData{Rows: rows}); err != nil {
+		h.logger.Sugar().Errorf("failed render dashboard: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed load metrics page")
+	}
+}
+
+// static files of the dashboard.
+func dashboardStatic() http.Handler {
+	static, _ := fs.Sub(dashboardFiles, "dashboard") //nolint // the directory is embedded
+	return http.StripPrefix(hm.DashboardPrefix+"/static", http.FileServer(http.FS(static)))
+}
+
+// all metrics of the history with the latest samples, ?samples sets their number.
+func (h *HTTPServer) listSeries(w http.ResponseWriter, r *http.Request) {
+	samples := defaultListSamples
+	if value := r.URL.Query().Get("samples"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			hm.WriteError(w, http.StatusBadRequest, fmt.Sprintf("wrong number of samples %s", value))
+			return
+		}
+		samples = n
+	}
+
+	list := make([]humayHistory.Series, 0)
+	if h.history != nil {
+		list = h.history.List(samples)
+	}
+	h.writeJSON(w, http.StatusOK, list)
+}
+
+// one metric with all stored samples.
+func (h *HTTPServer) getSeries(w http.ResponseWriter, r *http.Request) {
+	metricType := chi.URLParam(r, "metricType")
+	metricName := chi.URLParam(r, "metricName")
+
+	if h.history == nil {
+		hm.WriteMetricError(w, http.StatusNotFound, metricName, fmt.Sprintf("metric %s not found", metricName))
+		return
+	}
+	series, ok := h.history.Get(metricType, metricName)
+	if !ok {
+		hm.WriteMetricError(w, http.StatusNotFound, metricName, fmt.Sprintf("metric %s not found", metricName))
+		return
+	}
+	h.writeJSON(w, http.StatusOK, series)
+}
+
+func (h *HTTPServer) writeJSON(w http.ResponseWriter, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshal answer: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed marshal answer")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+}
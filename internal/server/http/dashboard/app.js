@@ -0,0 +1,261 @@
+// dashboard of humay: loads the history of metrics and follows new samples.
+(function () {
+    "use strict";
+
+    const maxSamples = 60;
+    const series = new Map();
+    const state = { sort: "id", order: 1, selected: null };
+
+    const $ = (id) => document.getElementById(id);
+    const search = $("search");
+    const agentSelect = $("agent");
+    const tokenInput = $("token");
+    const status = $("status");
+
+    tokenInput.value = localStorage.getItem("humay-token") || "";
+
+    function headers(accept) {
+        const h = { "Accept": accept };
+        if (tokenInput.value) {
+            h["Authorization"] = "Bearer " + tokenInput.value;
+        }
+        return h;
+    }
+
+    function key(s) {
+        return s.type + "/" + s.id;
+    }
+
+    function setStatus(text, cls) {
+        status.textContent = text;
+        status.className = cls;
+    }
+
+    // value with the unit in a short form.
+    function format(value, unit) {
+        if (unit === "bytes") {
+            const units = ["B", "KiB", "MiB", "GiB", "TiB"];
+            let i = 0;
+            while (Math.abs(value) >= 1024 && i < units.length - 1) {
+                value /= 1024;
+                i++;
+            }
+            return value.toFixed(i ? 1 : 0) + " " + units[i];
+        }
+        if (unit === "ratio") {
+            return (value * 100).toFixed(3) + " %";
+        }
+        const text = Number.isInteger(value) ? String(value) : value.toPrecision(6);
+        return unit && unit !== "count" ? text + " " + unit : text;
+    }
+
+    function sparkline(samples, width, height) {
+        const svg = document.createElementNS("http://www.w3.org/2000/svg", "svg");
+        svg.setAttribute("viewBox", "0 0 " + width + " " + height);
+        svg.setAttribute("preserveAspectRatio", "none");
+        draw(svg, samples, width, height);
+        return svg;
+    }
+
+    function draw(svg, samples, width, height) {
+        svg.textContent = "";
+        if (!samples || samples.length < 2) {
+            return;
+        }
+        const values = samples.map((s) => s.v);
+        const min = Math.min(...values);
+        const range = Math.max(...values) - min || 1;
+        const t0 = samples[0].t;
+        const span = samples[samples.length - 1].t - t0 || 1;
+        const points = samples.map((s) =>
+            ((s.t - t0) / span * width).toFixed(1) + "," + (height - (s.v - min) / range * height).toFixed(1));
+        const line = document.createElementNS("http://www.w3.org/2000/svg", "polyline");
+        line.setAttribute("points", points.join(" "));
+        svg.appendChild(line);
+    }
+
+    // filter is words of the name or label=value pairs.
+    function matches(s) {
+        if (agentSelect.value && s.agent !== agentSelect.value) {
+            return false;
+        }
+        const words = search.value.trim().toLowerCase().split(/\s+/).filter(Boolean);
+        return words.every((word) => {
+            const pair = word.split("=");
+            if (pair.length === 2) {
+                const labels = Object.assign({ type: s.type, agent: s.agent || "" }, s.labels);
+                return Object.keys(labels).some((name) =>
+                    name.toLowerCase() === pair[0] && String(labels[name]).toLowerCase().includes(pair[1]));
+            }
+            return s.id.toLowerCase().includes(word);
+        });
+    }
+
+    function compare(a, b) {
+        const x = a[state.sort] === undefined ? "" : a[state.sort];
+        const y = b[state.sort] === undefined ? "" : b[state.sort];
+        if (x < y) {
+            return -state.order;
+        }
+        if (x > y) {
+            return state.order;
+        }
+        return a.id < b.id ? -1 : 1;
+    }
+
+    function cell(row, content, cls) {
+        const td = document.createElement("td");
+        if (content instanceof Node) {
+            td.appendChild(content);
+        } else {
+            td.textContent = content;
+        }
+        if (cls) {
+            td.className = cls;
+        }
+        row.appendChild(td);
+    }
+
+    function render() {
+        const agents = new Set([...series.values()].map((s) => s.agent).filter(Boolean));
+        const current = agentSelect.value;
+        agentSelect.length = 1;
+        [...agents].sort().forEach((agent) => agentSelect.add(new Option(agent, agent, false, agent === current)));
+
+        const body = document.querySelector("#metrics tbody");
+        body.textContent = "";
+        [...series.values()].filter(matches).sort(compare).forEach((s) => {
+            const row = document.createElement("tr");
+            const labels = document.createElement("span");
+            Object.keys(s.labels || {}).sort().forEach((name) => {
+                const label = document.createElement("span");
+                label.className = "label";
+                label.textContent = name + "=" + s.labels[name];
+                labels.appendChild(label);
+            });
+            const spark = sparkline(s.samples, 120, 24);
+            spark.classList.add("sparkline");
+
+            cell(row, s.type);
+            cell(row, s.id);
+            cell(row, labels);
+            cell(row, s.agent || "");
+            cell(row, format(s.value, s.unit), "value");
+            cell(row, spark);
+            cell(row, new Date(s.updated).toLocaleTimeString());
+            row.addEventListener("click", () => showDetails(s));
+            body.appendChild(row);
+        });
+
+        document.querySelectorAll("th[data-sort]").forEach((th) => {
+            th.className = th.dataset.sort === state.sort ? (state.order > 0 ? "asc" : "desc") : "";
+        });
+    }
+
+    async function showDetails(s) {
+        state.selected = key(s);
+        const response = await fetch("/dashboard/series/" + encodeURIComponent(s.type) + "/" + encodeURIComponent(s.id),
+            { headers: headers("application/json") });
+        if (!response.ok) {
+            return;
+        }
+        const full = await response.json();
+        const samples = full.samples || [];
+        $("details").hidden = false;
+        $("details-title").textContent = full.type + " " + full.id + (full.unit ? " (" + full.unit + ")" : "");
+        draw($("details-chart"), samples, 800, 200);
+        if (samples.length) {
+            const values = samples.map((x) => x.v);
+            $("details-range").textContent = "min " + format(Math.min(...values), full.unit) +
+                ", max " + format(Math.max(...values), full.unit) +
+                ", since " + new Date(samples[0].t).toLocaleString();
+        }
+    }
+
+    async function load() {
+        const response = await fetch("/dashboard/series?samples=" + maxSamples, { headers: headers("application/json") });
+        if (!response.ok) {
+            setStatus("failed load metrics: " + response.status, "offline");
+            return false;
+        }
+        series.clear();
+        (await response.json()).forEach((s) => series.set(key(s), s));
+        render();
+        return true;
+    }
+
+    // events are read by fetch, because EventSource can't send the token.
+    async function follow() {
+        for (;;) {
+            try {
+                const response = await fetch("/stream", { headers: headers("text/event-stream") });
+                if (!response.ok) {
+                    throw new Error("status " + response.status);
+                }
+                setStatus("live", "live");
+                const reader = response.body.pipeThrough(new TextDecoderStream()).getReader();
+                let buffer = "";
+                for (;;) {
+                    const { value, done } = await reader.read();
+                    if (done) {
+                        break;
+                    }
+                    buffer += value;
+                    let end;
+                    while ((end = buffer.indexOf("\n\n")) >= 0) {
+                        receive(buffer.slice(0, end));
+                        buffer = buffer.slice(end + 2);
+                    }
+                }
+            } catch (err) {
+                setStatus("offline: " + err.message, "offline");
+            }
+            await new Promise((resolve) => setTimeout(resolve, 5000));
+            await load();
+        }
+    }
+
+    let pending = false;
+    function receive(message) {
+        const lines = message.split("\n");
+        if (!lines.includes("event: metric")) {
+            return;
+        }
+        const data = lines.filter((line) => line.startsWith("data: ")).map((line) => line.slice(6)).join("\n");
+        const event = JSON.parse(data);
+        const value = event.type === "counter" ? event.delta : event.value;
+        const known = series.get(key(event)) || { samples: [] };
+        series.set(key(event), {
+            id: event.id,
+            type: event.type,
+            labels: event.labels || known.labels,
+            agent: event.agent || known.agent,
+            unit: known.unit,
+            updated: event.time,
+            value: value,
+            samples: (known.samples || []).concat([{ t: event.time, v: value }]).slice(-maxSamples),
+        });
+        // render at most once per frame.
+        if (!pending) {
+            pending = true;
+            requestAnimationFrame(() => {
+                pending = false;
+                render();
+            });
+        }
+    }
+
+    document.querySelectorAll("th[data-sort]").forEach((th) => th.addEventListener("click", () => {
+        state.order = state.sort === th.dataset.sort ? -state.order : 1;
+        state.sort = th.dataset.sort;
+        render();
+    }));
+    search.addEventListener("input", render);
+    agentSelect.addEventListener("change", render);
+    tokenInput.addEventListener("change", () => {
+        localStorage.setItem("humay-token", tokenInput.value);
+        load();
+    });
+
+    load().then(follow);
+})();
@@ -0,0 +1,109 @@
+package humayhttpserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+	humayHistory "github.com/zvfkjytytw/humay/internal/server/history"
+	humayHub "github.com/zvfkjytytw/humay/internal/server/hub"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+// newStreamingServer wires the storage, the hub and the history like the app does.
+func newStreamingServer(t *testing.T) *HTTPServer {
+	hub := humayHub.NewHub(nil)
+	history := humayHistory.NewHistory(nil)
+	hub.Listen(func(event humayHub.Event) {
+		history.Record(&event.Metric, event.Agent, time.UnixMilli(event.Time))
+	})
+
+	return &HTTPServer{
+		storage: humayHub.NewPublisher(humayStorage.NewStorage(t.TempDir()+"/metrics.json", ""), hub),
+		logger:  zap.NewNop(),
+		history: history,
+		hub:     hub,
+	}
+}
+
+func TestDashboard(t *testing.T) {
+	h := newStreamingServer(t)
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	push := func(agent, body string) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+httpModels.UpdatesHandler, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(httpModels.AgentHeader, agent)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	push("host-1", `[{"id":"Alloc","type":"gauge","value":1,"labels":{"env":"test"}},{"id":"PollCount","type":"counter","delta":2}]`)
+	push("host-1", `[{"id":"PollCount","type":"counter","delta":3}]`)
+
+	resp, err := http.Get(server.URL + "/")
+	require.NoError(t, err)
+	page := new(strings.Builder)
+	bufio.NewReader(resp.Body).WriteTo(page)
+	resp.Body.Close()
+	assert.Equal(t, "text/html", resp.Header.Get("Content-Type"))
+	// counters go before gauges.
+	assert.Less(t, strings.Index(page.String(), "PollCount"), strings.Index(page.String(), "Alloc"))
+
+	resp, err = http.Get(server.URL + "/dashboard/series?samples=5")
+	require.NoError(t, err)
+	var list []humayHistory.Series
+	assert.NoError(t, json.NewDecoder(resp.Body).Decode(&list))
+	resp.Body.Close()
+	require.Len(t, list, 2)
+	assert.Equal(t, "PollCount", list[0].ID)
+	assert.Equal(t, []humayHistory.Sample{{Time: list[0].Samples[0].Time, Value: 2}, {Time: list[0].Updated, Value: 5}}, list[0].Samples)
+	assert.Equal(t, map[string]string{"env": "test"}, list[1].Labels)
+	assert.Equal(t, "host-1", list[1].Agent)
+
+	resp, err = http.Get(server.URL + "/dashboard/series/gauge/Unknown")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + "/dashboard/static/app.js")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestDashboardWithAuth(t *testing.T) {
+	h := newStreamingServer(t)
+	h.auth = humayAuth.NewAuthenticator(nil, "admin")
+	require.NoError(t, h.storage.PutGaugeMetric("Secret", 1))
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	// the page with the token input is public, the metrics are not.
+	resp, err := http.Get(server.URL + "/")
+	require.NoError(t, err)
+	page := new(strings.Builder)
+	bufio.NewReader(resp.Body).WriteTo(page)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, page.String(), `id="token"`)
+	assert.NotContains(t, page.String(), "Secret")
+
+	resp, err = http.Get(server.URL + "/dashboard/series")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+}
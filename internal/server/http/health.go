@@ -0,0 +1,27 @@
+package humayhttpserver
+
+import (
+	"net/http"
+
+	humayHealth "github.com/zvfkjytytw/humay/internal/server/health"
+)
+
+// the process is up and serves requests.
+func (h *HTTPServer) healthz(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, http.StatusOK, &humayHealth.Report{Status: humayHealth.StatusOK, Checks: []humayHealth.Result{}})
+}
+
+// the storage, the snapshot writer and the disk are able to accept metrics.
+func (h *HTTPServer) readyz(w http.ResponseWriter, r *http.Request) {
+	report := &humayHealth.Report{Status: humayHealth.StatusOK, Checks: []humayHealth.Result{}}
+	if h.health != nil {
+		report = h.health.Cached(r.Context())
+	}
+
+	status := http.StatusOK
+	if report.Status != humayHealth.StatusOK {
+		h.logger.Sugar().Errorf("server is not ready, failed checks: %v", report.Failed)
+		status = http.StatusServiceUnavailable
+	}
+	h.writeJSON(w, status, report)
+}
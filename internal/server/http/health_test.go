@@ -0,0 +1,59 @@
+package humayhttpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	humayHealth "github.com/zvfkjytytw/humay/internal/server/health"
+)
+
+func TestProbes(t *testing.T) {
+	health := humayHealth.NewChecker(nil)
+	health.AddDisk("disk", t.TempDir())
+	h := &HTTPServer{
+		storage: &mockStorage{},
+		logger:  zap.NewNop(),
+		// probes are not signed.
+		hashKey:         "key",
+		signatureStrict: true,
+		health:          health,
+	}
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	probe := func(path string) (int, *humayHealth.Report) {
+		resp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		report := &humayHealth.Report{}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(report))
+		return resp.StatusCode, report
+	}
+
+	status, report := probe("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, humayHealth.StatusOK, report.Status)
+
+	status, report = probe("/readyz")
+	assert.Equal(t, http.StatusOK, status)
+	assert.Equal(t, humayHealth.StatusOK, report.Status)
+	assert.Len(t, report.Checks, 1)
+
+	health.Add("storage", func(ctx context.Context) error {
+		return errors.New("connection refused")
+	})
+	status, report = probe("/readyz")
+	assert.Equal(t, http.StatusServiceUnavailable, status)
+	assert.Equal(t, []string{"storage"}, report.Failed)
+
+	status, _ = probe("/healthz")
+	assert.Equal(t, http.StatusOK, status)
+}
@@ -2,67 +2,88 @@ package humayhttpserver
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
+	"strconv"
 	"strings"
 
 	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayTracing "github.com/zvfkjytytw/humay/internal/common/tracing"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+	render "github.com/zvfkjytytw/humay/internal/server/http/render"
+	humayTelemetry "github.com/zvfkjytytw/humay/internal/server/telemetry"
+	humayWriteBuffer "github.com/zvfkjytytw/humay/internal/server/writebuffer"
 )
 
+// seconds the agent waits before sending again to the full write buffer.
+const bufferRetryAfter = 1
+
+// saveStatus returns the status of the failed write.
+// The full write buffer answers 503 with Retry-After, so agents back off and send again.
+func saveStatus(w http.ResponseWriter, err error) int {
+	if errors.Is(err, humayWriteBuffer.ErrBufferFull) {
+		w.Header().Set("Retry-After", strconv.Itoa(bufferRetryAfter))
+		return http.StatusServiceUnavailable
+	}
+
+	return http.StatusInternalServerError
+}
+
 // return metric structure with the actual value from the storage.
 func (h *HTTPServer) getJSONValue(w http.ResponseWriter, r *http.Request) {
 	// parsing request body.
 	contentType, ok := r.Header["Content-Type"]
 	if !ok || contentType[0] != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("wrong Content-Type. Expect application/json"))
+		hm.WriteError(w, http.StatusBadRequest, "wrong Content-Type. Expect application/json")
 		return
 	}
 
 	defer r.Body.Close()
 	requestBody, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed read body"))
+		hm.WriteError(w, http.StatusBadRequest, "failed read body")
 		return
 	}
 
 	requestMetric := &httpModels.Metric{}
 	err = json.Unmarshal(requestBody, requestMetric)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed unmarshal body"))
+		hm.WriteError(w, http.StatusBadRequest, "failed unmarshal body")
 		return
 	}
 
 	metricType := requestMetric.MType
 	metricName := requestMetric.ID
 	if !checkMetricType(metricType) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("wrong metric type %s", metricType)))
+		hm.WriteMetricError(w, http.StatusBadRequest, metricName, fmt.Sprintf("wrong metric type %s", metricType))
 		return
 	}
 
-	metric, err := h.getMetricStruct(metricType, metricName)
+	metric, err := h.getMetricStruct(r, metricType, metricName)
 	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		w.Write([]byte(fmt.Sprintf("metric %s not found", metricName)))
+		hm.WriteMetricError(w, http.StatusNotFound, metricName, fmt.Sprintf("metric %s not found", metricName))
 		return
 	}
 
-	body, err := json.Marshal(metric)
+	if err := render.Metric(w, r, render.JSON, metric); err != nil {
+		h.logger.Sugar().Errorf("failed render metric %s: %v", metricName, err)
+	}
+}
+
+// return all metrics sorted by type and name in the format of the Accept header.
+func (h *HTTPServer) getJSONValues(w http.ResponseWriter, r *http.Request) {
+	gauges, counters, err := h.store(r).DumpMetrics()
 	if err != nil {
-		h.logger.Sugar().Errorf("failed marshal metric %s: %w", metricName, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed marshal metric"))
+		h.logger.Sugar().Errorf("failed dump metrics: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed get metrics")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("HashKey", h.hashKey)
-	w.WriteHeader(http.StatusOK)
-	w.Write(body)
+	if err := render.Metrics(w, r, render.JSON, snapshotMetrics(gauges, counters)); err != nil {
+		h.logger.Sugar().Errorf("failed render metrics: %v", err)
+	}
 }
 
 // save metric with the name and value from the request Body to the storage.
@@ -70,82 +91,76 @@ func (h *HTTPServer) putJSONValue(w http.ResponseWriter, r *http.Request) {
 	// parse request body.
 	contentType, ok := r.Header["Content-Type"]
 	if !ok || contentType[0] != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("wrong Content-Type. Expect application/json"))
+		hm.WriteError(w, http.StatusBadRequest, "wrong Content-Type. Expect application/json")
 		return
 	}
 
 	defer r.Body.Close()
 	requestBody, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed read body"))
+		hm.WriteError(w, http.StatusBadRequest, "failed read body")
 		return
 	}
 
 	requestMetric := &httpModels.Metric{}
 	err = json.Unmarshal(requestBody, requestMetric)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed unmarshal body"))
+		hm.WriteError(w, http.StatusBadRequest, "failed unmarshal body")
 		return
 	}
 
-	metricType := requestMetric.MType
-	metricName := requestMetric.ID
-	if !checkMetricType(metricType) {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("wrong metric type %s", metricType)))
+	if apiError := h.ingest(requestMetric); apiError != nil {
+		hm.WriteErrorBody(w, http.StatusBadRequest, apiError)
 		return
 	}
+	metricType := requestMetric.MType
+	metricName := requestMetric.ID
+	h.annotate(r, requestMetric)
 
 	// save metric.
 	switch metricType {
 	case httpModels.GaugeMetric:
-		err := h.storage.PutGaugeMetric(metricName, *requestMetric.Value)
+		err := h.store(r).PutGaugeMetric(metricName, *requestMetric.Value)
 		if err != nil {
 			h.logger.Sugar().Errorf("failed save %s metric %s: %w", httpModels.GaugeMetric, metricName, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("failed save metric"))
+			hm.WriteMetricError(w, saveStatus(w, err), metricName, "failed save metric")
 			return
 		}
 
 	case httpModels.CounterMetric:
-		err := h.storage.PutCounterMetric(metricName, *requestMetric.Delta)
+		err := h.store(r).PutCounterMetric(metricName, *requestMetric.Delta)
 		if err != nil {
 			h.logger.Sugar().Errorf("failed save %s metric %s: %w", httpModels.CounterMetric, metricName, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("failed save metric"))
+			hm.WriteMetricError(w, saveStatus(w, err), metricName, "failed save metric")
 			return
 		}
 	}
+	h.putDerived(r, requestMetric)
 
 	// return saved metric.
-	metric, err := h.getMetricStruct(metricType, metricName) //nolint // this metric just saved
+	metric, err := h.getMetricStruct(r, metricType, metricName) //nolint // this metric just saved
 	if err != nil {
 		h.logger.Sugar().Errorf("failed get metric %s: %w", metricName, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed marshal metric"))
+		hm.WriteMetricError(w, http.StatusInternalServerError, metricName, "failed get saved metric")
 		return
 	}
+	metric.Labels = requestMetric.Labels
 
 	body, err := json.Marshal(metric)
 	if err != nil {
 		h.logger.Sugar().Errorf("failed marshal metric %s: %w", metricName, err)
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte("failed marshal metric"))
+		hm.WriteError(w, http.StatusInternalServerError, "failed marshal metric")
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.Header().Set("Storage-Type", h.storage.GetType())
-	w.Header().Set("HashKey", h.hashKey)
 	w.WriteHeader(http.StatusOK)
 	w.Write(body)
 }
 
 // get metric structure with the actual value from the storage.
-func (h *HTTPServer) getMetricStruct(mType, mName string) (*httpModels.Metric, error) {
+func (h *HTTPServer) getMetricStruct(r *http.Request, mType, mName string) (*httpModels.Metric, error) {
 	metric := &httpModels.Metric{
 		ID:    mName,
 		MType: mType,
@@ -153,14 +168,14 @@ func (h *HTTPServer) getMetricStruct(mType, mName string) (*httpModels.Metric, e
 
 	switch mType {
 	case httpModels.GaugeMetric:
-		value, err := h.storage.GetGaugeMetric(mName)
+		value, err := h.store(r).GetGaugeMetric(mName)
 		if err != nil {
 			h.logger.Sugar().Errorf("failed get metric: %w", err)
 			return nil, err
 		}
 		metric.Value = &value
 	case httpModels.CounterMetric:
-		value, err := h.storage.GetCounterMetric(mName)
+		value, err := h.store(r).GetCounterMetric(mName)
 		if err != nil {
 			h.logger.Sugar().Errorf("failed get metric: %w", err)
 			return nil, err
@@ -171,6 +186,38 @@ func (h *HTTPServer) getMetricStruct(mType, mName string) (*httpModels.Metric, e
 	return metric, nil
 }
 
+// validateMetric normalizes the metric and checks that it can be saved.
+func validateMetric(metric *httpModels.Metric) *httpModels.Error {
+	if metric == nil {
+		return &httpModels.Error{Code: httpModels.CodeInvalidMetric, Message: "empty metric"}
+	}
+	metric.ID = strings.TrimSpace(metric.ID)
+	metric.MType = strings.ToLower(strings.TrimSpace(metric.MType))
+
+	invalid := func(message string) *httpModels.Error {
+		return &httpModels.Error{Code: httpModels.CodeInvalidMetric, Message: message, MetricID: metric.ID}
+	}
+	switch {
+	case metric.ID == "":
+		return invalid("empty metric name")
+	case strings.HasPrefix(metric.ID, humayTelemetry.ReservedPrefix):
+		return invalid(fmt.Sprintf("prefix %s is reserved for the server", humayTelemetry.ReservedPrefix))
+	case !checkMetricType(metric.MType):
+		return invalid(fmt.Sprintf("wrong metric type %s", metric.MType))
+	case metric.MType == httpModels.GaugeMetric && metric.Value == nil:
+		return invalid("absent gauge value")
+	case metric.MType == httpModels.CounterMetric && metric.Delta == nil:
+		return invalid("absent counter value")
+	}
+	for name := range metric.Labels {
+		if strings.TrimSpace(name) == "" {
+			return invalid("empty label name")
+		}
+	}
+
+	return nil
+}
+
 // checking the type of metric for compliance with acceptable.
 func checkMetricType(mType string) bool {
 	for _, t := range httpModels.MetricTypes {
@@ -183,129 +230,121 @@ func checkMetricType(mType string) bool {
 }
 
 // save metrics with the name and value from the request Body to the storage.
+// Invalid metrics are skipped and reported in the result of the item,
+// the answer is 207 if some metrics are invalid and 422 if all of them are.
 func (h *HTTPServer) putJSONValues(w http.ResponseWriter, r *http.Request) {
 	contentType, ok := r.Header["Content-Type"]
 	if !ok || contentType[0] != "application/json" {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("wrong Content-Type. Expect application/json"))
+		hm.WriteError(w, http.StatusBadRequest, "wrong Content-Type. Expect application/json")
 		return
 	}
 
 	defer r.Body.Close()
+	// reading includes decompression if the signature middleware did not read the body.
+	_, span := humayTracing.Tracer().Start(r.Context(), "decode body")
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed read body"))
+		span.End()
+		hm.WriteError(w, http.StatusBadRequest, "failed read body")
 		return
 	}
 
 	var metrics []*httpModels.Metric
 	err = json.Unmarshal(body, &metrics)
+	span.End()
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte("failed unmarshal body"))
+		hm.WriteError(w, http.StatusBadRequest, "failed unmarshal body")
 		return
 	}
 
+	if h.maxBatchSize > 0 && len(metrics) > h.maxBatchSize {
+		hm.WriteError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("batch has %d metrics, maximum is %d", len(metrics), h.maxBatchSize))
+		return
+	}
+
+	results := make([]*httpModels.MetricResult, len(metrics))
 	gaugeMetrics := make(map[string]float64)
 	counterMetrics := make(map[string]int64)
+	invalid := 0
 
-	for _, metric := range metrics {
-		switch strings.ToLower(strings.TrimSpace(metric.MType)) {
-		case "gauge":
-			gaugeMetrics[strings.TrimSpace(metric.ID)] = *metric.Value
-		case "counter":
-			delta, ok := counterMetrics[strings.TrimSpace(metric.ID)]
-			if ok {
-				counterMetrics[strings.TrimSpace(metric.ID)] = delta + *metric.Delta
-			} else {
-				counterMetrics[strings.TrimSpace(metric.ID)] = *metric.Delta
+	for i, metric := range metrics {
+		if apiError := h.ingest(metric); apiError != nil {
+			results[i] = &httpModels.MetricResult{Error: apiError}
+			if metric != nil {
+				results[i].Metric = *metric
 			}
+			invalid++
+			continue
+		}
+
+		h.annotate(r, metric)
+		switch metric.MType {
+		case httpModels.GaugeMetric:
+			gaugeMetrics[metric.ID] = *metric.Value
+		case httpModels.CounterMetric:
+			counterMetrics[metric.ID] += *metric.Delta
+		}
+	}
+
+	// derived gauges are saved with the written ones.
+	valid := make([]*httpModels.Metric, 0, len(metrics)-invalid)
+	for i, metric := range metrics {
+		if results[i] == nil {
+			valid = append(valid, metric)
 		}
 	}
+	for name, value := range h.derive(r, valid...) {
+		gaugeMetrics[name] = value
+	}
 
 	if len(counterMetrics) > 0 {
-		if err = h.storage.PutCounterMetrics(counterMetrics); err != nil {
-			h.logger.Sugar().Errorf("failed save %s metrics: %w", httpModels.CounterMetric, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("failed save counter metrics"))
+		if err = h.store(r).PutCounterMetrics(counterMetrics); err != nil {
+			h.logger.Sugar().Errorf("failed save %s metrics: %v", httpModels.CounterMetric, err)
+			hm.WriteError(w, saveStatus(w, err), "failed save counter metrics")
 			return
 		}
 	}
 
 	if len(gaugeMetrics) > 0 {
-		if err = h.storage.PutGaugeMetrics(gaugeMetrics); err != nil {
-			h.logger.Sugar().Errorf("failed save %s metrics: %w", httpModels.GaugeMetric, err)
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte("failed save gauge metrics"))
+		if err = h.store(r).PutGaugeMetrics(gaugeMetrics); err != nil {
+			h.logger.Sugar().Errorf("failed save %s metrics: %v", httpModels.GaugeMetric, err)
+			hm.WriteError(w, saveStatus(w, err), "failed save gauge metrics")
 			return
 		}
 	}
 
-	gauges := make([]string, 0, len(gaugeMetrics))
-	for id := range gaugeMetrics {
-		gauges = append(gauges, id)
-	}
+	// return saved values in the order of the request.
+	for i, metric := range metrics {
+		if results[i] != nil {
+			continue
+		}
 
-	counters := make([]string, 0, len(counterMetrics))
-	for id := range counterMetrics {
-		counters = append(counters, id)
+		saved, err := h.getMetricStruct(r, metric.MType, metric.ID)
+		if err != nil {
+			h.logger.Sugar().Errorf("failed get saved metric %s: %v", metric.ID, err)
+			hm.WriteMetricError(w, http.StatusInternalServerError, metric.ID, "failed get saved metric")
+			return
+		}
+		saved.Labels = metric.Labels
+		results[i] = &httpModels.MetricResult{Metric: *saved}
 	}
 
-	metricsList, err := h.getMetricsList(gauges, counters)
+	respBody, err := json.Marshal(results)
 	if err != nil {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("can't get saved metrics"))
+		h.logger.Sugar().Errorf("failed marshal saved metrics: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed marshal saved metrics")
 		return
 	}
 
-	respBody, err := json.Marshal(metricsList)
-	if err != nil {
-		w.WriteHeader(http.StatusOK)
-		w.Write([]byte("can't get saved metrics"))
-		return
+	status := http.StatusOK
+	switch {
+	case invalid > 0 && invalid == len(metrics):
+		status = http.StatusUnprocessableEntity
+	case invalid > 0:
+		status = http.StatusMultiStatus
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	w.Header().Set("HashKey", h.hashKey)
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(status)
 	w.Write(respBody)
 }
-
-func (h *HTTPServer) getMetricsList(gauges, counters []string) (metrics []*httpModels.Metric, err error) {
-	metrics = make([]*httpModels.Metric, 0, len(gauges)+len(counters))
-
-	for _, name := range gauges {
-		value, err := h.storage.GetGaugeMetric(name)
-		if err != nil {
-			h.logger.Sugar().Errorf("failed get %s metric %s: %w", httpModels.GaugeMetric, name, err)
-			return nil, err
-		}
-		metrics = append(
-			metrics,
-			&httpModels.Metric{
-				ID:    name,
-				MType: "gauge",
-				Value: &value,
-			},
-		)
-	}
-
-	for _, name := range counters {
-		value, err := h.storage.GetCounterMetric(name)
-		if err != nil {
-			h.logger.Sugar().Errorf("failed get %s metric %s: %w", httpModels.CounterMetric, name, err)
-			return nil, err
-		}
-		metrics = append(
-			metrics,
-			&httpModels.Metric{
-				ID:    name,
-				MType: "counter",
-				Delta: &value,
-			},
-		)
-	}
-
-	return metrics, nil
-}
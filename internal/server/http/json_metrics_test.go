@@ -0,0 +1,210 @@
+package humayhttpserver
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	agentHTTP "github.com/zvfkjytytw/humay/internal/agent/http"
+	humayAgentStatus "github.com/zvfkjytytw/humay/internal/agent/status"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayPipeline "github.com/zvfkjytytw/humay/internal/server/pipeline"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+func TestJSONErrors(t *testing.T) {
+	h := &HTTPServer{
+		storage: humayStorage.NewStorage(t.TempDir()+"/metrics.json", ""),
+		logger:  zap.NewNop(),
+	}
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		path    string
+		body    string
+		stCode  int
+		code    string
+		results []*httpModels.MetricResult
+	}{
+		{
+			name:   "gauge without value",
+			path:   httpModels.UpdateHandler,
+			body:   `{"id":"Alloc","type":"gauge"}`,
+			stCode: http.StatusBadRequest,
+			code:   httpModels.CodeInvalidMetric,
+		},
+		{
+			name:   "counter without delta",
+			path:   httpModels.UpdateHandler,
+			body:   `{"id":"PollCount","type":"counter"}`,
+			stCode: http.StatusBadRequest,
+			code:   httpModels.CodeInvalidMetric,
+		},
+		{
+			name:   "broken json",
+			path:   httpModels.UpdatesHandler,
+			body:   `[{"id":`,
+			stCode: http.StatusBadRequest,
+			code:   httpModels.CodeBadRequest,
+		},
+		{
+			name:   "unknown metric",
+			path:   httpModels.ValueHandler,
+			body:   `{"id":"Unknown","type":"gauge"}`,
+			stCode: http.StatusNotFound,
+			code:   httpModels.CodeNotFound,
+		},
+		{
+			name:   "partly invalid batch",
+			path:   httpModels.UpdatesHandler,
+			body:   `[{"id":"PollCount","type":"counter","delta":2},{"id":"Alloc","type":"gauge"},null,{"id":"PollCount","type":"Counter","delta":3}]`,
+			stCode: http.StatusMultiStatus,
+			results: []*httpModels.MetricResult{
+				{Metric: httpModels.Metric{ID: "PollCount", MType: "counter", Delta: ptr(int64(5))}},
+				{
+					Metric: httpModels.Metric{ID: "Alloc", MType: "gauge"},
+					Error:  &httpModels.Error{Code: httpModels.CodeInvalidMetric, Message: "absent gauge value", MetricID: "Alloc"},
+				},
+				{Error: &httpModels.Error{Code: httpModels.CodeInvalidMetric, Message: "empty metric"}},
+				{Metric: httpModels.Metric{ID: "PollCount", MType: "counter", Delta: ptr(int64(5))}},
+			},
+		},
+		{
+			name:   "invalid batch",
+			path:   httpModels.UpdatesHandler,
+			body:   `[{"id":"","type":"gauge","value":1}]`,
+			stCode: http.StatusUnprocessableEntity,
+			results: []*httpModels.MetricResult{
+				{
+					Metric: httpModels.Metric{MType: "gauge", Value: ptr(1.0)},
+					Error:  &httpModels.Error{Code: httpModels.CodeInvalidMetric, Message: "empty metric name"},
+				},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+test.path, "application/json", strings.NewReader(test.body))
+			assert.NoError(t, err)
+			defer resp.Body.Close()
+			assert.Equal(t, test.stCode, resp.StatusCode)
+			assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+			if test.results != nil {
+				var results []*httpModels.MetricResult
+				assert.NoError(t, json.NewDecoder(resp.Body).Decode(&results))
+				assert.Equal(t, test.results, results)
+				return
+			}
+
+			apiError := &httpModels.Error{}
+			assert.NoError(t, json.NewDecoder(resp.Body).Decode(apiError))
+			assert.Equal(t, test.code, apiError.Code)
+			assert.NotEmpty(t, apiError.Message)
+		})
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	pipeline, err := humayPipeline.New(&humayPipeline.Config{
+		Replace: "_",
+		Deny:    []string{`Secret.*`},
+		Derived: []humayPipeline.Derived{{Name: "HeapFree", Op: humayPipeline.OpSub, Args: []string{"HeapSys", "HeapInuse"}}},
+	})
+	require.NoError(t, err)
+	storage := humayStorage.NewStorage(t.TempDir()+"/metrics.json", "")
+	h := &HTTPServer{storage: storage, logger: zap.NewNop()}
+	h.SetPipeline(pipeline)
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	post := func(path, contentType, body string) int {
+		resp, err := http.Post(server.URL+path, contentType, strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// every write handler passes metrics through the pipeline.
+	assert.Equal(t, http.StatusOK, post(httpModels.UpdateHandler+"/gauge/HeapSys/200", "text/plain", ""))
+	assert.Equal(t, http.StatusOK, post(httpModels.UpdateHandler, "application/json", `{"id":"Heap Inuse","type":"gauge","value":50}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, post(httpModels.UpdatesHandler, "application/json", `[{"id":"SecretKey","type":"gauge","value":1}]`))
+	assert.Equal(t, http.StatusOK, post(httpModels.UpdatesHandler, "application/json", `[{"id":"HeapInuse","type":"gauge","value":80}]`))
+	assert.Equal(t, http.StatusBadRequest, post(httpModels.UpdateHandler+"/gauge/SecretKey/1", "text/plain", ""))
+
+	value, err := storage.GetGaugeMetric("Heap_Inuse")
+	assert.NoError(t, err)
+	assert.Equal(t, 50.0, value)
+	value, err = storage.GetGaugeMetric("HeapFree")
+	assert.NoError(t, err)
+	assert.Equal(t, 120.0, value)
+	_, err = storage.GetGaugeMetric("SecretKey")
+	assert.Error(t, err)
+}
+
+func TestPipelineReservedPrefix(t *testing.T) {
+	pipeline, err := humayPipeline.New(&humayPipeline.Config{Lowercase: true})
+	require.NoError(t, err)
+	storage := humayStorage.NewStorage(t.TempDir()+"/metrics.json", "")
+	h := &HTTPServer{storage: storage, logger: zap.NewNop()}
+	h.SetPipeline(pipeline)
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	post := func(path, contentType, body string) int {
+		resp, err := http.Post(server.URL+path, contentType, strings.NewReader(body))
+		require.NoError(t, err)
+		resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	// the name becomes reserved only after lowercasing.
+	assert.Equal(t, http.StatusBadRequest, post(httpModels.UpdateHandler+"/counter/_HUMAY_snapshots_total/1", "text/plain", ""))
+	assert.Equal(t, http.StatusBadRequest, post(httpModels.UpdateHandler, "application/json", `{"id":"_HUMAY_snapshots_total","type":"counter","delta":1}`))
+	assert.Equal(t, http.StatusUnprocessableEntity, post(httpModels.UpdatesHandler, "application/json", `[{"id":"_Humay_snapshots_total","type":"counter","delta":1}]`))
+
+	_, err = storage.GetCounterMetric("_humay_snapshots_total")
+	assert.Error(t, err)
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func TestAgentPartialBatch(t *testing.T) {
+	storage := humayStorage.NewStorage(t.TempDir()+"/metrics.json", "")
+	h := &HTTPServer{storage: storage, logger: zap.NewNop()}
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	client, err := agentHTTP.NewClient(strings.TrimPrefix(server.URL, "http://"), zap.NewNop(), "")
+	require.NoError(t, err)
+	defer client.Stop()
+	stats := humayAgentStatus.NewStats(0)
+	client.SetStats(stats)
+
+	// the batch is saved partly, it is not failed and not sent again.
+	err = client.UpdateJSONMetrics([]*httpModels.Metric{
+		{ID: "PollCount", MType: httpModels.CounterMetric, Delta: ptr(int64(2))},
+		{ID: "Alloc", MType: httpModels.GaugeMetric},
+	})
+	assert.NoError(t, err)
+
+	status := stats.Status(time.Now())
+	assert.Equal(t, int64(1), status.Sends)
+	assert.Equal(t, int64(0), status.SendFailures)
+	assert.Equal(t, int64(1), status.Rejected)
+	value, err := storage.GetCounterMetric("PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+}
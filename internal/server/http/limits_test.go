@@ -0,0 +1,196 @@
+package humayhttpserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	agentHTTP "github.com/zvfkjytytw/humay/internal/agent/http"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+	humayWriteBuffer "github.com/zvfkjytytw/humay/internal/server/writebuffer"
+)
+
+func TestRequestLimits(t *testing.T) {
+	h := &HTTPServer{
+		storage:      &mockStorage{},
+		logger:       zap.NewNop(),
+		limiter:      hm.NewRateLimiter(1, 2),
+		maxBodySize:  256,
+		maxBatchSize: 2,
+	}
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	post := func(body []byte, gzipped bool) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, server.URL+httpModels.UpdatesHandler, bytes.NewReader(body))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		if gzipped {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		return resp
+	}
+
+	// big body compressed below the limit.
+	bomb := &bytes.Buffer{}
+	gz := gzip.NewWriter(bomb)
+	gz.Write([]byte(`[{"id":"` + strings.Repeat("a", 4096) + `","type":"gauge","value":1}]`))
+	gz.Close()
+
+	tests := []struct {
+		name    string
+		body    []byte
+		gzipped bool
+		stCode  int
+	}{
+		{name: "too large body", body: bytes.Repeat([]byte(" "), 1024), stCode: http.StatusRequestEntityTooLarge},
+		{name: "too large decompressed body", body: bomb.Bytes(), gzipped: true, stCode: http.StatusRequestEntityTooLarge},
+		{name: "too many metrics", body: []byte(`[{"id":"a","type":"gauge","value":1},{"id":"b","type":"gauge","value":1},{"id":"c","type":"gauge","value":1}]`), stCode: http.StatusRequestEntityTooLarge},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp := post(test.body, test.gzipped)
+			assert.Equal(t, test.stCode, resp.StatusCode)
+		})
+	}
+
+	// too large bodies are rejected before the limiter, the batch took one token of two.
+	resp := post([]byte(`[]`), false)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	resp = post([]byte(`[]`), false)
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "1", resp.Header.Get("Retry-After"))
+}
+
+func TestAgentRespectsRetryAfter(t *testing.T) {
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			w.WriteHeader(http.StatusTooManyRequests)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := agentHTTP.NewClient(strings.TrimPrefix(server.URL, "http://"), zap.NewNop(), "")
+	assert.NoError(t, err)
+	defer client.Stop()
+
+	start := time.Now()
+	assert.NoError(t, client.UpdateJSONGauge("Alloc", 1))
+	assert.Equal(t, int32(2), calls.Load())
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// errors of the server may come after the metrics are saved, they are not retried.
+	calls.Store(20)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusInternalServerError)
+	})
+	assert.Error(t, client.UpdateJSONMetrics([]*httpModels.Metric{}))
+	assert.Equal(t, int32(21), calls.Load())
+
+	// client errors are not retried.
+	calls.Store(10)
+	server.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+	})
+	assert.Error(t, client.UpdateJSONMetrics([]*httpModels.Metric{}))
+	assert.Equal(t, int32(11), calls.Load())
+}
+
+func TestTrustedSubnet(t *testing.T) {
+	trusted, err := hm.NewTrustedSubnet("10.0.0.0/8")
+	assert.NoError(t, err)
+	h := &HTTPServer{
+		storage: &mockStorage{},
+		logger:  zap.NewNop(),
+		trusted: trusted,
+	}
+	router := h.newRouter()
+
+	post := func(remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodPost, httpModels.UpdatesHandler, strings.NewReader(`[]`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = remoteAddr
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, post("10.1.2.3:1234"))
+	assert.Equal(t, http.StatusForbidden, post("192.168.1.1:1234"))
+	assert.Equal(t, http.StatusForbidden, post("garbage"))
+
+	// the header set by the client does not change the address.
+	req := httptest.NewRequest(http.MethodPost, httpModels.UpdatesHandler, strings.NewReader(`[]`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Real-IP", "10.1.2.3")
+	req.RemoteAddr = "192.168.1.1:1234"
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+
+	// the subnet is replaced while the server runs.
+	assert.NoError(t, h.SetTrustedSubnet("192.168.0.0/16"))
+	assert.Equal(t, http.StatusOK, post("192.168.1.1:1234"))
+	assert.Error(t, h.SetTrustedSubnet("192.168.0.0"))
+	assert.NoError(t, h.SetTrustedSubnet(""))
+	assert.Equal(t, http.StatusOK, post("garbage"))
+}
+
+// fullStorage answers every write like the full write buffer.
+type fullStorage struct {
+	mockStorage
+}
+
+func (s *fullStorage) PutGaugeMetric(string, float64) error { return humayWriteBuffer.ErrBufferFull }
+func (s *fullStorage) PutCounterMetric(string, int64) error { return humayWriteBuffer.ErrBufferFull }
+func (s *fullStorage) PutGaugeMetrics(map[string]float64) error {
+	return humayWriteBuffer.ErrBufferFull
+}
+func (s *fullStorage) PutCounterMetrics(map[string]int64) error {
+	return humayWriteBuffer.ErrBufferFull
+}
+
+func TestWriteBufferFull(t *testing.T) {
+	h := &HTTPServer{storage: &fullStorage{}, logger: zap.NewNop()}
+	router := h.newRouter()
+
+	tests := []struct {
+		name        string
+		path        string
+		contentType string
+		body        string
+	}{
+		{name: "url", path: httpModels.UpdateHandler + "/counter/PollCount/1", contentType: "text/plain"},
+		{name: "json", path: httpModels.UpdateHandler, contentType: "application/json", body: `{"id":"Alloc","type":"gauge","value":1}`},
+		{name: "batch", path: httpModels.UpdatesHandler, contentType: "application/json", body: `[{"id":"PollCount","type":"counter","delta":1}]`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, test.path, strings.NewReader(test.body))
+			req.Header.Set("Content-Type", test.contentType)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			assert.Equal(t, http.StatusServiceUnavailable, w.Code)
+			assert.Equal(t, "1", w.Header().Get("Retry-After"))
+		})
+	}
+}
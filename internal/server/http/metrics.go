@@ -6,10 +6,14 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 
 	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+	render "github.com/zvfkjytytw/humay/internal/server/http/render"
+	humayTelemetry "github.com/zvfkjytytw/humay/internal/server/telemetry"
 )
 
 type contextKey int
@@ -27,7 +31,7 @@ func valueCtx(next http.Handler) http.Handler {
 		metricName := chi.URLParam(r, "metricName")
 
 		if err := checkMetricName(metricType, metricName); err != nil {
-			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			hm.WriteMetricError(w, http.StatusBadRequest, metricName, err.Error())
 			return
 		}
 		ctx := context.WithValue(r.Context(), contextMetricType, metricType)
@@ -39,30 +43,30 @@ func valueCtx(next http.Handler) http.Handler {
 func (h *HTTPServer) getValue(w http.ResponseWriter, r *http.Request) {
 	metricType := fmt.Sprintf("%v", r.Context().Value(contextMetricType))
 	metricName := fmt.Sprintf("%v", r.Context().Value(contextMetricName))
-	var value string
+	metric := &httpModels.Metric{ID: metricName, MType: metricType}
 
 	if metricType == httpModels.GaugeMetric {
-		v, err := h.storage.GetGaugeMetric(metricName)
+		v, err := h.store(r).GetGaugeMetric(metricName)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("%v", err), http.StatusNotFound)
+			hm.WriteMetricError(w, http.StatusNotFound, metricName, err.Error())
 			return
 		}
-		value = strconv.FormatFloat(v, 'f', -1, 64)
+		metric.Value = &v
 	}
 
 	if metricType == httpModels.CounterMetric {
-		v, err := h.storage.GetCounterMetric(metricName)
+		v, err := h.store(r).GetCounterMetric(metricName)
 		if err != nil {
-			http.Error(w, fmt.Sprintf("%v", err), http.StatusNotFound)
+			hm.WriteMetricError(w, http.StatusNotFound, metricName, err.Error())
 			return
 		}
-		value = strconv.FormatInt(v, 10)
+		metric.Delta = &v
 	}
 
-	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Header().Set("HashKey", h.hashKey)
-	w.WriteHeader(http.StatusOK)
-	w.Write([]byte(value))
+	// plain value unless the other format is asked.
+	if err := render.Metric(w, r, render.Text, metric); err != nil {
+		h.logger.Sugar().Errorf("failed render metric %s: %v", metricName, err)
+	}
 }
 
 // checking URL path for correctness of the conditions for saving the metric.
@@ -73,11 +77,15 @@ func updateCtx(next http.Handler) http.Handler {
 		metricValue := chi.URLParam(r, "metricValue")
 
 		if err := checkUpdateContext(metricType, metricValue); err != nil {
-			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			hm.WriteMetricError(w, http.StatusBadRequest, metricName, err.Error())
 			return
 		}
 		if err := checkMetricName(metricType, metricName); err != nil {
-			http.Error(w, fmt.Sprintf("%v", err), http.StatusBadRequest)
+			hm.WriteMetricError(w, http.StatusBadRequest, metricName, err.Error())
+			return
+		}
+		if strings.HasPrefix(metricName, humayTelemetry.ReservedPrefix) {
+			hm.WriteMetricError(w, http.StatusBadRequest, metricName, fmt.Sprintf("prefix %s is reserved for the server", humayTelemetry.ReservedPrefix))
 			return
 		}
 		ctx := context.WithValue(r.Context(), contextMetricType, metricType)
@@ -91,28 +99,39 @@ func (h *HTTPServer) putValue(w http.ResponseWriter, r *http.Request) {
 	metricType := fmt.Sprintf("%v", r.Context().Value(contextMetricType))
 	metricName := fmt.Sprintf("%v", r.Context().Value(contextMetricName))
 	metricValue := fmt.Sprintf("%v", r.Context().Value(contextMetricValue))
-
+	metric := &httpModels.Metric{ID: metricName, MType: metricType}
 	if metricType == httpModels.GaugeMetric {
 		value, _ := strconv.ParseFloat(metricValue, 64) //nolint // wraped in checkUpdateContext
-		err := h.storage.PutGaugeMetric(metricName, value)
+		metric.Value = &value
+	}
+	if metricType == httpModels.CounterMetric {
+		value, _ := strconv.ParseInt(metricValue, 10, 64) //nolint // wraped in checkUpdateContext
+		metric.Delta = &value
+	}
+	if apiError := h.ingest(metric); apiError != nil {
+		hm.WriteErrorBody(w, http.StatusBadRequest, apiError)
+		return
+	}
+	metricName = metric.ID
+	h.annotate(r, metric)
+
+	if metricType == httpModels.GaugeMetric {
+		err := h.store(r).PutGaugeMetric(metricName, *metric.Value)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("failed saved metric %s", metricName)))
+			hm.WriteMetricError(w, saveStatus(w, err), metricName, fmt.Sprintf("failed saved metric %s", metricName))
 			return
 		}
 	}
 	if metricType == httpModels.CounterMetric {
-		value, _ := strconv.ParseInt(metricValue, 10, 64) //nolint // wraped in checkUpdateContext
-		err := h.storage.PutCounterMetric(metricName, value)
+		err := h.store(r).PutCounterMetric(metricName, *metric.Delta)
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(fmt.Sprintf("failed saved metric %s", metricName)))
+			hm.WriteMetricError(w, saveStatus(w, err), metricName, fmt.Sprintf("failed saved metric %s", metricName))
 			return
 		}
 	}
+	h.putDerived(r, metric)
 
 	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
-	w.Header().Set("HashKey", h.hashKey)
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte(fmt.Sprintf("metric %s saved", metricName)))
 }
@@ -53,6 +53,14 @@ func (m *mockStorage) GetAllMetrics() map[string]map[string]string {
 	return nil
 }
 
+func (m *mockStorage) DumpMetrics() (map[string]float64, map[string]int64, error) {
+	return map[string]float64{}, map[string]int64{}, nil
+}
+
+func (m *mockStorage) ReplaceMetrics(map[string]float64, map[string]int64) error {
+	return nil
+}
+
 func (m *mockStorage) CheckDBConnect() error {
 	return nil
 }
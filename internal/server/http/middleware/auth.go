@@ -0,0 +1,93 @@
+package humayhttpmiddleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.uber.org/zap"
+
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+)
+
+type identityKey struct{}
+
+// identity is put into the request context by Logging and filled by Authorize,
+// so the access log knows who made the request.
+type identity struct {
+	id   string
+	name string
+}
+
+func withIdentity(r *http.Request) (*http.Request, *identity) {
+	id := &identity{}
+	return r.WithContext(context.WithValue(r.Context(), identityKey{}, id)), id
+}
+
+func setIdentity(r *http.Request, token *humayAuth.Token) {
+	if id, ok := r.Context().Value(identityKey{}).(*identity); ok {
+		id.id = token.ID
+		id.name = token.Name
+	}
+}
+
+// TokenName returns the name of the token which authorized the request.
+func TokenName(r *http.Request) string {
+	if id, ok := r.Context().Value(identityKey{}).(*identity); ok {
+		return id.name
+	}
+
+	return ""
+}
+
+func (i *identity) fields() []zap.Field {
+	if i.id == "" {
+		return nil
+	}
+
+	return []zap.Field{
+		zap.String("Token ID", i.id),
+		zap.String("Token Name", i.name),
+	}
+}
+
+// Authorize checks that the bearer token has the scope.
+// Nil authenticator disables the check.
+func Authorize(authenticator *humayAuth.Authenticator, scope string, logger *zap.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if authenticator == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			secret, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || secret == "" {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="humay"`)
+				WriteError(w, http.StatusUnauthorized, "absent bearer token")
+				return
+			}
+
+			token, err := authenticator.Authenticate(secret)
+			switch {
+			case errors.Is(err, humayAuth.ErrInvalidToken):
+				w.Header().Set("WWW-Authenticate", `Bearer realm="humay", error="invalid_token"`)
+				WriteError(w, http.StatusUnauthorized, "invalid token")
+				return
+			case err != nil:
+				logger.Sugar().Errorf("failed check token: %v", err)
+				WriteError(w, http.StatusInternalServerError, "failed check token")
+				return
+			}
+			setIdentity(r, token)
+
+			if !token.Allows(scope) {
+				WriteError(w, http.StatusForbidden, "token has no "+scope+" scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
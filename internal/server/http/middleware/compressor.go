@@ -2,6 +2,7 @@ package humayhttpmiddleware
 
 import (
 	"compress/gzip"
+	"mime"
 	"net/http"
 	"strings"
 )
@@ -25,13 +26,13 @@ func (w *compressedResponseWriter) Write(b []byte) (int, error) {
 func Compressor() func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			cType := r.Header.Get("Content-Type")
-			if cType == "application/json" || cType == "text/html" {
+			// parameters like charset do not change the body.
+			cType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if cType == "application/json" || cType == "application/x-ndjson" || cType == "text/html" {
 				if strings.Contains(r.Header.Get("Content-Encoding"), "gzip") {
 					gz, err := gzip.NewReader(r.Body)
 					if err != nil {
-						w.WriteHeader(http.StatusInternalServerError)
-						w.Write([]byte("failed read compressed body"))
+						WriteError(w, http.StatusInternalServerError, "failed read compressed body")
 						return
 					}
 					r.Body = gz
@@ -40,7 +41,8 @@ func Compressor() func(http.Handler) http.Handler {
 				w.Header().Set("Accept-Encoding", "gzip")
 			}
 
-			if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			// every event of the stream must reach the client at once.
+			if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") && !IsStream(r) {
 				w.Header().Set("Content-Encoding", "gzip")
 				w = &compressedResponseWriter{ResponseWriter: w}
 			}
@@ -0,0 +1,54 @@
+package humayhttpmiddleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+var statusCodes = map[int]string{
+	http.StatusBadRequest:            httpModels.CodeBadRequest,
+	http.StatusNotFound:              httpModels.CodeNotFound,
+	http.StatusMethodNotAllowed:      httpModels.CodeMethodNotAllowed,
+	http.StatusNotAcceptable:         httpModels.CodeNotAcceptable,
+	http.StatusUnauthorized:          httpModels.CodeUnauthorized,
+	http.StatusForbidden:             httpModels.CodeForbidden,
+	http.StatusRequestEntityTooLarge: httpModels.CodeTooLarge,
+	http.StatusTooManyRequests:       httpModels.CodeRateLimited,
+	http.StatusInternalServerError:   httpModels.CodeInternal,
+	http.StatusServiceUnavailable:    httpModels.CodeUnavailable,
+}
+
+// WriteError answers with the JSON error envelope, the code is chosen by the status.
+func WriteError(w http.ResponseWriter, status int, message string) {
+	WriteErrorBody(w, status, &httpModels.Error{Code: statusCode(status), Message: message})
+}
+
+// WriteMetricError answers with the error about the metric of the request.
+func WriteMetricError(w http.ResponseWriter, status int, metricID, message string) {
+	code := httpModels.CodeInvalidMetric
+	if status != http.StatusBadRequest {
+		code = statusCode(status)
+	}
+	WriteErrorBody(w, status, &httpModels.Error{Code: code, Message: message, MetricID: metricID})
+}
+
+func WriteErrorBody(w http.ResponseWriter, status int, apiError *httpModels.Error) {
+	body, _ := json.Marshal(apiError) //nolint // plain struct
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+func statusCode(status int) string {
+	if code, ok := statusCodes[status]; ok {
+		return code
+	}
+	if status >= http.StatusInternalServerError {
+		return httpModels.CodeInternal
+	}
+
+	return httpModels.CodeBadRequest
+}
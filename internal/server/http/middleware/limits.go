@@ -0,0 +1,149 @@
+package humayhttpmiddleware
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// idle buckets are full again, so they can be forgotten.
+const bucketIdleTimeout = 10 * time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// RateLimiter is a token bucket per client.
+// Clients are agents authorized by token or addresses of anonymous clients.
+type RateLimiter struct {
+	mx        sync.Mutex
+	rate      float64
+	burst     float64
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+// NewRateLimiter returns nil if rate is not positive, nil limiter passes everything.
+func NewRateLimiter(rate float64, burst int) *RateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = int(math.Ceil(rate))
+	}
+
+	return &RateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// allow takes a token from the client bucket or returns time until the next token.
+func (l *RateLimiter) allow(key string, now time.Time) (bool, time.Duration) {
+	l.mx.Lock()
+	defer l.mx.Unlock()
+
+	if now.Sub(l.lastPrune) > bucketIdleTimeout {
+		for k, b := range l.buckets {
+			if now.Sub(b.last) > bucketIdleTimeout {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastPrune = now
+	}
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	return false, time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+}
+
+// RateLimit answers 429 with Retry-After when the client spent its bucket.
+// Must be used after Authorize to limit agents by their tokens.
+func RateLimit(limiter *RateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limiter == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ok, wait := limiter.allow(clientKey(r), time.Now())
+			if !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				WriteError(w, http.StatusTooManyRequests, "too many requests")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func clientKey(r *http.Request) string {
+	if id, ok := r.Context().Value(identityKey{}).(*identity); ok && id.id != "" {
+		return "token:" + id.id
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
+
+// BodyLimit reads the body up to the limit and answers 413 if it is larger.
+// Must be used inside Compressor, so the limit applies to the decompressed body.
+func BodyLimit(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limit <= 0 || r.Body == nil || r.Body == http.NoBody {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if r.ContentLength > limit && r.Header.Get("Content-Encoding") == "" {
+				requestTooLarge(w, limit)
+				return
+			}
+
+			body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+			var maxBytesError *http.MaxBytesError
+			switch {
+			case errors.As(err, &maxBytesError):
+				requestTooLarge(w, limit)
+				return
+			case err != nil:
+				WriteError(w, http.StatusBadRequest, "failed read body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func requestTooLarge(w http.ResponseWriter, limit int64) {
+	w.Header().Set("Connection", "close")
+	WriteError(w, http.StatusRequestEntityTooLarge, "request body is larger than "+strconv.FormatInt(limit, 10)+" bytes")
+}
@@ -1,13 +1,16 @@
 package humayhttpmiddleware
 
 import (
+	"bufio"
 	// "bytes"
 	"fmt"
 	// "io"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
@@ -26,7 +29,7 @@ type (
 
 func (w *loggingResponseWriter) Write(b []byte) (int, error) {
 	size, err := w.ResponseWriter.Write(b)
-	w.responseData.answerSize = size
+	w.responseData.answerSize += size
 	// w.responseData.answerBody = string(b)
 	return size, err
 }
@@ -36,6 +39,21 @@ func (w *loggingResponseWriter) WriteHeader(statusCode int) {
 	w.responseData.statusCode = statusCode
 }
 
+// Unwrap lets http.ResponseController flush streams.
+func (w *loggingResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Hijack passes the connection to WebSocket.
+func (w *loggingResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	conn, rw, err := http.NewResponseController(w.ResponseWriter).Hijack()
+	if err == nil {
+		w.responseData.statusCode = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
 func Logging(logger *zap.Logger) func(http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -57,6 +75,7 @@ func Logging(logger *zap.Logger) func(http.Handler) http.Handler {
 			// requestBody := string(bodyBytes)
 			// r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
+			r, id := withIdentity(r)
 			lw := &loggingResponseWriter{
 				ResponseWriter: w,
 				responseData:   &responseData{},
@@ -74,8 +93,7 @@ func Logging(logger *zap.Logger) func(http.Handler) http.Handler {
 			// }
 
 			rDuration := time.Since(start).Nanoseconds()
-			logger.Info(
-				fmt.Sprintf("Request %v", rID),
+			fields := append([]zap.Field{
 				zap.String("Method", method),
 				zap.String("URI", uri),
 				// zap.String("Content-Type", cType),            // for debug
@@ -88,7 +106,11 @@ func Logging(logger *zap.Logger) func(http.Handler) http.Handler {
 				zap.Int("Response Code", lw.responseData.statusCode),
 				zap.Int("Response Length", lw.responseData.answerSize),
 				// zap.String("Response Body", lw.responseData.answerBody), // for debug
-			)
+			}, id.fields()...)
+			if spanContext := trace.SpanContextFromContext(r.Context()); spanContext.IsValid() {
+				fields = append(fields, zap.String("TraceID", spanContext.TraceID().String()))
+			}
+			logger.Info(fmt.Sprintf("Request %v", rID), fields...)
 		})
 	}
 }
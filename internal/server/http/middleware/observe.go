@@ -0,0 +1,52 @@
+package humayhttpmiddleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RequestObserver collects latency of answered requests.
+type RequestObserver interface {
+	ObserveRequest(route, method string, status int, duration time.Duration)
+}
+
+// Observe reports every request by its route pattern, so metric names and values don't multiply the series.
+func Observe(observer RequestObserver) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			lw := &loggingResponseWriter{
+				ResponseWriter: w,
+				responseData:   &responseData{},
+			}
+
+			next.ServeHTTP(lw, r)
+
+			status := lw.responseData.statusCode
+			if status == 0 {
+				status = http.StatusOK
+			}
+			observer.ObserveRequest(routePattern(r), r.Method, status, time.Since(start))
+		})
+	}
+}
+
+func routePattern(r *http.Request) string {
+	rctx := chi.RouteContext(r.Context())
+	if rctx == nil {
+		return "unmatched"
+	}
+
+	pattern := rctx.RoutePattern()
+	if pattern != "/" {
+		pattern = strings.TrimSuffix(pattern, "/")
+	}
+	if pattern == "" || pattern == "/*" {
+		return "unmatched"
+	}
+
+	return pattern
+}
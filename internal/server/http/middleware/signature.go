@@ -2,58 +2,187 @@ package humayhttpmiddleware
 
 import (
 	"bytes"
-	"fmt"
 	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	humayCommon "github.com/zvfkjytytw/humay/internal/common"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayTracing "github.com/zvfkjytytw/humay/internal/common/tracing"
 )
 
+const defaultMaxSkew = 5 * time.Minute
+
+// signingResponseWriter keeps the response until the handler ends,
+// because the signature header must be sent before the body.
 type signingResponseWriter struct {
 	http.ResponseWriter
-	hashKey string
+	statusCode int
+	body       bytes.Buffer
 }
 
 func (w *signingResponseWriter) Write(b []byte) (int, error) {
-	if w.hashKey != "" {
-		hash := fmt.Sprintf("%x", humayCommon.Hash256(b, w.hashKey))
-		w.ResponseWriter.Header().Set("HashSHA256", hash)
+	return w.body.Write(b)
+}
+
+func (w *signingResponseWriter) WriteHeader(statusCode int) {
+	if w.statusCode == 0 {
+		w.statusCode = statusCode
 	}
-	size, err := w.ResponseWriter.Write(b)
+}
 
-	return size, err
+// nonceCache remembers nonces of the signed requests while their timestamps are valid.
+type nonceCache struct {
+	mx        sync.Mutex
+	ttl       time.Duration
+	seen      map[string]time.Time
+	lastPrune time.Time
 }
 
-func Signature(hashKey string) func(http.Handler) http.Handler {
+func newNonceCache(ttl time.Duration) *nonceCache {
+	return &nonceCache{
+		ttl:  ttl,
+		seen: make(map[string]time.Time),
+	}
+}
+
+// add returns false if the nonce was already used.
+func (c *nonceCache) add(nonce string, now time.Time) bool {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	if now.Sub(c.lastPrune) > c.ttl/2 {
+		for n, expires := range c.seen {
+			if now.After(expires) {
+				delete(c.seen, n)
+			}
+		}
+		c.lastPrune = now
+	}
+
+	if expires, ok := c.seen[nonce]; ok && now.Before(expires) {
+		return false
+	}
+	c.seen[nonce] = now.Add(c.ttl)
+
+	return true
+}
+
+// Signature checks HMAC-SHA256 of the request and signs the response.
+// Stamped requests sign timestamp, nonce, method, path with query and body and are protected from replay.
+// Legacy requests sign only the body and can be replayed; strict mode rejects them,
+// writes are rejected too unless legacy is set.
+// Reads without a body may be unsigned unless the mode is strict or the route is for admins.
+// Must be used inside Compressor, so the plain body is signed.
+// The dashboard for browsers, streams and probes are not signed.
+func Signature(hashKey string, maxSkew time.Duration, strict, legacy bool) func(http.Handler) http.Handler {
+	if maxSkew <= 0 {
+		maxSkew = defaultMaxSkew
+	}
+	nonces := newNonceCache(2 * maxSkew)
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			// fmt.Printf("Hash Key: %s\n", hashKey)
-			if hashKey != "" && r.URL.Path != "/" {
-				requestBodyHash := r.Header.Get("HashSHA256")
-				if requestBodyHash == "" {
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte("absent body hash header"))
+			if hashKey == "" || unsigned(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// reading includes decompression of the body.
+			_, span := humayTracing.Tracer().Start(r.Context(), "read body")
+			bodyBytes, err := io.ReadAll(r.Body)
+			span.End()
+			if err != nil {
+				WriteError(w, http.StatusBadRequest, "failed read body")
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+
+			sign := r.Header.Get(humayCommon.SignatureHeader)
+			timestamp := r.Header.Get(humayCommon.TimestampHeader)
+			nonce := r.Header.Get(humayCommon.NonceHeader)
+			stamped := timestamp != "" || nonce != ""
+			write := isWrite(r)
+
+			switch {
+			case sign == "" && (strict || write || len(bodyBytes) > 0 || IsAdmin(r)):
+				WriteError(w, http.StatusBadRequest, "absent body hash header")
+				return
+			case sign == "":
+			case !stamped && (strict || write && !legacy):
+				WriteError(w, http.StatusBadRequest, "absent request timestamp and nonce")
+				return
+			case !stamped:
+				if !humayCommon.CheckSign(hashKey, sign, bodyBytes) {
+					WriteError(w, http.StatusBadRequest, "hashs not equal")
+					return
+				}
+			default:
+				if !humayCommon.CheckSign(hashKey, sign, bodyBytes, timestamp, nonce, r.Method, r.URL.RequestURI()) {
+					WriteError(w, http.StatusBadRequest, "hashs not equal")
+					return
+				}
+
+				now := time.Now()
+				if !checkTimestamp(timestamp, now, maxSkew) {
+					WriteError(w, http.StatusBadRequest, "request timestamp is out of range")
 					return
 				}
 
-				// read request body
-				bodyBytes, _ := io.ReadAll(r.Body)
-				hash := fmt.Sprintf("%x", humayCommon.Hash256(bodyBytes, hashKey))
-				if hash != requestBodyHash {
-					w.WriteHeader(http.StatusBadRequest)
-					w.Write([]byte("hashs not equal"))
+				if nonce == "" || !nonces.add(nonce, now) {
+					WriteError(w, http.StatusBadRequest, "request nonce is already used")
 					return
 				}
+			}
 
-				// rewrite body to request
-				r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+			sw := &signingResponseWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+
+			body := sw.body.Bytes()
+			if stamped {
+				respTimestamp := humayCommon.Timestamp(time.Now())
+				w.Header().Set(humayCommon.TimestampHeader, respTimestamp)
+				w.Header().Set(humayCommon.NonceHeader, nonce)
+				w.Header().Set(humayCommon.SignatureHeader, humayCommon.Sign(hashKey, body, respTimestamp, nonce))
+			} else {
+				w.Header().Set(humayCommon.SignatureHeader, humayCommon.Sign(hashKey, body))
 			}
 
-			sw := &signingResponseWriter{
-				ResponseWriter: w,
-				hashKey:        hashKey,
+			if sw.statusCode != 0 {
+				w.WriteHeader(sw.statusCode)
 			}
-			next.ServeHTTP(sw, r)
+			w.Write(body)
 		})
 	}
 }
+
+// unsigned reports whether the request is a read of the dashboard, the stream or a probe.
+// It depends only on the route, headers of the client can't skip the check.
+func unsigned(r *http.Request) bool {
+	if r.Method != http.MethodGet {
+		return false
+	}
+
+	return r.URL.Path == "/" ||
+		strings.HasPrefix(r.URL.Path, DashboardPrefix) ||
+		r.URL.Path == httpModels.StreamHandler ||
+		IsProbe(r)
+}
+
+// isWrite reports whether the request may change the data.
+func isWrite(r *http.Request) bool {
+	return r.Method != http.MethodGet && r.Method != http.MethodHead
+}
+
+func checkTimestamp(timestamp string, now time.Time, maxSkew time.Duration) bool {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	skew := now.Sub(time.Unix(seconds, 0))
+	return skew <= maxSkew && skew >= -maxSkew
+}
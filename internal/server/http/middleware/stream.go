@@ -0,0 +1,29 @@
+package humayhttpmiddleware
+
+import (
+	"net/http"
+	"strings"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+// DashboardPrefix is the path of the dashboard for browsers.
+const DashboardPrefix = "/dashboard"
+
+// IsStream reports whether the request asks for the event stream or WebSocket,
+// its answer can't be buffered by the middlewares.
+func IsStream(r *http.Request) bool {
+	return r.URL.Path == httpModels.StreamHandler ||
+		strings.Contains(r.Header.Get("Accept"), "text/event-stream") ||
+		strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
+
+// IsAdmin reports whether the request is for the admin or debug handlers.
+func IsAdmin(r *http.Request) bool {
+	return strings.HasPrefix(r.URL.Path, httpModels.AdminHandler+"/") || strings.HasPrefix(r.URL.Path, "/debug/")
+}
+
+// IsProbe reports whether the request is a liveness or readiness probe.
+func IsProbe(r *http.Request) bool {
+	return r.URL.Path == httpModels.HealthzHandler || r.URL.Path == httpModels.ReadyzHandler
+}
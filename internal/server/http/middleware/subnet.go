@@ -0,0 +1,80 @@
+package humayhttpmiddleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+)
+
+// TrustedSubnet holds the subnet of agents, it can be changed while the server runs.
+type TrustedSubnet struct {
+	subnet atomic.Pointer[net.IPNet]
+}
+
+// NewTrustedSubnet parses the CIDR, empty CIDR trusts everybody.
+func NewTrustedSubnet(cidr string) (*TrustedSubnet, error) {
+	t := &TrustedSubnet{}
+	if err := t.Set(cidr); err != nil {
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Set replaces the subnet.
+func (t *TrustedSubnet) Set(cidr string) error {
+	if cidr == "" {
+		t.subnet.Store(nil)
+		return nil
+	}
+
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return fmt.Errorf("invalid trusted subnet %q: %v", cidr, err)
+	}
+	t.subnet.Store(subnet)
+
+	return nil
+}
+
+// String returns the CIDR of the subnet.
+func (t *TrustedSubnet) String() string {
+	if subnet := t.subnet.Load(); subnet != nil {
+		return subnet.String()
+	}
+
+	return ""
+}
+
+// contains reports whether the request comes from the subnet.
+// Only the address of the connection is checked, headers are set by the client and can not be trusted.
+func (t *TrustedSubnet) contains(r *http.Request) bool {
+	subnet := t.subnet.Load()
+	if subnet == nil {
+		return true
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return false
+	}
+	ip := net.ParseIP(host)
+
+	return ip != nil && subnet.Contains(ip)
+}
+
+// Subnet answers 403 to requests from outside of the trusted subnet.
+// Nil subnet passes everything.
+func Subnet(trusted *TrustedSubnet) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if trusted != nil && !trusted.contains(r) {
+				WriteError(w, http.StatusForbidden, "address is not in the trusted subnet")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,54 @@
+package humayhttpmiddleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5/middleware"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
+
+	humayTracing "github.com/zvfkjytytw/humay/internal/common/tracing"
+)
+
+// Trace continues the trace of the caller or starts a new one for every request.
+// Must be used after RequestID, the request id is recorded in the span.
+func Trace() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := humayTracing.Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := humayTracing.Tracer().Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(
+					attribute.String("http.request.method", r.Method),
+					attribute.String("url.path", r.URL.Path),
+					attribute.String("http.request_id", middleware.GetReqID(r.Context())),
+				),
+			)
+			defer span.End()
+
+			lw := &loggingResponseWriter{
+				ResponseWriter: w,
+				responseData:   &responseData{},
+			}
+
+			next.ServeHTTP(lw, r.WithContext(ctx))
+
+			status := lw.responseData.statusCode
+			if status == 0 {
+				status = http.StatusOK
+			}
+			route := routePattern(r)
+			span.SetName(fmt.Sprintf("%s %s", r.Method, route))
+			span.SetAttributes(
+				attribute.String("http.route", route),
+				attribute.Int("http.response.status_code", status),
+			)
+			if status >= http.StatusInternalServerError {
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+		})
+	}
+}
@@ -0,0 +1,291 @@
+package humayhttpserver
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"gopkg.in/yaml.v3"
+
+	humayAPI "github.com/zvfkjytytw/humay/api"
+	agentHTTP "github.com/zvfkjytytw/humay/internal/agent/http"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+	humayHealth "github.com/zvfkjytytw/humay/internal/server/health"
+	humayHistory "github.com/zvfkjytytw/humay/internal/server/history"
+	humayHub "github.com/zvfkjytytw/humay/internal/server/hub"
+	humayRollup "github.com/zvfkjytytw/humay/internal/server/rollup"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+	humayClient "github.com/zvfkjytytw/humay/pkg/client"
+)
+
+type openAPISchema struct {
+	Properties map[string]any  `yaml:"properties"`
+	AllOf      []openAPISchema `yaml:"allOf"`
+	Ref        string          `yaml:"$ref"`
+}
+
+type openAPIOperation struct {
+	RequestBody struct {
+		Content map[string]any `yaml:"content"`
+	} `yaml:"requestBody"`
+}
+
+type openAPIDocument struct {
+	Paths      map[string]map[string]openAPIOperation `yaml:"paths"`
+	Components struct {
+		Schemas map[string]openAPISchema `yaml:"schemas"`
+	} `yaml:"components"`
+}
+
+func loadOpenAPI(t *testing.T) *openAPIDocument {
+	t.Helper()
+	doc := &openAPIDocument{}
+	require.NoError(t, yaml.Unmarshal(humayAPI.OpenAPI, doc))
+
+	return doc
+}
+
+// properties of the schema including the referenced ones.
+func (d *openAPIDocument) properties(name string) []string {
+	var names []string
+	var collect func(schema openAPISchema)
+	collect = func(schema openAPISchema) {
+		if schema.Ref != "" {
+			collect(d.Components.Schemas[strings.TrimPrefix(schema.Ref, "#/components/schemas/")])
+		}
+		for property := range schema.Properties {
+			names = append(names, property)
+		}
+		for _, part := range schema.AllOf {
+			collect(part)
+		}
+	}
+	collect(d.Components.Schemas[name])
+	sort.Strings(names)
+
+	return names
+}
+
+// operation of the documented path matching the request path.
+func (d *openAPIDocument) operation(method, path string) (openAPIOperation, bool) {
+	param := regexp.MustCompile(`\{[^}]+\}`)
+	for template, operations := range d.Paths {
+		parts := param.Split(template, -1)
+		for i, part := range parts {
+			parts[i] = regexp.QuoteMeta(part)
+		}
+		pattern := "^" + strings.Join(parts, `[^/]+`) + "$"
+		if regexp.MustCompile(pattern).MatchString(path) {
+			operation, ok := operations[strings.ToLower(method)]
+			return operation, ok
+		}
+	}
+
+	return openAPIOperation{}, false
+}
+
+func jsonFields(v any) []string {
+	var names []string
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		if t.Kind() == reflect.Pointer {
+			t = t.Elem()
+		}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if field.Anonymous {
+				collect(field.Type)
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name != "" && name != "-" {
+				names = append(names, name)
+			}
+		}
+	}
+	collect(reflect.TypeOf(v))
+	sort.Strings(names)
+
+	return names
+}
+
+func TestOpenAPIRoutes(t *testing.T) {
+	doc := loadOpenAPI(t)
+	h := &HTTPServer{storage: &mockStorage{}, logger: zap.NewNop()}
+
+	// stubs answer not found and are not a part of the API.
+	stubs := map[string]bool{
+		"GET /update/{metricType}/{metricName}/{metricValue}": true,
+		"POST /value/{metricType}/{metricName}":               true,
+	}
+
+	routes := make(map[string]bool)
+	err := chi.Walk(h.newRouter(), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		if strings.HasSuffix(route, "/*") {
+			return nil
+		}
+		if route != "/" {
+			route = strings.TrimSuffix(route, "/")
+		}
+		if key := method + " " + route; !stubs[key] {
+			routes[key] = true
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	documented := make(map[string]bool)
+	for path, operations := range doc.Paths {
+		for method := range operations {
+			documented[strings.ToUpper(method)+" "+path] = true
+		}
+	}
+
+	assert.Equal(t, documented, routes)
+}
+
+func TestOpenAPIModels(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	tests := []struct {
+		schema string
+		model  any
+		hidden []string
+	}{
+		{schema: "Metric", model: httpModels.Metric{}},
+		{schema: "MetricResult", model: httpModels.MetricResult{}},
+		{schema: "Error", model: httpModels.Error{}},
+		{schema: "TokenRequest", model: tokenRequest{}},
+		{schema: "Token", model: humayAuth.Token{}, hidden: []string{"secret_hash"}},
+		{schema: "IssuedToken", model: tokenResponse{}, hidden: []string{"secret_hash"}},
+		{schema: "SnapshotImportResult", model: snapshotImportResult{}},
+		{schema: "Series", model: humayHistory.Series{}},
+		{schema: "Sample", model: humayHistory.Sample{}},
+		{schema: "Range", model: humayRollup.Range{}},
+		{schema: "Point", model: humayRollup.Point{}},
+		{schema: "Event", model: humayHub.Event{}},
+		{schema: "HealthReport", model: humayHealth.Report{}},
+		{schema: "HealthCheck", model: humayHealth.Result{}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.schema, func(t *testing.T) {
+			var fields []string
+			for _, field := range jsonFields(test.model) {
+				if !contains(test.hidden, field) {
+					fields = append(fields, field)
+				}
+			}
+			assert.Equal(t, fields, doc.properties(test.schema))
+		})
+	}
+}
+
+func TestOpenAPIAgentClient(t *testing.T) {
+	doc := loadOpenAPI(t)
+
+	var mx sync.Mutex
+	var requests []*http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mx.Lock()
+		requests = append(requests, r)
+		mx.Unlock()
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, err := agentHTTP.NewClient(strings.TrimPrefix(server.URL, "http://"), zap.NewNop(), "")
+	require.NoError(t, err)
+	defer client.Stop()
+
+	value := 1.5
+	assert.NoError(t, client.UpdateGauge("Alloc", value))
+	assert.NoError(t, client.UpdateCounter("PollCount", 1))
+	assert.NoError(t, client.UpdateJSONGauge("Alloc", value))
+	assert.NoError(t, client.UpdateJSONMetrics([]*httpModels.Metric{{ID: "Alloc", MType: httpModels.GaugeMetric, Value: &value}}))
+
+	require.NotEmpty(t, requests)
+	for _, r := range requests {
+		operation, ok := doc.operation(r.Method, r.URL.Path)
+		if !assert.True(t, ok, "%s %s is not documented", r.Method, r.URL.Path) {
+			continue
+		}
+
+		contentType := r.Header.Get("Content-Type")
+		if len(operation.RequestBody.Content) > 0 {
+			_, ok = operation.RequestBody.Content[contentType]
+			assert.True(t, ok, "%s %s: content type %s is not documented", r.Method, r.URL.Path, contentType)
+		}
+	}
+}
+
+func TestOpenAPIPublicClient(t *testing.T) {
+	doc := loadOpenAPI(t)
+	h := &HTTPServer{
+		storage: humayStorage.NewStorage(t.TempDir()+"/metrics.json", ""),
+		logger:  zap.NewNop(),
+		hashKey: "key",
+	}
+	router := h.newRouter()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, ok := doc.operation(r.Method, r.URL.Path)
+		assert.True(t, ok, "%s %s is not documented", r.Method, r.URL.Path)
+		router.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	client, err := humayClient.New(server.URL, humayClient.WithHashKey("key"), humayClient.WithRetries(0, 0, 0))
+	require.NoError(t, err)
+	defer client.Close()
+	ctx := context.Background()
+
+	assert.NoError(t, client.PushGauge(ctx, "Alloc", 1.5))
+	sum, err := client.PushCounter(ctx, "PollCount", 2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), sum)
+
+	results, err := client.Push(ctx, []humayClient.Metric{
+		humayClient.NewCounter("PollCount", 3),
+		{ID: "Broken", MType: humayClient.Gauge},
+	})
+	var apiError *humayClient.Error
+	assert.ErrorAs(t, err, &apiError)
+	assert.Equal(t, http.StatusMultiStatus, apiError.Status)
+	require.Len(t, results, 2)
+	assert.Equal(t, int64(5), *results[0].Delta)
+	assert.Equal(t, "Broken", results[1].Error.MetricID)
+
+	value, err := client.Gauge(ctx, "Alloc")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, value)
+
+	_, err = client.Counter(ctx, "Unknown")
+	assert.ErrorAs(t, err, &apiError)
+	assert.Equal(t, http.StatusNotFound, apiError.Status)
+	assert.Equal(t, httpModels.CodeNotFound, apiError.Code)
+
+	metrics, err := client.List(ctx)
+	assert.NoError(t, err)
+	assert.Equal(t, []humayClient.Metric{humayClient.NewCounter("PollCount", 5), humayClient.NewGauge("Alloc", 1.5)}, metrics)
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
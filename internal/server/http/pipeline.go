@@ -0,0 +1,63 @@
+package humayhttpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayPipeline "github.com/zvfkjytytw/humay/internal/server/pipeline"
+	humayTelemetry "github.com/zvfkjytytw/humay/internal/server/telemetry"
+)
+
+// SetPipeline sets processing of written metrics. Must be called before Start.
+func (h *HTTPServer) SetPipeline(pipeline *humayPipeline.Pipeline) {
+	h.pipeline = pipeline
+}
+
+// ingest validates the metric and passes it through the pipeline, every write handler calls it.
+func (h *HTTPServer) ingest(metric *httpModels.Metric) *httpModels.Error {
+	if apiError := validateMetric(metric); apiError != nil {
+		return apiError
+	}
+	if err := h.pipeline.Process(metric); err != nil {
+		return &httpModels.Error{Code: httpModels.CodeInvalidMetric, Message: err.Error(), MetricID: metric.ID}
+	}
+	// the pipeline may turn the name into a reserved one.
+	if strings.HasPrefix(metric.ID, humayTelemetry.ReservedPrefix) {
+		return &httpModels.Error{
+			Code:     httpModels.CodeInvalidMetric,
+			Message:  fmt.Sprintf("prefix %s is reserved for the server", humayTelemetry.ReservedPrefix),
+			MetricID: metric.ID,
+		}
+	}
+
+	return nil
+}
+
+// derive returns gauges derived from the written metrics by the pipeline.
+func (h *HTTPServer) derive(r *http.Request, metrics ...*httpModels.Metric) map[string]float64 {
+	derived := h.pipeline.Derive(metrics, h.store(r))
+	if len(derived) == 0 {
+		return nil
+	}
+
+	gauges := make(map[string]float64, len(derived))
+	for _, metric := range derived {
+		gauges[metric.ID] = *metric.Value
+	}
+
+	return gauges
+}
+
+// putDerived saves gauges derived from the written metrics, failures are only logged.
+func (h *HTTPServer) putDerived(r *http.Request, metrics ...*httpModels.Metric) {
+	gauges := h.derive(r, metrics...)
+	if len(gauges) == 0 {
+		return
+	}
+
+	if err := h.store(r).PutGaugeMetrics(gauges); err != nil {
+		h.logger.Sugar().Errorf("failed save derived metrics: %v", err)
+	}
+}
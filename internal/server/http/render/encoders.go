@@ -0,0 +1,171 @@
+package humayhttprender
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/encoding/protowire"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+// one metric is the JSON object, the list is the JSON array.
+func encodeJSON(buf *bytes.Buffer, metrics []*httpModels.Metric, single bool) error {
+	var body []byte
+	var err error
+	if single {
+		body, err = json.Marshal(metrics[0])
+	} else {
+		body, err = json.Marshal(metrics)
+	}
+	if err != nil {
+		return err
+	}
+	buf.Write(body)
+
+	return nil
+}
+
+// one metric is the bare value, the list is "type name value" per line.
+func encodeText(buf *bytes.Buffer, metrics []*httpModels.Metric, single bool) error {
+	if single {
+		buf.WriteString(value(metrics[0]))
+		return nil
+	}
+	for _, metric := range metrics {
+		fmt.Fprintf(buf, "%s %s %s\n", metric.MType, metric.ID, value(metric))
+	}
+
+	return nil
+}
+
+// the text exposition format of Prometheus.
+func encodePrometheus(buf *bytes.Buffer, metrics []*httpModels.Metric, _ bool) error {
+	for _, metric := range metrics {
+		name := prometheusName(metric.ID)
+		v := value(metric)
+		if metric.Value != nil {
+			v = prometheusFloat(*metric.Value)
+		}
+		fmt.Fprintf(buf, "# TYPE %s %s\n%s%s %s\n", name, metric.MType, name, prometheusLabels(metric.Labels), v)
+	}
+
+	return nil
+}
+
+// labels sorted by name in braces.
+func prometheusLabels(labels map[string]string) string {
+	if len(labels) == 0 {
+		return ""
+	}
+
+	pairs := make([]string, 0, len(labels))
+	for _, name := range sortedKeys(labels) {
+		pairs = append(pairs, fmt.Sprintf("%s=%s", prometheusName(name), strconv.Quote(labels[name])))
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func sortedKeys(labels map[string]string) []string {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
+
+// replace the characters which are not allowed in the Prometheus metric name.
+func prometheusName(id string) string {
+	name := strings.Map(func(r rune) rune {
+		if r == '_' || r == ':' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, id)
+	if name == "" || (name[0] >= '0' && name[0] <= '9') {
+		name = "_" + name
+	}
+
+	return name
+}
+
+func prometheusFloat(v float64) string {
+	switch {
+	case math.IsNaN(v):
+		return "NaN"
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+
+	return value(&httpModels.Metric{Value: &v})
+}
+
+// the header and one row per metric.
+func encodeCSV(buf *bytes.Buffer, metrics []*httpModels.Metric, _ bool) error {
+	writer := csv.NewWriter(buf)
+	if err := writer.Write([]string{"id", "type", "value"}); err != nil {
+		return err
+	}
+	for _, metric := range metrics {
+		if err := writer.Write([]string{metric.ID, metric.MType, value(metric)}); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// the messages Metric and Metrics of api/metrics.proto.
+func encodeProtobuf(buf *bytes.Buffer, metrics []*httpModels.Metric, single bool) error {
+	if single {
+		buf.Write(appendProtoMetric(nil, metrics[0]))
+		return nil
+	}
+
+	var body []byte
+	for _, metric := range metrics {
+		body = protowire.AppendTag(body, 1, protowire.BytesType)
+		body = protowire.AppendBytes(body, appendProtoMetric(nil, metric))
+	}
+	buf.Write(body)
+
+	return nil
+}
+
+func appendProtoMetric(b []byte, metric *httpModels.Metric) []byte {
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, metric.ID)
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, metric.MType)
+	if metric.Delta != nil {
+		b = protowire.AppendTag(b, 3, protowire.VarintType)
+		b = protowire.AppendVarint(b, uint64(*metric.Delta))
+	}
+	if metric.Value != nil {
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(*metric.Value))
+	}
+	for _, name := range sortedKeys(metric.Labels) {
+		var entry []byte
+		entry = protowire.AppendTag(entry, 1, protowire.BytesType)
+		entry = protowire.AppendString(entry, name)
+		entry = protowire.AppendTag(entry, 2, protowire.BytesType)
+		entry = protowire.AppendString(entry, metric.Labels[name])
+		b = protowire.AppendTag(b, 5, protowire.BytesType)
+		b = protowire.AppendBytes(b, entry)
+	}
+
+	return b
+}
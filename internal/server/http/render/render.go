@@ -0,0 +1,164 @@
+package humayhttprender
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+)
+
+// Format is the representation of metrics in the response.
+type Format int
+
+const (
+	JSON Format = iota
+	Text
+	Prometheus
+	CSV
+	Protobuf
+)
+
+const (
+	contentTypeJSON       = "application/json"
+	contentTypeText       = "text/plain; charset=utf-8"
+	contentTypePrometheus = "text/plain; version=0.0.4; charset=utf-8"
+	contentTypeCSV        = "text/csv; charset=utf-8"
+	contentTypeProtobuf   = "application/x-protobuf"
+)
+
+var contentTypes = map[Format]string{
+	JSON:       contentTypeJSON,
+	Text:       contentTypeText,
+	Prometheus: contentTypePrometheus,
+	CSV:        contentTypeCSV,
+	Protobuf:   contentTypeProtobuf,
+}
+
+// encoder writes one metric or the list of metrics to the buffer.
+type encoder func(buf *bytes.Buffer, metrics []*httpModels.Metric, single bool) error
+
+var encoders = map[Format]encoder{
+	JSON:       encodeJSON,
+	Text:       encodeText,
+	Prometheus: encodePrometheus,
+	CSV:        encodeCSV,
+	Protobuf:   encodeProtobuf,
+}
+
+// Metric answers with the metric in the format chosen by the Accept header of the request,
+// fallback is used when any format is acceptable.
+func Metric(w http.ResponseWriter, r *http.Request, fallback Format, metric *httpModels.Metric) error {
+	return render(w, r, fallback, []*httpModels.Metric{metric}, true)
+}
+
+// Metrics answers with the list of metrics in the format chosen by the Accept header of the request.
+func Metrics(w http.ResponseWriter, r *http.Request, fallback Format, metrics []*httpModels.Metric) error {
+	return render(w, r, fallback, metrics, false)
+}
+
+func render(w http.ResponseWriter, r *http.Request, fallback Format, metrics []*httpModels.Metric, single bool) error {
+	w.Header().Add("Vary", "Accept")
+
+	format, ok := Negotiate(r.Header.Get("Accept"), fallback)
+	if !ok {
+		hm.WriteError(w, http.StatusNotAcceptable, "unsupported Accept. Expect application/json, text/plain, text/csv or application/x-protobuf")
+		return nil
+	}
+
+	buf := &bytes.Buffer{}
+	if err := encoders[format](buf, metrics, single); err != nil {
+		hm.WriteError(w, http.StatusInternalServerError, "failed encode metrics")
+		return fmt.Errorf("failed encode metrics: %v", err)
+	}
+
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.WriteHeader(http.StatusOK)
+	w.Write(buf.Bytes())
+
+	return nil
+}
+
+type mediaRange struct {
+	mediaType string
+	params    map[string]string
+	quality   float64
+}
+
+// Negotiate chooses the format by the Accept header.
+// The header without any known media type gives false.
+func Negotiate(accept string, fallback Format) (Format, bool) {
+	if strings.TrimSpace(accept) == "" {
+		return fallback, true
+	}
+
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if quality <= 0 {
+			continue
+		}
+		ranges = append(ranges, mediaRange{mediaType: mediaType, params: params, quality: quality})
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].quality > ranges[j].quality
+	})
+
+	for _, rng := range ranges {
+		switch rng.mediaType {
+		case "*/*":
+			return fallback, true
+		case "application/*":
+			if fallback == JSON || fallback == Protobuf {
+				return fallback, true
+			}
+			return JSON, true
+		case "text/*":
+			if fallback == Text || fallback == Prometheus || fallback == CSV {
+				return fallback, true
+			}
+			return Text, true
+		case "application/json":
+			return JSON, true
+		case "text/plain":
+			if rng.params["version"] != "" {
+				return Prometheus, true
+			}
+			return Text, true
+		case "application/openmetrics-text":
+			return Prometheus, true
+		case "text/csv":
+			return CSV, true
+		case "application/x-protobuf", "application/protobuf", "application/vnd.google.protobuf":
+			return Protobuf, true
+		}
+	}
+
+	return fallback, false
+}
+
+// value returns the value of the metric as text.
+func value(metric *httpModels.Metric) string {
+	switch {
+	case metric.Delta != nil:
+		return strconv.FormatInt(*metric.Delta, 10)
+	case metric.Value != nil:
+		return strconv.FormatFloat(*metric.Value, 'f', -1, 64)
+	}
+
+	return ""
+}
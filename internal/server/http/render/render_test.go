@@ -0,0 +1,140 @@
+package humayhttprender
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/protobuf/encoding/protowire"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name     string
+		accept   string
+		fallback Format
+		format   Format
+		ok       bool
+	}{
+		{name: "empty", accept: "", fallback: Text, format: Text, ok: true},
+		{name: "any", accept: "*/*", fallback: JSON, format: JSON, ok: true},
+		{name: "json", accept: "application/json", fallback: Text, format: JSON, ok: true},
+		{name: "prometheus", accept: "text/plain; version=0.0.4", fallback: JSON, format: Prometheus, ok: true},
+		{name: "quality", accept: "text/csv;q=0.5, application/x-protobuf", fallback: JSON, format: Protobuf, ok: true},
+		{name: "browser", accept: "text/html,application/xhtml+xml,*/*;q=0.8", fallback: Text, format: Text, ok: true},
+		{name: "text family", accept: "text/*", fallback: JSON, format: Text, ok: true},
+		{name: "excluded", accept: "text/csv;q=0", fallback: JSON, ok: false},
+		{name: "unknown", accept: "image/png", fallback: JSON, ok: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			format, ok := Negotiate(test.accept, test.fallback)
+			assert.Equal(t, test.ok, ok)
+			if test.ok {
+				assert.Equal(t, test.format, format)
+			}
+		})
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	delta := int64(3)
+	value := 1.5
+	metrics := []*httpModels.Metric{
+		{ID: "PollCount", MType: httpModels.CounterMetric, Delta: &delta},
+		{ID: "Alloc.heap", MType: httpModels.GaugeMetric, Value: &value},
+	}
+
+	tests := []struct {
+		name        string
+		accept      string
+		status      int
+		contentType string
+		body        string
+	}{
+		{
+			name:        "json",
+			status:      http.StatusOK,
+			contentType: contentTypeJSON,
+			body:        `[{"id":"PollCount","type":"counter","delta":3},{"id":"Alloc.heap","type":"gauge","value":1.5}]`,
+		},
+		{
+			name:        "text",
+			accept:      "text/plain",
+			status:      http.StatusOK,
+			contentType: contentTypeText,
+			body:        "counter PollCount 3\ngauge Alloc.heap 1.5\n",
+		},
+		{
+			name:        "prometheus",
+			accept:      "text/plain;version=0.0.4",
+			status:      http.StatusOK,
+			contentType: contentTypePrometheus,
+			body:        "# TYPE PollCount counter\nPollCount 3\n# TYPE Alloc_heap gauge\nAlloc_heap 1.5\n",
+		},
+		{
+			name:        "csv",
+			accept:      "text/csv",
+			status:      http.StatusOK,
+			contentType: contentTypeCSV,
+			body:        "id,type,value\nPollCount,counter,3\nAlloc.heap,gauge,1.5\n",
+		},
+		{
+			name:        "not acceptable",
+			accept:      "image/png",
+			status:      http.StatusNotAcceptable,
+			contentType: "application/json",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/values", http.NoBody)
+			req.Header.Set("Accept", test.accept)
+			assert.NoError(t, Metrics(rw, req, JSON, metrics))
+			assert.Equal(t, test.status, rw.Code)
+			assert.Equal(t, test.contentType, rw.Header().Get("Content-Type"))
+			assert.Equal(t, "Accept", rw.Header().Get("Vary"))
+			if test.body != "" {
+				assert.Equal(t, test.body, rw.Body.String())
+			}
+		})
+	}
+}
+
+func TestMetricProtobuf(t *testing.T) {
+	value := 1.5
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/value/gauge/Alloc", http.NoBody)
+	req.Header.Set("Accept", "application/x-protobuf")
+	assert.NoError(t, Metric(rw, req, Text, &httpModels.Metric{ID: "Alloc", MType: httpModels.GaugeMetric, Value: &value}))
+	assert.Equal(t, contentTypeProtobuf, rw.Header().Get("Content-Type"))
+
+	fields := make(map[protowire.Number]any)
+	body := rw.Body.Bytes()
+	for len(body) > 0 {
+		num, typ, n := protowire.ConsumeTag(body)
+		require.Positive(t, n)
+		body = body[n:]
+		switch typ {
+		case protowire.BytesType:
+			v, n := protowire.ConsumeString(body)
+			require.Positive(t, n)
+			fields[num], body = v, body[n:]
+		case protowire.Fixed64Type:
+			v, n := protowire.ConsumeFixed64(body)
+			require.Positive(t, n)
+			fields[num], body = math.Float64frombits(v), body[n:]
+		default:
+			t.Fatalf("unexpected wire type %d", typ)
+		}
+	}
+	assert.Equal(t, map[protowire.Number]any{1: "Alloc", 2: "gauge", 4: 1.5}, fields)
+}
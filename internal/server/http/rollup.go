@@ -0,0 +1,79 @@
+package humayhttpserver
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+	humayRollup "github.com/zvfkjytytw/humay/internal/server/rollup"
+)
+
+// range of the query without from.
+const defaultRange = time.Hour
+
+// SetRollup sets the rollups of metrics read by ranges. Must be called before Start.
+func (h *HTTPServer) SetRollup(rollup *humayRollup.Rollup) {
+	h.rollup = rollup
+}
+
+// data of one metric between ?from and ?to, ?resolution overrides the one chosen by the range.
+func (h *HTTPServer) getRange(w http.ResponseWriter, r *http.Request) {
+	metricType := chi.URLParam(r, "metricType")
+	metricName := chi.URLParam(r, "metricName")
+	query := r.URL.Query()
+
+	to := time.Now()
+	if value := query.Get("to"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			hm.WriteError(w, http.StatusBadRequest, fmt.Sprintf("wrong to %s", value))
+			return
+		}
+		to = t
+	}
+	from := to.Add(-defaultRange)
+	if value := query.Get("from"); value != "" {
+		t, err := parseTime(value)
+		if err != nil {
+			hm.WriteError(w, http.StatusBadRequest, fmt.Sprintf("wrong from %s", value))
+			return
+		}
+		from = t
+	}
+	if !from.Before(to) {
+		hm.WriteError(w, http.StatusBadRequest, "from must be before to")
+		return
+	}
+
+	resolution := query.Get("resolution")
+	switch resolution {
+	case "", humayRollup.Raw, humayRollup.Minute, humayRollup.Hour:
+	default:
+		hm.WriteError(w, http.StatusBadRequest, fmt.Sprintf("unknown resolution %s", resolution))
+		return
+	}
+
+	if h.rollup == nil {
+		hm.WriteMetricError(w, http.StatusNotFound, metricName, fmt.Sprintf("metric %s not found", metricName))
+		return
+	}
+	result, ok := h.rollup.Query(metricType, metricName, from, to, resolution)
+	if !ok {
+		hm.WriteMetricError(w, http.StatusNotFound, metricName, fmt.Sprintf("metric %s not found", metricName))
+		return
+	}
+	h.writeJSON(w, http.StatusOK, result)
+}
+
+// parseTime accepts unix milliseconds or RFC 3339.
+func parseTime(value string) (time.Time, error) {
+	if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.UnixMilli(ms), nil
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
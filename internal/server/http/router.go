@@ -1,62 +1,137 @@
 package humayhttpserver
 
 import (
+	"expvar"
+	"fmt"
 	"net/http"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 
+	humayAPI "github.com/zvfkjytytw/humay/api"
 	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayLogging "github.com/zvfkjytytw/humay/internal/common/logging"
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
 	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
 )
 
+// prefix of the vars published by the server.
+const debugVarsPrefix = "humay_"
+
 func (h *HTTPServer) newRouter() chi.Router {
 	r := chi.NewRouter()
 
 	r.Use(middleware.StripSlashes)
 	r.Use(hm.Compressor())
 	r.Use(middleware.RequestID)
+	r.Use(hm.Trace())
+	// outside of the recoverer to count panics as server errors.
+	r.Use(hm.Observe(h.telemetry))
 	r.Use(middleware.Recoverer)
 	r.Use(hm.Logging(h.logger))
-	// r.Use(hm.Signature(h.hashKey))
-
-	// root handler.
-	r.Get("/", h.metricsPage)
+	r.Use(hm.BodyLimit(h.maxBodySize))
+	// request body is already decompressed and response is compressed after signing.
+	r.Use(hm.Signature(h.hashKey, h.signatureMaxSkew, h.signatureStrict, h.signatureLegacy))
 
 	// ping handler.
 	r.Get("/ping", func(w http.ResponseWriter, r *http.Request) {
-		err := h.storage.CheckDBConnect()
+		err := h.store(r).CheckDBConnect()
 		if err != nil {
 			h.logger.Sugar().Errorf("absent db connect: %v", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			hm.WriteError(w, http.StatusInternalServerError, "absent db connect")
 			return
 		}
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("pong"))
 	})
 
-	// handler for update metric in text/plain content-type.
-	r.Route("/update/{metricType}/{metricName}/{metricValue}", func(r chi.Router) {
-		r.Use(updateCtx)
-		r.Post("/", h.putValue)
-		r.Get("/", notImplementedYet)
-	})
+	// probes of a supervisor or Kubernetes.
+	r.Get(httpModels.HealthzHandler, h.healthz)
+	r.Get(httpModels.ReadyzHandler, h.readyz)
 
-	// handler for get value of metric in text/plain content-type.
-	r.Route("/value/{metricType}/{metricName}", func(r chi.Router) {
-		r.Use(valueCtx)
-		r.Get("/", h.getValue)
-		r.Post("/", notImplementedYet)
+	// description of the API.
+	r.Get("/openapi.yaml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/yaml")
+		w.WriteHeader(http.StatusOK)
+		w.Write(humayAPI.OpenAPI)
 	})
 
-	// handlers for application/json content-type.
+	// page, scripts and styles of the dashboard, the page asks for the token to load the data.
+	r.Get("/", h.dashboardPage)
+	r.Get(hm.DashboardPrefix+"/static/*", dashboardStatic().ServeHTTP)
+
+	// handlers for agents.
 	r.Group(func(r chi.Router) {
+		r.Use(hm.Subnet(h.trusted))
+		r.Use(hm.Authorize(h.auth, humayAuth.ScopeWrite, h.logger))
+		r.Use(hm.RateLimit(h.limiter))
+
+		// handler for update metric in text/plain content-type.
+		r.Route("/update/{metricType}/{metricName}/{metricValue}", func(r chi.Router) {
+			r.Use(updateCtx)
+			r.Post("/", h.putValue)
+			r.Get("/", notImplementedYet)
+		})
+
+		// handler for application/json content-type.
 		r.Post(httpModels.UpdateHandler, h.putJSONValue)
+
+		// handler for saving many metrics
+		r.Post(httpModels.UpdatesHandler, h.putJSONValues)
+	})
+
+	// handlers for dashboards.
+	r.Group(func(r chi.Router) {
+		r.Use(hm.Authorize(h.auth, humayAuth.ScopeRead, h.logger))
+		r.Use(hm.RateLimit(h.limiter))
+
+		// history of metrics for the dashboard.
+		r.Route(hm.DashboardPrefix, func(r chi.Router) {
+			r.Get("/series", h.listSeries)
+			r.Get("/series/{metricType}/{metricName}", h.getSeries)
+			r.Get("/range/{metricType}/{metricName}", h.getRange)
+		})
+
+		// written metrics as server-sent events or over WebSocket.
+		r.Get(httpModels.StreamHandler, h.streamMetrics)
+
+		// handler for get value of metric in text/plain content-type.
+		r.Route("/value/{metricType}/{metricName}", func(r chi.Router) {
+			r.Use(valueCtx)
+			r.Get("/", h.getValue)
+			r.Post("/", notImplementedYet)
+		})
+
+		// handlers for application/json content-type.
 		r.Post(httpModels.ValueHandler, h.getJSONValue)
+		r.Get(httpModels.ValuesHandler, h.getJSONValues)
+	})
+
+	// admin handlers.
+	r.Group(func(r chi.Router) {
+		r.Use(hm.Authorize(h.auth, humayAuth.ScopeAdmin, h.logger))
+		r.Use(hm.RateLimit(h.limiter))
+
+		// internal state of the server.
+		r.Get("/debug/vars", debugVars)
+		r.Get("/debug/metrics", h.debugMetrics)
+
+		r.Route(httpModels.AdminHandler, func(r chi.Router) {
+			r.Get("/log/level", h.logLevel)
+			r.Put("/log/level", h.logLevel)
+			r.Get("/snapshot", h.exportSnapshot)
+			r.Post("/snapshot", h.importSnapshot)
+			r.Get("/tokens", h.listTokens)
+			r.Post("/tokens", h.createToken)
+			r.Delete("/tokens/{tokenID}", h.deleteToken)
+		})
 	})
 
-	// handler for saving many metrics
-	r.Post(httpModels.UpdatesHandler, h.putJSONValues)
+	r.NotFound(notImplementedYet)
+	r.MethodNotAllowed(func(w http.ResponseWriter, r *http.Request) {
+		hm.WriteError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
 
 	// stubs.
 	r.Get("/*", notImplementedYet)
@@ -66,8 +141,40 @@ func (h *HTTPServer) newRouter() chi.Router {
 	return r
 }
 
+// metrics of the server itself in the Prometheus text format.
+func (h *HTTPServer) debugMetrics(w http.ResponseWriter, r *http.Request) {
+	if h.telemetry == nil {
+		hm.WriteError(w, http.StatusNotFound, "telemetry is disabled")
+		return
+	}
+
+	h.telemetry.Handler().ServeHTTP(w, r)
+}
+
+// published vars of the server only, the default cmdline and memstats reveal secrets of the flags.
+func debugVars(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write([]byte("{"))
+	first := true
+	expvar.Do(func(kv expvar.KeyValue) {
+		if !strings.HasPrefix(kv.Key, debugVarsPrefix) {
+			return
+		}
+		if !first {
+			w.Write([]byte(","))
+		}
+		first = false
+		fmt.Fprintf(w, "%q:%s", kv.Key, kv.Value)
+	})
+	w.Write([]byte("}"))
+}
+
+// level of all loggers, it is changed until restart or SIGHUP.
+func (h *HTTPServer) logLevel(w http.ResponseWriter, r *http.Request) {
+	humayLogging.LevelHandler().ServeHTTP(w, r)
+}
+
 // not implemented handlers.
 func notImplementedYet(w http.ResponseWriter, r *http.Request) {
-	w.WriteHeader(http.StatusNotFound)
-	w.Write([]byte("not implemented yet"))
+	hm.WriteError(w, http.StatusNotFound, "not implemented yet")
 }
@@ -2,47 +2,114 @@ package humayhttpserver
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net/http"
 	"time"
 
 	"go.uber.org/zap"
+
+	humayCommon "github.com/zvfkjytytw/humay/internal/common"
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+	humayHealth "github.com/zvfkjytytw/humay/internal/server/health"
+	humayHistory "github.com/zvfkjytytw/humay/internal/server/history"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+	humayHub "github.com/zvfkjytytw/humay/internal/server/hub"
+	humayPipeline "github.com/zvfkjytytw/humay/internal/server/pipeline"
+	humayRollup "github.com/zvfkjytytw/humay/internal/server/rollup"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+	humayTelemetry "github.com/zvfkjytytw/humay/internal/server/telemetry"
 )
 
-type Storage interface {
-	GetGaugeMetric(name string) (float64, error)
-	PutGaugeMetric(name string, value float64) error
-	PutGaugeMetrics(map[string]float64) error
-	GetCounterMetric(name string) (int64, error)
-	PutCounterMetric(name string, value int64) error
-	PutCounterMetrics(map[string]int64) error
-	GetAllMetrics() map[string]map[string]string
-	CheckDBConnect() error
-	GetType() string
-	Close() error
-}
+const (
+	defaultMaxBodySize  = 8 << 20
+	defaultMaxBatchSize = 10000
+)
 
 type HTTPConfig struct {
-	Host         string `yaml:"host"`
-	Port         int32  `yaml:"port"`
-	ReadTimeout  int32  `yaml:"read_timeout"`
-	WriteTimeout int32  `yaml:"write_timeout"`
-	IdleTimeout  int32  `yaml:"idle_timeout"`
-	HashKey      string `yaml:"hash_key"`
+	Host         string              `yaml:"host"`
+	Port         int32               `yaml:"port"`
+	ReadTimeout  humayConfig.Seconds `yaml:"read_timeout"`
+	WriteTimeout humayConfig.Seconds `yaml:"write_timeout"`
+	IdleTimeout  humayConfig.Seconds `yaml:"idle_timeout"`
+	HashKey      string              `yaml:"hash_key" secret:"true"`
+	// seconds a signed request timestamp may differ from the server time.
+	SignatureMaxSkew humayConfig.Seconds `yaml:"signature_max_skew"`
+	// reject requests signed without timestamp and nonce.
+	SignatureStrict bool `yaml:"signature_strict"`
+	// accept writes signed by the body only, such signatures can be replayed.
+	SignatureLegacy bool `yaml:"signature_legacy,omitempty"`
+	// certificate and key files enable HTTPS.
+	TLSCert string `yaml:"tls_cert,omitempty"`
+	TLSKey  string `yaml:"tls_key,omitempty"`
+	// CA bundle to verify client certificates, enables mutual TLS.
+	TLSClientCA string `yaml:"tls_client_ca,omitempty"`
+	// requests per second for every agent or client address, 0 disables the limit.
+	RateLimit float64 `yaml:"rate_limit,omitempty"`
+	// requests allowed at once above the rate.
+	RateBurst int32 `yaml:"rate_burst,omitempty"`
+	// maximum size of the decompressed request body in bytes.
+	MaxBodySize int64 `yaml:"max_body_size,omitempty"`
+	// maximum number of metrics in one /updates request.
+	MaxBatchSize int32 `yaml:"max_batch_size,omitempty"`
+	// per-agent tokens with scopes.
+	Auth *humayAuth.Config `yaml:"auth,omitempty"`
+	// CIDR of the agents allowed to write metrics, empty allows everybody.
+	TrustedSubnet string `yaml:"trusted_subnet,omitempty"`
+}
+
+// Validate checks the limits and the TLS files of the config.
+func (c *HTTPConfig) Validate() error {
+	return errors.Join(
+		humayConfig.Check(c.Port > 0 && c.Port < 1<<16, "port", "must be between 1 and 65535, got %d", c.Port),
+		humayConfig.Check(c.ReadTimeout >= 0 && c.WriteTimeout >= 0 && c.IdleTimeout >= 0, "timeouts", "must not be negative"),
+		humayConfig.Check((c.TLSCert == "") == (c.TLSKey == ""), "tls_cert", "certificate and key must be set together"),
+		humayConfig.Check(c.TLSClientCA == "" || c.TLSCert != "", "tls_client_ca", "requires tls_cert and tls_key"),
+		humayConfig.Check(c.RateLimit >= 0, "rate_limit", "must not be negative, got %v", c.RateLimit),
+		humayConfig.Check(c.RateBurst >= 0, "rate_burst", "must not be negative, got %d", c.RateBurst),
+		humayConfig.Check(c.MaxBodySize >= 0, "max_body_size", "must not be negative, got %d", c.MaxBodySize),
+		humayConfig.Check(c.MaxBatchSize >= 0, "max_batch_size", "must not be negative, got %d", c.MaxBatchSize),
+		humayConfig.Check(c.Auth == nil || !c.Auth.Enabled || c.Auth.AdminToken != "", "auth.admin_token", "is required when auth is enabled"),
+		humayConfig.Check(validSubnet(c.TrustedSubnet), "trusted_subnet", "invalid CIDR %q", c.TrustedSubnet),
+	)
+}
+
+func validSubnet(cidr string) bool {
+	_, err := hm.NewTrustedSubnet(cidr)
+	return err == nil
 }
 
 type HTTPServer struct {
-	server  *http.Server
-	logger  *zap.Logger
-	storage Storage
-	hashKey string
+	server           *http.Server
+	logger           *zap.Logger
+	storage          humayStorage.Storage
+	hashKey          string
+	signatureMaxSkew time.Duration
+	signatureStrict  bool
+	signatureLegacy  bool
+	authConfig       *humayAuth.Config
+	auth             *humayAuth.Authenticator
+	tls              *humayCommon.CertReloader
+	limiter          *hm.RateLimiter
+	trusted          *hm.TrustedSubnet
+	maxBodySize      int64
+	maxBatchSize     int
+	history          *humayHistory.History
+	hub              *humayHub.Hub
+	telemetry        *humayTelemetry.Registry
+	health           *humayHealth.Checker
+	pipeline         *humayPipeline.Pipeline
+	rollup           *humayRollup.Rollup
+	// closed on shutdown to end the streams.
+	shutdown chan struct{}
 }
 
 func NewHTTPServer(
 	config *HTTPConfig,
 	comlog *zap.Logger,
-	storage Storage,
-) *HTTPServer {
+	storage humayStorage.Storage,
+) (*HTTPServer, error) {
 	server := &http.Server{
 		Addr:         fmt.Sprintf("%s:%d", config.Host, config.Port),
 		ReadTimeout:  time.Duration(config.ReadTimeout) * time.Second,
@@ -50,25 +117,92 @@ func NewHTTPServer(
 		IdleTimeout:  time.Duration(config.IdleTimeout) * time.Second,
 	}
 
-	logger, err := initLogger(comlog)
+	var err error
+	var reloader *humayCommon.CertReloader
+	if config.TLSCert != "" || config.TLSKey != "" {
+		reloader, err = humayCommon.NewCertReloader(config.TLSCert, config.TLSKey, config.TLSClientCA)
+		if err != nil {
+			return nil, err
+		}
+		server.TLSConfig = reloader.ServerConfig()
+	} else if config.TLSClientCA != "" {
+		return nil, errors.New("client CA is set without server certificate")
+	}
+
+	maxBodySize := config.MaxBodySize
+	if maxBodySize <= 0 {
+		maxBodySize = defaultMaxBodySize
+	}
+	maxBatchSize := config.MaxBatchSize
+	if maxBatchSize <= 0 {
+		maxBatchSize = defaultMaxBatchSize
+	}
+
+	// without a token store only the admin token is accepted.
+	var auth *humayAuth.Authenticator
+	if config.Auth != nil && config.Auth.Enabled {
+		auth = humayAuth.NewAuthenticator(nil, config.Auth.AdminToken)
+	}
+
+	trusted, err := hm.NewTrustedSubnet(config.TrustedSubnet)
 	if err != nil {
-		comlog.Sugar().Errorf("failed init http logger: %v", err)
-		logger = comlog
+		return nil, err
 	}
 
+	shutdown := make(chan struct{})
+	server.RegisterOnShutdown(func() {
+		close(shutdown)
+	})
+
 	return &HTTPServer{
-		server:  server,
-		logger:  logger,
-		storage: storage,
-		hashKey: config.HashKey,
+		server:           server,
+		logger:           comlog,
+		storage:          storage,
+		hashKey:          config.HashKey,
+		signatureMaxSkew: time.Duration(config.SignatureMaxSkew) * time.Second,
+		signatureStrict:  config.SignatureStrict,
+		signatureLegacy:  config.SignatureLegacy,
+		authConfig:       config.Auth,
+		auth:             auth,
+		tls:              reloader,
+		limiter:          hm.NewRateLimiter(config.RateLimit, int(config.RateBurst)),
+		trusted:          trusted,
+		maxBodySize:      maxBodySize,
+		maxBatchSize:     int(maxBatchSize),
+		shutdown:         shutdown,
+	}, nil
+}
+
+// SetTokenStore enables tokens authorization if it is enabled in the config.
+// Must be called before Start.
+func (h *HTTPServer) SetTokenStore(store humayAuth.TokenStore) {
+	if h.authConfig == nil || !h.authConfig.Enabled {
+		return
 	}
+
+	h.auth = humayAuth.NewAuthenticator(store, h.authConfig.AdminToken)
+}
+
+// SetTelemetry enables counting of requests. Must be called before Start.
+func (h *HTTPServer) SetTelemetry(registry *humayTelemetry.Registry) {
+	h.telemetry = registry
+}
+
+// SetHealth sets the readiness checks of /readyz.
+func (h *HTTPServer) SetHealth(checker *humayHealth.Checker) {
+	h.health = checker
 }
 
 func (h *HTTPServer) Start(ctx context.Context) error {
 	router := h.newRouter()
 	h.server.Handler = router
 
-	err := h.server.ListenAndServe()
+	var err error
+	if h.tls != nil {
+		err = h.server.ListenAndServeTLS("", "")
+	} else {
+		err = h.server.ListenAndServe()
+	}
 	if err != nil {
 		h.logger.Sugar().Errorf("failed start http server: %w", err)
 		return err
@@ -79,6 +213,24 @@ func (h *HTTPServer) Start(ctx context.Context) error {
 	return nil
 }
 
+// SetTrustedSubnet replaces the subnet of the agents while the server runs.
+func (h *HTTPServer) SetTrustedSubnet(cidr string) error {
+	if h.trusted == nil {
+		return errors.New("trusted subnet is not initialized")
+	}
+
+	return h.trusted.Set(cidr)
+}
+
+// Reload reads the certificate files again.
+func (h *HTTPServer) Reload() error {
+	if h.tls == nil {
+		return nil
+	}
+
+	return h.tls.Reload()
+}
+
 func (h *HTTPServer) Stop(ctx context.Context) error {
 	defer h.logger.Sync()
 	err := h.server.Shutdown(ctx)
@@ -95,20 +247,3 @@ func (h *HTTPServer) Stop(ctx context.Context) error {
 
 	return nil
 }
-
-func initLogger(comlog *zap.Logger) (*zap.Logger, error) {
-	config := zap.Config{
-		Level:            zap.NewAtomicLevelAt(comlog.Level()),
-		Development:      true,
-		Encoding:         "json",
-		EncoderConfig:    zap.NewProductionEncoderConfig(),
-		OutputPaths:      []string{"stdout", "httpacc.log"},
-		ErrorOutputPaths: []string{"stderr", "httperr.log"},
-	}
-	logger, err := config.Build()
-	if err != nil {
-		return nil, err
-	}
-
-	return logger, nil
-}
@@ -0,0 +1,254 @@
+package humayhttpserver
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	agentHTTP "github.com/zvfkjytytw/humay/internal/agent/http"
+	humayCommon "github.com/zvfkjytytw/humay/internal/common"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+func newSignedServer(t *testing.T, hashKey string, strict bool) *httptest.Server {
+	t.Helper()
+	h := &HTTPServer{
+		storage:         &mockStorage{},
+		logger:          zap.NewNop(),
+		hashKey:         hashKey,
+		signatureStrict: strict,
+	}
+	server := httptest.NewServer(h.newRouter())
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestSignatureAgentServer(t *testing.T) {
+	tests := []struct {
+		name      string
+		serverKey string
+		agentKey  string
+		strict    bool
+		ok        bool
+	}{
+		{name: "no keys", ok: true},
+		{name: "same keys", serverKey: "secret", agentKey: "secret", ok: true},
+		{name: "same keys strict", serverKey: "secret", agentKey: "secret", strict: true, ok: true},
+		{name: "different keys", serverKey: "secret", agentKey: "other", ok: false},
+		{name: "only server key", serverKey: "secret", ok: false},
+		{name: "only agent key", agentKey: "secret", ok: false},
+	}
+
+	value := 1.5
+	delta := int64(2)
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			server := newSignedServer(t, test.serverKey, test.strict)
+			client, err := agentHTTP.NewClient(strings.TrimPrefix(server.URL, "http://"), zap.NewNop(), test.agentKey)
+			assert.NoError(t, err)
+			defer client.Stop()
+
+			err = client.UpdateJSONMetrics([]*httpModels.Metric{
+				{ID: "Alloc", MType: httpModels.GaugeMetric, Value: &value},
+				{ID: "PollCount", MType: httpModels.CounterMetric, Delta: &delta},
+			})
+			assert.Equal(t, test.ok, err == nil, "batch: %v", err)
+
+			err = client.UpdateJSONGauge("Alloc", value)
+			assert.Equal(t, test.ok, err == nil, "single: %v", err)
+		})
+	}
+}
+
+func TestSignatureRequests(t *testing.T) {
+	const key = "secret"
+	body := `{"id":"Alloc","type":"gauge","value":1}`
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		strict    bool
+		legacy    bool
+		path      string
+		timestamp string
+		nonce     string
+		sign      string
+		unsigned  bool
+		stCode    int
+	}{
+		{
+			name:   "legacy body signature",
+			sign:   humayCommon.Sign(key, []byte(body)),
+			stCode: http.StatusBadRequest,
+		},
+		{
+			name:   "legacy body signature allowed",
+			legacy: true,
+			sign:   humayCommon.Sign(key, []byte(body)),
+			stCode: http.StatusOK,
+		},
+		{
+			name:     "unsigned write without body",
+			path:     "/update/gauge/Evil/42",
+			unsigned: true,
+			stCode:   http.StatusBadRequest,
+		},
+		{
+			name:      "signed write without body",
+			path:      "/update/gauge/Alloc/42",
+			timestamp: humayCommon.Timestamp(now),
+			nonce:     "n3",
+			sign:      humayCommon.Sign(key, nil, humayCommon.Timestamp(now), "n3", http.MethodPost, "/update/gauge/Alloc/42"),
+			stCode:    http.StatusOK,
+		},
+		{
+			name:   "legacy body signature in strict mode",
+			strict: true,
+			sign:   humayCommon.Sign(key, []byte(body)),
+			stCode: http.StatusBadRequest,
+		},
+		{
+			name:   "plain sha256 of key and body",
+			sign:   "3f2a",
+			stCode: http.StatusBadRequest,
+		},
+		{
+			name:      "stale timestamp",
+			timestamp: humayCommon.Timestamp(now.Add(-time.Hour)),
+			nonce:     "n1",
+			stCode:    http.StatusBadRequest,
+		},
+		{
+			name:      "signed for another path",
+			timestamp: humayCommon.Timestamp(now),
+			nonce:     "n2",
+			sign:      humayCommon.Sign(key, []byte(body), humayCommon.Timestamp(now), "n2", http.MethodPost, "/updates"),
+			stCode:    http.StatusBadRequest,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			h := &HTTPServer{
+				storage:         &mockStorage{},
+				logger:          zap.NewNop(),
+				hashKey:         key,
+				signatureStrict: test.strict,
+				signatureLegacy: test.legacy,
+			}
+			server := httptest.NewServer(h.newRouter())
+			defer server.Close()
+
+			path, reqBody := "/update", body
+			if test.path != "" {
+				path, reqBody = test.path, ""
+			}
+			sign := test.sign
+			if sign == "" && !test.unsigned {
+				sign = humayCommon.Sign(key, []byte(reqBody), test.timestamp, test.nonce, http.MethodPost, path)
+			}
+
+			resp := postSigned(t, server.URL+path, reqBody, sign, test.timestamp, test.nonce)
+			defer resp.Body.Close()
+			assert.Equal(t, test.stCode, resp.StatusCode)
+		})
+	}
+}
+
+func TestSignatureReplay(t *testing.T) {
+	const key = "secret"
+	body := `{"id":"Alloc","type":"gauge","value":1}`
+	server := newSignedServer(t, key, false)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	sign := humayCommon.Sign(key, []byte(body), timestamp, "once", http.MethodPost, "/update")
+
+	resp := postSigned(t, server.URL+"/update", body, sign, timestamp, "once")
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "once", resp.Header.Get(humayCommon.NonceHeader))
+
+	replay := postSigned(t, server.URL+"/update", body, sign, timestamp, "once")
+	defer replay.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, replay.StatusCode)
+}
+
+func TestSignatureNotSkippedByHeaders(t *testing.T) {
+	server := newSignedServer(t, "secret", true)
+
+	for name, value := range map[string]string{"Accept": "text/event-stream", "Upgrade": "websocket"} {
+		req, err := http.NewRequest(http.MethodPost, server.URL+httpModels.UpdatesHandler, strings.NewReader(`[]`))
+		assert.NoError(t, err)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set(name, value)
+
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode, name)
+	}
+}
+
+func postSigned(t *testing.T, url, body, sign, timestamp, nonce string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(http.MethodPost, url, strings.NewReader(body))
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(humayCommon.SignatureHeader, sign)
+	if timestamp != "" {
+		req.Header.Set(humayCommon.TimestampHeader, timestamp)
+	}
+	if nonce != "" {
+		req.Header.Set(humayCommon.NonceHeader, nonce)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+
+	return resp
+}
+
+func TestSignatureCoversQueryAndAdmin(t *testing.T) {
+	const key = "secret"
+	body := `[{"id":"Alloc","type":"gauge","value":1}]`
+	h := &HTTPServer{
+		storage: humayStorage.NewStorage(t.TempDir()+"/metrics.json", ""),
+		logger:  zap.NewNop(),
+		hashKey: key,
+	}
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	// the query is a part of the signed request.
+	timestamp := humayCommon.Timestamp(time.Now())
+	sign := humayCommon.Sign(key, []byte(body), timestamp, "q1", http.MethodPost, "/admin/snapshot?mode=merge")
+	resp := postSigned(t, server.URL+"/admin/snapshot?mode=restore", body, sign, timestamp, "q1")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	sign = humayCommon.Sign(key, []byte(body), timestamp, "q2", http.MethodPost, "/admin/snapshot?mode=restore")
+	resp = postSigned(t, server.URL+"/admin/snapshot?mode=restore", body, sign, timestamp, "q2")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// admin requests without a body are signed too, reads are not.
+	for path, status := range map[string]int{
+		"/admin/snapshot":  http.StatusBadRequest,
+		"/debug/vars":      http.StatusBadRequest,
+		"/admin/log/level": http.StatusBadRequest,
+		"/values":          http.StatusOK,
+	} {
+		resp, err := http.Get(server.URL + path)
+		assert.NoError(t, err)
+		resp.Body.Close()
+		assert.Equal(t, status, resp.StatusCode, path)
+	}
+}
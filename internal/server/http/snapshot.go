@@ -0,0 +1,211 @@
+package humayhttpserver
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"sort"
+	"strings"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+)
+
+const (
+	snapshotFormatJSON   = "json"
+	snapshotFormatNDJSON = "ndjson"
+	snapshotModeMerge    = "merge"
+	snapshotModeRestore  = "restore"
+	ndjsonContentType    = "application/x-ndjson"
+)
+
+type snapshotImportResult struct {
+	Mode     string `json:"mode"`
+	Gauges   int    `json:"gauges"`
+	Counters int    `json:"counters"`
+}
+
+// return all stored metrics as JSON array or as one JSON metric per line.
+func (h *HTTPServer) exportSnapshot(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = snapshotFormatJSON
+		if strings.Contains(r.Header.Get("Accept"), ndjsonContentType) {
+			format = snapshotFormatNDJSON
+		}
+	}
+	if format != snapshotFormatJSON && format != snapshotFormatNDJSON {
+		hm.WriteError(w, http.StatusBadRequest, fmt.Sprintf("unknown snapshot format %s", format))
+		return
+	}
+
+	gauges, counters, err := h.store(r).DumpMetrics()
+	if err != nil {
+		h.logger.Sugar().Errorf("failed dump metrics: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed dump metrics")
+		return
+	}
+	metrics := snapshotMetrics(gauges, counters)
+
+	if format == snapshotFormatNDJSON {
+		w.Header().Set("Content-Type", ndjsonContentType)
+		w.WriteHeader(http.StatusOK)
+		encoder := json.NewEncoder(w)
+		for _, metric := range metrics {
+			if err := encoder.Encode(metric); err != nil {
+				h.logger.Sugar().Errorf("failed write snapshot: %v", err)
+				return
+			}
+		}
+		return
+	}
+
+	body, err := json.Marshal(metrics)
+	if err != nil {
+		h.logger.Sugar().Errorf("failed marshal snapshot: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed marshal snapshot")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// load metrics from the snapshot and merge them with the stored ones or replace the stored ones.
+func (h *HTTPServer) importSnapshot(w http.ResponseWriter, r *http.Request) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = snapshotModeMerge
+	}
+	if mode != snapshotModeMerge && mode != snapshotModeRestore {
+		hm.WriteError(w, http.StatusBadRequest, fmt.Sprintf("unknown import mode %s", mode))
+		return
+	}
+
+	defer r.Body.Close()
+	var metrics []*httpModels.Metric
+	var err error
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		err = json.NewDecoder(r.Body).Decode(&metrics)
+	case ndjsonContentType:
+		metrics, err = decodeNDJSON(r.Body)
+	default:
+		hm.WriteError(w, http.StatusBadRequest, "wrong Content-Type. Expect application/json or application/x-ndjson")
+		return
+	}
+	if err != nil {
+		hm.WriteError(w, http.StatusBadRequest, fmt.Sprintf("failed read snapshot: %v", err))
+		return
+	}
+
+	gauges, counters, err := splitSnapshot(metrics)
+	if err != nil {
+		hm.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	switch mode {
+	case snapshotModeRestore:
+		err = h.store(r).ReplaceMetrics(gauges, counters)
+	case snapshotModeMerge:
+		if len(counters) > 0 {
+			err = h.store(r).PutCounterMetrics(counters)
+		}
+		if err == nil && len(gauges) > 0 {
+			err = h.store(r).PutGaugeMetrics(gauges)
+		}
+	}
+	if err != nil {
+		h.logger.Sugar().Errorf("failed import snapshot: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed import snapshot")
+		return
+	}
+
+	body, _ := json.Marshal(&snapshotImportResult{ //nolint // plain struct
+		Mode:     mode,
+		Gauges:   len(gauges),
+		Counters: len(counters),
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// metrics sorted by type and name, so snapshots of the same state are equal.
+func snapshotMetrics(gauges map[string]float64, counters map[string]int64) []*httpModels.Metric {
+	metrics := make([]*httpModels.Metric, 0, len(gauges)+len(counters))
+	for name, value := range counters {
+		metrics = append(metrics, &httpModels.Metric{ID: name, MType: httpModels.CounterMetric, Delta: &value})
+	}
+	for name, value := range gauges {
+		metrics = append(metrics, &httpModels.Metric{ID: name, MType: httpModels.GaugeMetric, Value: &value})
+	}
+
+	sort.Slice(metrics, func(i, j int) bool {
+		if metrics[i].MType != metrics[j].MType {
+			return metrics[i].MType < metrics[j].MType
+		}
+		return metrics[i].ID < metrics[j].ID
+	})
+
+	return metrics
+}
+
+func splitSnapshot(metrics []*httpModels.Metric) (map[string]float64, map[string]int64, error) {
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+
+	for i, metric := range metrics {
+		if metric == nil || metric.ID == "" {
+			return nil, nil, fmt.Errorf("metric %d: empty metric name", i)
+		}
+
+		switch metric.MType {
+		case httpModels.GaugeMetric:
+			if metric.Value == nil {
+				return nil, nil, fmt.Errorf("metric %s: absent gauge value", metric.ID)
+			}
+			gauges[metric.ID] = *metric.Value
+		case httpModels.CounterMetric:
+			if metric.Delta == nil {
+				return nil, nil, fmt.Errorf("metric %s: absent counter value", metric.ID)
+			}
+			counters[metric.ID] += *metric.Delta
+		default:
+			return nil, nil, fmt.Errorf("metric %s: wrong metric type %s", metric.ID, metric.MType)
+		}
+	}
+
+	return gauges, counters, nil
+}
+
+func decodeNDJSON(body io.Reader) ([]*httpModels.Metric, error) {
+	var metrics []*httpModels.Metric
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		metric := &httpModels.Metric{}
+		if err := json.Unmarshal(scanner.Bytes(), metric); err != nil {
+			return nil, fmt.Errorf("line %d: %v", line, err)
+		}
+		metrics = append(metrics, metric)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("line %d: %v", line, err)
+	}
+
+	return metrics, nil
+}
@@ -0,0 +1,113 @@
+package humayhttpserver
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	humayHTTPClient "github.com/zvfkjytytw/humay/internal/common/http/client"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+func TestSnapshotExportImport(t *testing.T) {
+	source := &HTTPServer{
+		storage: humayStorage.NewStorage(t.TempDir()+"/source.json", ""),
+		logger:  zap.NewNop(),
+	}
+	assert.NoError(t, source.storage.PutGaugeMetric("Alloc", 1.5))
+	assert.NoError(t, source.storage.PutCounterMetric("PollCount", 3))
+
+	tests := []struct {
+		name        string
+		format      string
+		contentType string
+		expect      string
+	}{
+		{
+			name:        "json",
+			format:      "json",
+			contentType: "application/json; charset=utf-8",
+			expect:      `[{"id":"PollCount","type":"counter","delta":3},{"id":"Alloc","type":"gauge","value":1.5}]`,
+		},
+		{
+			name:        "ndjson",
+			format:      "ndjson",
+			contentType: "application/x-ndjson",
+			expect:      "{\"id\":\"PollCount\",\"type\":\"counter\",\"delta\":3}\n{\"id\":\"Alloc\",\"type\":\"gauge\",\"value\":1.5}\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rw := httptest.NewRecorder()
+			req := httptest.NewRequest(http.MethodGet, "/admin/snapshot?format="+test.format, http.NoBody)
+			source.exportSnapshot(rw, req)
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, test.expect, rw.Body.String())
+
+			target := &HTTPServer{
+				storage: humayStorage.NewStorage(t.TempDir()+"/target.json", ""),
+				logger:  zap.NewNop(),
+			}
+			assert.NoError(t, target.storage.PutGaugeMetric("Stale", 1))
+			assert.NoError(t, target.storage.PutCounterMetric("PollCount", 2))
+
+			// merge adds counters and keeps unknown metrics.
+			rw = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodPost, "/admin/snapshot?mode=merge", strings.NewReader(test.expect))
+			req.Header.Set("Content-Type", test.contentType)
+			target.importSnapshot(rw, req)
+			assert.Equal(t, http.StatusOK, rw.Code)
+			counter, err := target.storage.GetCounterMetric("PollCount")
+			assert.NoError(t, err)
+			assert.Equal(t, int64(5), counter)
+			_, err = target.storage.GetGaugeMetric("Stale")
+			assert.NoError(t, err)
+
+			// restore makes the target equal to the source.
+			rw = httptest.NewRecorder()
+			req = httptest.NewRequest(http.MethodPost, "/admin/snapshot?mode=restore", strings.NewReader(test.expect))
+			req.Header.Set("Content-Type", test.contentType)
+			target.importSnapshot(rw, req)
+			assert.Equal(t, http.StatusOK, rw.Code)
+			assert.Equal(t, source.storage.GetAllMetrics(), target.storage.GetAllMetrics())
+		})
+	}
+
+	rw := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/admin/snapshot", strings.NewReader(`[{"id":"A","type":"gauge"}]`))
+	req.Header.Set("Content-Type", "application/json")
+	source.importSnapshot(rw, req)
+	assert.Equal(t, http.StatusBadRequest, rw.Code)
+}
+
+func TestSnapshotImportGzip(t *testing.T) {
+	const key = "secret"
+	storage := humayStorage.NewStorage(t.TempDir()+"/metrics.json", "")
+	h := &HTTPServer{storage: storage, logger: zap.NewNop(), hashKey: key}
+	router := h.newRouter()
+
+	body := []byte(`[{"id":"Alloc","type":"gauge","value":1.5}]`)
+	compressed, err := humayHTTPClient.Compress(body)
+	require.NoError(t, err)
+
+	// the plain body is signed, so it must be decompressed before the check.
+	req := httptest.NewRequest(http.MethodPost, "/admin/snapshot?mode=restore", bytes.NewReader(compressed))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("Content-Encoding", "gzip")
+	_, err = humayHTTPClient.Sign(req, key, body)
+	require.NoError(t, err)
+	rw := httptest.NewRecorder()
+	router.ServeHTTP(rw, req)
+	assert.Equal(t, http.StatusOK, rw.Code, rw.Body.String())
+
+	value, err := storage.GetGaugeMetric("Alloc")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.5, value)
+}
@@ -0,0 +1,201 @@
+package humayhttpserver
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+	humayHub "github.com/zvfkjytytw/humay/internal/server/hub"
+)
+
+const (
+	keepAliveInterval = 15 * time.Second
+	streamWriteWait   = 10 * time.Second
+)
+
+// notice about events missed by the slow client.
+type droppedEvents struct {
+	Dropped int64 `json:"dropped"`
+}
+
+var upgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+}
+
+// SetHub sets the hub of written metrics for streams.
+// Must be called before Start.
+func (h *HTTPServer) SetHub(hub *humayHub.Hub) {
+	h.hub = hub
+}
+
+// annotate tells the hub labels and the sender of metrics before they are written.
+func (h *HTTPServer) annotate(r *http.Request, metrics ...*httpModels.Metric) {
+	if h.hub == nil {
+		return
+	}
+
+	agent := agentName(r)
+	for _, metric := range metrics {
+		h.hub.Annotate(metric, agent)
+	}
+}
+
+// agent is the name of the token, the agent header or the client address.
+func agentName(r *http.Request) string {
+	if name := hm.TokenName(r); name != "" {
+		return name
+	}
+	if name := r.Header.Get(httpModels.AgentHeader); name != "" {
+		return name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+// stream of written metrics matching the filter of the query,
+// over WebSocket for upgrade requests and as server-sent events otherwise.
+func (h *HTTPServer) streamMetrics(w http.ResponseWriter, r *http.Request) {
+	filter, err := humayHub.ParseFilter(r.URL.Query())
+	if err != nil {
+		hm.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if h.hub == nil {
+		hm.WriteError(w, http.StatusNotFound, "streaming is disabled")
+		return
+	}
+	subscription, ok := h.hub.Subscribe(filter)
+	if !ok {
+		hm.WriteError(w, http.StatusServiceUnavailable, "too many subscribers")
+		return
+	}
+	defer subscription.Close()
+
+	if websocket.IsWebSocketUpgrade(r) {
+		h.streamWebSocket(w, r, subscription)
+		return
+	}
+	h.streamEvents(w, r, subscription)
+}
+
+func (h *HTTPServer) streamEvents(w http.ResponseWriter, r *http.Request, subscription *humayHub.Subscription) {
+	// the stream lives longer than the write timeout of the server.
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{}) //nolint // not every writer has deadlines
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+	if err := rc.Flush(); err != nil {
+		h.logger.Sugar().Errorf("failed flush stream: %v", err)
+		return
+	}
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.shutdown:
+			return
+		case <-keepAlive.C:
+			_, err = w.Write([]byte(": keep-alive\n\n"))
+		case event := <-subscription.C:
+			if dropped := subscription.Dropped(); dropped > 0 {
+				err = writeEvent(w, "dropped", droppedEvents{Dropped: dropped})
+			}
+			if err == nil {
+				err = writeEvent(w, "metric", event)
+			}
+		}
+		if err == nil {
+			err = rc.Flush()
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func writeEvent(w http.ResponseWriter, name string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+
+	return err
+}
+
+// every message is the event or the notice about dropped events,
+// messages of the client are ignored.
+func (h *HTTPServer) streamWebSocket(w http.ResponseWriter, r *http.Request, subscription *humayHub.Subscription) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		// the upgrader has answered the error.
+		h.logger.Sugar().Errorf("failed upgrade to websocket: %v", err)
+		return
+	}
+	defer conn.Close()
+
+	// reading handles pongs and close of the client.
+	closed := make(chan struct{})
+	conn.SetReadDeadline(time.Now().Add(2 * keepAliveInterval)) //nolint // checked by the next read
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(2 * keepAliveInterval))
+	})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	keepAlive := time.NewTicker(keepAliveInterval)
+	defer keepAlive.Stop()
+
+	for {
+		var err error
+		select {
+		case <-closed:
+			return
+		case <-h.shutdown:
+			conn.WriteControl( //nolint // the connection is closed anyway
+				websocket.CloseMessage,
+				websocket.FormatCloseMessage(websocket.CloseGoingAway, "server is stopping"),
+				time.Now().Add(streamWriteWait),
+			)
+			return
+		case <-keepAlive.C:
+			err = conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(streamWriteWait))
+		case event := <-subscription.C:
+			conn.SetWriteDeadline(time.Now().Add(streamWriteWait)) //nolint // checked by the write
+			if dropped := subscription.Dropped(); dropped > 0 {
+				err = conn.WriteJSON(droppedEvents{Dropped: dropped})
+			}
+			if err == nil {
+				err = conn.WriteJSON(event)
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package humayhttpserver
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayHub "github.com/zvfkjytytw/humay/internal/server/hub"
+)
+
+func TestStreamEvents(t *testing.T) {
+	h := newStreamingServer(t)
+	// streams pass the signature and compression.
+	h.hashKey = "key"
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	resp, err := http.Get(server.URL + httpModels.StreamHandler + "?type=histogram")
+	require.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+httpModels.StreamHandler+"?type=gauge&name=^Heap&label=env=test", http.NoBody)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "gzip")
+	resp, err = http.DefaultTransport.RoundTrip(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+	assert.Empty(t, resp.Header.Get("Content-Encoding"))
+	assert.Empty(t, resp.Header.Get("HashSHA256"))
+
+	labels := map[string]string{"env": "test"}
+	for _, metric := range []*httpModels.Metric{
+		{ID: "HeapAlloc", MType: httpModels.GaugeMetric},
+		{ID: "Alloc", MType: httpModels.GaugeMetric, Labels: labels},
+		{ID: "HeapSys", MType: httpModels.GaugeMetric, Labels: labels},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "/update", http.NoBody)
+		req.Header.Set(httpModels.AgentHeader, "host-1")
+		h.annotate(req, metric)
+		require.NoError(t, h.storage.PutGaugeMetric(metric.ID, 2.5))
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	var lines []string
+	for scanner.Scan() && scanner.Text() != "" {
+		lines = append(lines, scanner.Text())
+	}
+	require.Len(t, lines, 2)
+	assert.Equal(t, "event: metric", lines[0])
+	var event humayHub.Event
+	assert.NoError(t, json.Unmarshal([]byte(strings.TrimPrefix(lines[1], "data: ")), &event))
+	assert.Equal(t, "HeapSys", event.ID)
+	assert.Equal(t, "host-1", event.Agent)
+	assert.Equal(t, labels, event.Labels)
+	assert.Equal(t, 2.5, *event.Value)
+}
+
+func TestStreamWebSocket(t *testing.T) {
+	h := newStreamingServer(t)
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	url := "ws" + strings.TrimPrefix(server.URL, "http") + httpModels.StreamHandler + "?type=counter"
+	conn, resp, err := websocket.DefaultDialer.Dial(url, nil)
+	require.NoError(t, err)
+	defer conn.Close()
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode)
+
+	require.NoError(t, h.storage.PutGaugeMetric("Alloc", 1))
+	require.NoError(t, h.storage.PutCounterMetrics(map[string]int64{"PollCount": 2}))
+	require.NoError(t, h.storage.PutCounterMetric("PollCount", 3))
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, sum := range []int64{2, 5} {
+		var event humayHub.Event
+		require.NoError(t, conn.ReadJSON(&event))
+		assert.Equal(t, "PollCount", event.ID)
+		assert.Equal(t, sum, *event.Delta)
+	}
+}
@@ -0,0 +1,86 @@
+package humayhttpserver
+
+import (
+	"encoding/json"
+	"expvar"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+	humayTelemetry "github.com/zvfkjytytw/humay/internal/server/telemetry"
+)
+
+func TestTelemetry(t *testing.T) {
+	h := &HTTPServer{
+		storage:   humayStorage.NewStorage(t.TempDir()+"/metrics.json", ""),
+		logger:    zap.NewNop(),
+		telemetry: humayTelemetry.NewRegistry(),
+	}
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	tests := []struct {
+		name        string
+		url         string
+		contentType string
+		body        string
+		status      int
+	}{
+		{
+			name:   "text update",
+			url:    "/update/gauge/Alloc/1.5",
+			status: http.StatusOK,
+		},
+		{
+			name:   "reserved text update",
+			url:    "/update/gauge/_humay_go_goroutines/1",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:        "reserved json update",
+			url:         "/update",
+			contentType: "application/json",
+			body:        `{"id":"_humay_http_requests_total","type":"counter","delta":1}`,
+			status:      http.StatusBadRequest,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			resp, err := http.Post(server.URL+test.url, test.contentType, strings.NewReader(test.body))
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, test.status, resp.StatusCode)
+		})
+	}
+
+	resp, err := http.Get(server.URL + "/debug/metrics")
+	require.NoError(t, err)
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Contains(t, string(body), `humay_http_requests_total{route="/update/{metricType}/{metricName}/{metricValue}",method="POST",status="200"} 1`)
+	assert.Contains(t, string(body), `humay_http_requests_total{route="/update",method="POST",status="400"} 1`)
+}
+
+func TestDebugVars(t *testing.T) {
+	expvar.Publish("humay_test", expvar.Func(func() any {
+		return map[string]int{"puts": 1}
+	}))
+
+	rw := httptest.NewRecorder()
+	debugVars(rw, httptest.NewRequest(http.MethodGet, "/debug/vars", http.NoBody))
+
+	vars := make(map[string]any)
+	require.NoError(t, json.Unmarshal(rw.Body.Bytes(), &vars))
+	assert.Equal(t, map[string]any{"puts": float64(1)}, vars["humay_test"])
+	assert.NotContains(t, vars, "cmdline")
+	assert.NotContains(t, vars, "memstats")
+}
@@ -0,0 +1,121 @@
+package humayhttpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+	hm "github.com/zvfkjytytw/humay/internal/server/http/middleware"
+)
+
+type tokenRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+// issued token, the secret is shown only once.
+type tokenResponse struct {
+	*humayAuth.Token
+	Secret string `json:"token,omitempty"`
+}
+
+func (h *HTTPServer) tokenStore(w http.ResponseWriter) humayAuth.TokenStore {
+	if h.auth == nil || h.auth.Store() == nil {
+		hm.WriteError(w, http.StatusNotFound, "api tokens are disabled")
+		return nil
+	}
+
+	return h.auth.Store()
+}
+
+// issue new token with the given scopes.
+func (h *HTTPServer) createToken(w http.ResponseWriter, r *http.Request) {
+	store := h.tokenStore(w)
+	if store == nil {
+		return
+	}
+
+	defer r.Body.Close()
+	request := &tokenRequest{}
+	if err := json.NewDecoder(r.Body).Decode(request); err != nil {
+		hm.WriteError(w, http.StatusBadRequest, fmt.Sprintf("failed read token request: %v", err))
+		return
+	}
+	if request.Name == "" {
+		hm.WriteError(w, http.StatusBadRequest, "empty token name")
+		return
+	}
+
+	token, secret, err := humayAuth.NewToken(request.Name, request.Scopes)
+	if err != nil {
+		hm.WriteError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err = store.CreateToken(token); err != nil {
+		h.logger.Sugar().Errorf("failed save token: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed save token")
+		return
+	}
+	h.logger.Sugar().Infof("token %s (%s) issued with scopes %v", token.ID, token.Name, token.Scopes)
+
+	token.SecretHash = ""
+	body, _ := json.Marshal(&tokenResponse{Token: token, Secret: secret}) //nolint // plain struct
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
+}
+
+// list issued tokens without secrets.
+func (h *HTTPServer) listTokens(w http.ResponseWriter, r *http.Request) {
+	store := h.tokenStore(w)
+	if store == nil {
+		return
+	}
+
+	tokens, err := store.ListTokens()
+	if err != nil {
+		h.logger.Sugar().Errorf("failed list tokens: %v", err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed list tokens")
+		return
+	}
+
+	for _, token := range tokens {
+		token.SecretHash = ""
+	}
+	if tokens == nil {
+		tokens = []*humayAuth.Token{}
+	}
+
+	body, _ := json.Marshal(tokens) //nolint // plain struct
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// revoke the token.
+func (h *HTTPServer) deleteToken(w http.ResponseWriter, r *http.Request) {
+	store := h.tokenStore(w)
+	if store == nil {
+		return
+	}
+
+	id := chi.URLParam(r, "tokenID")
+	err := store.DeleteToken(id)
+	switch {
+	case errors.Is(err, humayAuth.ErrTokenNotFound):
+		hm.WriteError(w, http.StatusNotFound, fmt.Sprintf("token %s not found", id))
+		return
+	case err != nil:
+		h.logger.Sugar().Errorf("failed delete token %s: %v", id, err)
+		hm.WriteError(w, http.StatusInternalServerError, "failed delete token")
+		return
+	}
+	h.logger.Sugar().Infof("token %s revoked", id)
+
+	w.WriteHeader(http.StatusNoContent)
+}
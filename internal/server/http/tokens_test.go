@@ -0,0 +1,114 @@
+package humayhttpserver
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+func TestTokensAuthorization(t *testing.T) {
+	const adminToken = "bootstrap"
+	storageFile := t.TempDir() + "/metrics.json"
+	storage := humayStorage.NewStorage(storageFile, "")
+	h := &HTTPServer{
+		storage: storage,
+		logger:  zap.NewNop(),
+		auth:    humayAuth.NewAuthenticator(storage, adminToken),
+	}
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	do := func(method, path, token, body string) (int, string) {
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		assert.NoError(t, err)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		assert.NoError(t, err)
+		defer resp.Body.Close()
+
+		buf := &bytes.Buffer{}
+		_, err = buf.ReadFrom(resp.Body)
+		assert.NoError(t, err)
+		return resp.StatusCode, buf.String()
+	}
+
+	issue := func(name string, scopes ...string) *tokenResponse {
+		request, _ := json.Marshal(&tokenRequest{Name: name, Scopes: scopes})
+		code, body := do(http.MethodPost, "/admin/tokens", adminToken, string(request))
+		assert.Equal(t, http.StatusCreated, code, body)
+		issued := &tokenResponse{}
+		assert.NoError(t, json.Unmarshal([]byte(body), issued))
+		return issued
+	}
+
+	agent := issue("agent-1", humayAuth.ScopeWrite)
+	dashboard := issue("grafana", humayAuth.ScopeRead)
+
+	code, _ := do(http.MethodPost, "/admin/tokens", agent.Secret, `{"name":"x","scopes":["admin"]}`)
+	assert.Equal(t, http.StatusForbidden, code)
+
+	code, _ = do(http.MethodPost, "/admin/tokens", adminToken, `{"name":"x","scopes":["root"]}`)
+	assert.Equal(t, http.StatusBadRequest, code)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		stCode int
+	}{
+		{name: "ping without token", method: http.MethodGet, path: "/ping", stCode: http.StatusInternalServerError},
+		{name: "update without token", method: http.MethodPost, path: "/update/gauge/Alloc/1", stCode: http.StatusUnauthorized},
+		{name: "update with wrong token", method: http.MethodPost, path: "/update/gauge/Alloc/1", token: agent.ID + ".bad", stCode: http.StatusUnauthorized},
+		{name: "update by agent", method: http.MethodPost, path: "/update/gauge/Alloc/1", token: agent.Secret, stCode: http.StatusOK},
+		{name: "update by dashboard", method: http.MethodPost, path: "/update/gauge/Alloc/1", token: dashboard.Secret, stCode: http.StatusForbidden},
+		{name: "read by agent", method: http.MethodGet, path: "/value/gauge/Alloc", token: agent.Secret, stCode: http.StatusForbidden},
+		{name: "read by dashboard", method: http.MethodGet, path: "/value/gauge/Alloc", token: dashboard.Secret, stCode: http.StatusOK},
+		{name: "read by admin", method: http.MethodGet, path: "/value/gauge/Alloc", token: adminToken, stCode: http.StatusOK},
+		{name: "snapshot by dashboard", method: http.MethodGet, path: "/admin/snapshot", token: dashboard.Secret, stCode: http.StatusForbidden},
+		{name: "snapshot by admin", method: http.MethodGet, path: "/admin/snapshot", token: adminToken, stCode: http.StatusOK},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			code, body := do(test.method, test.path, test.token, "")
+			assert.Equal(t, test.stCode, code, body)
+		})
+	}
+
+	code, body := do(http.MethodGet, "/admin/tokens", adminToken, "")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Contains(t, body, "agent-1")
+	assert.NotContains(t, body, "secret_hash")
+	assert.NotContains(t, body, agent.Secret)
+
+	code, _ = do(http.MethodDelete, "/admin/tokens/"+agent.ID, adminToken, "")
+	assert.Equal(t, http.StatusNoContent, code)
+	code, _ = do(http.MethodDelete, "/admin/tokens/"+agent.ID, adminToken, "")
+	assert.Equal(t, http.StatusNotFound, code)
+
+	code, _ = do(http.MethodPost, "/update/gauge/Alloc/2", agent.Secret, "")
+	assert.Equal(t, http.StatusUnauthorized, code)
+
+	// tokens survive restart of the memory storage.
+	restored := humayStorage.NewStorage(storageFile, "")
+	assert.NoError(t, restored.Restore(storageFile))
+	_, err := restored.GetToken(dashboard.ID)
+	assert.NoError(t, err)
+	_, err = restored.GetToken(agent.ID)
+	assert.ErrorIs(t, err, humayAuth.ErrTokenNotFound)
+}
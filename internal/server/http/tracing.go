@@ -0,0 +1,121 @@
+package humayhttpserver
+
+import (
+	"context"
+	"net/http"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	humayTracing "github.com/zvfkjytytw/humay/internal/common/tracing"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+// tracedStorage records the storage calls of one request as children of its span.
+type tracedStorage struct {
+	humayStorage.Storage
+	ctx context.Context
+}
+
+// store returns the storage traced in the context of the request.
+func (h *HTTPServer) store(r *http.Request) humayStorage.Storage {
+	if !trace.SpanContextFromContext(r.Context()).IsSampled() {
+		return h.storage
+	}
+
+	return &tracedStorage{Storage: h.storage, ctx: r.Context()}
+}
+
+func (s *tracedStorage) trace(operation string, call func() error) {
+	_, span := humayTracing.Tracer().Start(s.ctx, "storage."+operation,
+		trace.WithSpanKind(trace.SpanKindInternal),
+		trace.WithAttributes(attribute.String("storage.type", s.Storage.GetType())),
+	)
+	defer span.End()
+
+	if err := call(); err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+}
+
+func (s *tracedStorage) GetGaugeMetric(name string) (value float64, err error) {
+	s.trace("get_gauge", func() error {
+		value, err = s.Storage.GetGaugeMetric(name)
+		return err
+	})
+	return
+}
+
+func (s *tracedStorage) PutGaugeMetric(name string, value float64) (err error) {
+	s.trace("put_gauge", func() error {
+		err = s.Storage.PutGaugeMetric(name, value)
+		return err
+	})
+	return
+}
+
+func (s *tracedStorage) PutGaugeMetrics(metrics map[string]float64) (err error) {
+	s.trace("put_gauges", func() error {
+		err = s.Storage.PutGaugeMetrics(metrics)
+		return err
+	})
+	return
+}
+
+func (s *tracedStorage) GetCounterMetric(name string) (value int64, err error) {
+	s.trace("get_counter", func() error {
+		value, err = s.Storage.GetCounterMetric(name)
+		return err
+	})
+	return
+}
+
+func (s *tracedStorage) PutCounterMetric(name string, value int64) (err error) {
+	s.trace("put_counter", func() error {
+		err = s.Storage.PutCounterMetric(name, value)
+		return err
+	})
+	return
+}
+
+func (s *tracedStorage) PutCounterMetrics(metrics map[string]int64) (err error) {
+	s.trace("put_counters", func() error {
+		err = s.Storage.PutCounterMetrics(metrics)
+		return err
+	})
+	return
+}
+
+func (s *tracedStorage) GetAllMetrics() (metrics map[string]map[string]string) {
+	s.trace("get_all", func() error {
+		metrics = s.Storage.GetAllMetrics()
+		return nil
+	})
+	return
+}
+
+func (s *tracedStorage) DumpMetrics() (gauges map[string]float64, counters map[string]int64, err error) {
+	s.trace("dump", func() error {
+		gauges, counters, err = s.Storage.DumpMetrics()
+		return err
+	})
+	return
+}
+
+func (s *tracedStorage) ReplaceMetrics(gauges map[string]float64, counters map[string]int64) (err error) {
+	s.trace("replace", func() error {
+		err = s.Storage.ReplaceMetrics(gauges, counters)
+		return err
+	})
+	return
+}
+
+func (s *tracedStorage) CheckDBConnect() (err error) {
+	s.trace("ping", func() error {
+		err = s.Storage.CheckDBConnect()
+		return err
+	})
+	return
+}
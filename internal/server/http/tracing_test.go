@@ -0,0 +1,78 @@
+package humayhttpserver
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+
+	agentHTTP "github.com/zvfkjytytw/humay/internal/agent/http"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayTracing "github.com/zvfkjytytw/humay/internal/common/tracing"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+func TestTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	defer otel.SetTracerProvider(previous)
+	_, err := humayTracing.Init(context.Background(), nil, "test")
+	require.NoError(t, err)
+
+	h := &HTTPServer{
+		storage: humayStorage.NewStorage(t.TempDir()+"/metrics.json", ""),
+		logger:  zap.NewNop(),
+		hashKey: "key",
+	}
+	server := httptest.NewServer(h.newRouter())
+	defer server.Close()
+
+	client, err := agentHTTP.NewClient(strings.TrimPrefix(server.URL, "http://"), zap.NewNop(), "key")
+	require.NoError(t, err)
+	defer client.Stop()
+	value := 1.5
+	require.NoError(t, client.UpdateJSONMetrics([]*httpModels.Metric{{ID: "Alloc", MType: httpModels.GaugeMetric, Value: &value}}))
+
+	spans := make(map[string]sdktrace.ReadOnlySpan)
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() != trace.SpanKindServer {
+			spans[span.Name()] = span
+		}
+	}
+	for _, name := range []string{"UpdateJSONMetrics", "attempt", "marshal", "gzip", "POST /updates", "read body", "storage.put_gauges"} {
+		require.Contains(t, spans, name)
+	}
+
+	// the server continues the trace of the agent.
+	send := spans["POST "+httpModels.UpdatesHandler]
+	var handler sdktrace.ReadOnlySpan
+	for _, span := range recorder.Ended() {
+		if span.SpanKind() == trace.SpanKindServer && span.Parent().SpanID() == send.SpanContext().SpanID() {
+			handler = span
+		}
+	}
+	require.NotNil(t, handler)
+	assert.Equal(t, send.SpanContext().TraceID(), handler.SpanContext().TraceID())
+
+	attributes := make(map[attribute.Key]attribute.Value)
+	for _, kv := range handler.Attributes() {
+		attributes[kv.Key] = kv.Value
+	}
+	assert.NotEmpty(t, attributes["http.request_id"].AsString())
+	assert.Equal(t, int64(200), attributes["http.response.status_code"].AsInt64())
+	assert.Equal(t, httpModels.UpdatesHandler, attributes["http.route"].AsString())
+
+	storage := spans["storage.put_gauges"]
+	assert.Equal(t, handler.SpanContext().SpanID(), storage.Parent().SpanID())
+}
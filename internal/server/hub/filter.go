@@ -0,0 +1,76 @@
+package humayhub
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+// Filter selects events by type, name pattern, labels and sender.
+// Empty fields match everything.
+type Filter struct {
+	Types  []string
+	Name   *regexp.Regexp
+	Labels map[string]string
+	Agent  string
+}
+
+// ParseFilter reads the filter from the query:
+// type=gauge and type=counter, name=<regexp>, label=<name>=<value> and agent=<name>.
+func ParseFilter(query url.Values) (*Filter, error) {
+	filter := &Filter{Agent: query.Get("agent")}
+
+	for _, mType := range query["type"] {
+		if mType != httpModels.GaugeMetric && mType != httpModels.CounterMetric {
+			return nil, fmt.Errorf("wrong metric type %s", mType)
+		}
+		filter.Types = append(filter.Types, mType)
+	}
+
+	if pattern := query.Get("name"); pattern != "" {
+		name, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("wrong name pattern: %v", err)
+		}
+		filter.Name = name
+	}
+
+	for _, label := range query["label"] {
+		name, value, ok := strings.Cut(label, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("wrong label %s, expect name=value", label)
+		}
+		if filter.Labels == nil {
+			filter.Labels = make(map[string]string)
+		}
+		filter.Labels[name] = value
+	}
+
+	return filter, nil
+}
+
+func (f *Filter) Match(event *Event) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Types) > 0 && !slices.Contains(f.Types, event.MType) {
+		return false
+	}
+	if f.Name != nil && !f.Name.MatchString(event.ID) {
+		return false
+	}
+	if f.Agent != "" && f.Agent != event.Agent {
+		return false
+	}
+	for name, value := range f.Labels {
+		if v, ok := event.Labels[name]; !ok || v != value {
+			return false
+		}
+	}
+
+	return true
+}
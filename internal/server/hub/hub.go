@@ -0,0 +1,176 @@
+package humayhub
+
+import (
+	"sync"
+	"sync/atomic"
+	"time"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+const (
+	defaultMaxSubscribers = 64
+	defaultBuffer         = 256
+)
+
+type Config struct {
+	// maximum number of stream subscribers.
+	MaxSubscribers int32 `yaml:"max_subscribers,omitempty" json:"max_subscribers,omitempty"`
+	// events kept for a slow subscriber before they are dropped.
+	Buffer int32 `yaml:"buffer,omitempty" json:"buffer,omitempty"`
+}
+
+// Event is the stored value of the metric after the write.
+// Counters hold the stored sum, not the written delta.
+type Event struct {
+	httpModels.Metric
+	Agent string `json:"agent,omitempty"`
+	// time of the write in unix milliseconds.
+	Time int64 `json:"time"`
+}
+
+// labels and the sender of the metric known from the requests.
+type annotation struct {
+	labels map[string]string
+	agent  string
+}
+
+// Subscription receives matching events until it is closed.
+type Subscription struct {
+	C       <-chan Event
+	ch      chan Event
+	filter  *Filter
+	dropped atomic.Int64
+	hub     *Hub
+	once    sync.Once
+}
+
+// Dropped returns the number of events missed since the previous call.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Swap(0)
+}
+
+// Close stops the subscription.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		s.hub.mx.Lock()
+		delete(s.hub.subscribers, s)
+		s.hub.mx.Unlock()
+	})
+}
+
+// Hub delivers written metrics to listeners and stream subscribers.
+// Listeners are called for every event, subscribers get only matching ones
+// and miss events while their buffers are full.
+type Hub struct {
+	mx             sync.RWMutex
+	maxSubscribers int
+	buffer         int
+	subscribers    map[*Subscription]struct{}
+	listeners      []func(Event)
+	annotations    map[string]annotation
+}
+
+func NewHub(config *Config) *Hub {
+	h := &Hub{
+		maxSubscribers: defaultMaxSubscribers,
+		buffer:         defaultBuffer,
+		subscribers:    make(map[*Subscription]struct{}),
+		annotations:    make(map[string]annotation),
+	}
+	if config != nil && config.MaxSubscribers > 0 {
+		h.maxSubscribers = int(config.MaxSubscribers)
+	}
+	if config != nil && config.Buffer > 0 {
+		h.buffer = int(config.Buffer)
+	}
+
+	return h
+}
+
+func key(mType, id string) string {
+	return mType + "/" + id
+}
+
+// Listen adds the function called for every event.
+// Must be called before the first write.
+func (h *Hub) Listen(listener func(Event)) {
+	h.mx.Lock()
+	h.listeners = append(h.listeners, listener)
+	h.mx.Unlock()
+}
+
+// Annotate remembers labels and the sender of the metric for its next events,
+// the storage keeps only values. Empty ones don't replace the known.
+func (h *Hub) Annotate(metric *httpModels.Metric, agent string) {
+	if len(metric.Labels) == 0 && agent == "" {
+		return
+	}
+
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	k := key(metric.MType, metric.ID)
+	a := h.annotations[k]
+	if len(metric.Labels) > 0 {
+		a.labels = metric.Labels
+	}
+	if agent != "" {
+		a.agent = agent
+	}
+	h.annotations[k] = a
+}
+
+// Subscribe returns the subscription to the events matching the filter, nil filter matches all.
+// False means there are too many subscribers.
+func (h *Hub) Subscribe(filter *Filter) (*Subscription, bool) {
+	h.mx.Lock()
+	defer h.mx.Unlock()
+
+	if len(h.subscribers) >= h.maxSubscribers {
+		return nil, false
+	}
+	ch := make(chan Event, h.buffer)
+	s := &Subscription{C: ch, ch: ch, filter: filter, hub: h}
+	h.subscribers[s] = struct{}{}
+
+	return s, true
+}
+
+// active reports whether somebody waits for events.
+func (h *Hub) active() bool {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+
+	return len(h.listeners) > 0 || len(h.subscribers) > 0
+}
+
+// Publish delivers metrics written at the time.
+func (h *Hub) Publish(at time.Time, metrics ...httpModels.Metric) {
+	h.mx.RLock()
+	defer h.mx.RUnlock()
+
+	for _, metric := range metrics {
+		event := Event{Metric: metric, Time: at.UnixMilli()}
+		if a, ok := h.annotations[key(metric.MType, metric.ID)]; ok {
+			if event.Labels == nil {
+				event.Labels = a.labels
+			}
+			event.Agent = a.agent
+		}
+
+		for _, listener := range h.listeners {
+			listener(event)
+		}
+		for s := range h.subscribers {
+			if !s.filter.Match(&event) {
+				continue
+			}
+			select {
+			case s.ch <- event:
+			default:
+				s.dropped.Add(1)
+			}
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package humayhub
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+func TestFilter(t *testing.T) {
+	value := 1.0
+	event := &Event{
+		Metric: httpModels.Metric{ID: "HeapAlloc", MType: httpModels.GaugeMetric, Value: &value, Labels: map[string]string{"env": "prod"}},
+		Agent:  "host-1",
+	}
+
+	tests := []struct {
+		name  string
+		query string
+		match bool
+		err   bool
+	}{
+		{name: "empty", query: "", match: true},
+		{name: "type", query: "type=counter&type=gauge", match: true},
+		{name: "other type", query: "type=counter", match: false},
+		{name: "name", query: "name=^Heap", match: true},
+		{name: "other name", query: "name=^Alloc$", match: false},
+		{name: "label", query: "label=env=prod&agent=host-1", match: true},
+		{name: "other label", query: "label=env=test", match: false},
+		{name: "absent label", query: "label=zone=a", match: false},
+		{name: "wrong type", query: "type=histogram", err: true},
+		{name: "wrong pattern", query: "name=(", err: true},
+		{name: "wrong label", query: "label=env", err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			query, err := url.ParseQuery(test.query)
+			require.NoError(t, err)
+			filter, err := ParseFilter(query)
+			if test.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, test.match, filter.Match(event))
+		})
+	}
+}
+
+func TestPublisher(t *testing.T) {
+	hub := NewHub(&Config{MaxSubscribers: 1, Buffer: 2})
+	storage := NewPublisher(humayStorage.NewStorage(t.TempDir()+"/metrics.json", ""), hub)
+
+	var events []Event
+	hub.Listen(func(event Event) {
+		events = append(events, event)
+	})
+	subscription, ok := hub.Subscribe(nil)
+	require.True(t, ok)
+	_, ok = hub.Subscribe(nil)
+	assert.False(t, ok)
+
+	hub.Annotate(&httpModels.Metric{ID: "PollCount", MType: httpModels.CounterMetric, Labels: map[string]string{"env": "test"}}, "host-1")
+	require.NoError(t, storage.PutCounterMetric("PollCount", 2))
+	require.NoError(t, storage.PutCounterMetrics(map[string]int64{"PollCount": 3}))
+	require.NoError(t, storage.ReplaceMetrics(map[string]float64{"Alloc": 1}, nil))
+
+	require.Len(t, events, 3)
+	assert.Equal(t, int64(2), *events[0].Delta)
+	assert.Equal(t, int64(5), *events[1].Delta)
+	assert.Equal(t, "host-1", events[1].Agent)
+	assert.Equal(t, map[string]string{"env": "test"}, events[1].Labels)
+	assert.Equal(t, 1.0, *events[2].Value)
+	assert.Empty(t, events[2].Agent)
+
+	// the buffer keeps two events, the third is dropped.
+	assert.Equal(t, int64(1), subscription.Dropped())
+	assert.Equal(t, int64(0), subscription.Dropped())
+	for _, sum := range []int64{2, 5} {
+		select {
+		case event := <-subscription.C:
+			assert.Equal(t, sum, *event.Delta)
+		case <-time.After(time.Second):
+			t.Fatal("absent event")
+		}
+	}
+
+	subscription.Close()
+	subscription.Close()
+	_, ok = hub.Subscribe(nil)
+	assert.True(t, ok)
+}
@@ -0,0 +1,100 @@
+package humayhub
+
+import (
+	"time"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+// Publisher sends every successful write of the storage to the hub.
+// Counters are read back after the write to publish the stored sum.
+type Publisher struct {
+	humayStorage.Storage
+	hub *Hub
+}
+
+func NewPublisher(storage humayStorage.Storage, hub *Hub) *Publisher {
+	return &Publisher{
+		Storage: storage,
+		hub:     hub,
+	}
+}
+
+func (p *Publisher) PutGaugeMetric(name string, value float64) error {
+	if err := p.Storage.PutGaugeMetric(name, value); err != nil {
+		return err
+	}
+	p.publishGauges(map[string]float64{name: value})
+
+	return nil
+}
+
+func (p *Publisher) PutGaugeMetrics(metrics map[string]float64) error {
+	if err := p.Storage.PutGaugeMetrics(metrics); err != nil {
+		return err
+	}
+	p.publishGauges(metrics)
+
+	return nil
+}
+
+func (p *Publisher) PutCounterMetric(name string, value int64) error {
+	if err := p.Storage.PutCounterMetric(name, value); err != nil {
+		return err
+	}
+	p.publishCounters(map[string]int64{name: value}, true)
+
+	return nil
+}
+
+func (p *Publisher) PutCounterMetrics(metrics map[string]int64) error {
+	if err := p.Storage.PutCounterMetrics(metrics); err != nil {
+		return err
+	}
+	p.publishCounters(metrics, true)
+
+	return nil
+}
+
+func (p *Publisher) ReplaceMetrics(gauges map[string]float64, counters map[string]int64) error {
+	if err := p.Storage.ReplaceMetrics(gauges, counters); err != nil {
+		return err
+	}
+	p.publishGauges(gauges)
+	p.publishCounters(counters, false)
+
+	return nil
+}
+
+func (p *Publisher) publishGauges(gauges map[string]float64) {
+	if len(gauges) == 0 || !p.hub.active() {
+		return
+	}
+
+	metrics := make([]httpModels.Metric, 0, len(gauges))
+	for name, value := range gauges {
+		metrics = append(metrics, httpModels.Metric{ID: name, MType: httpModels.GaugeMetric, Value: &value})
+	}
+	p.hub.Publish(time.Now(), metrics...)
+}
+
+// deltas are replaced by the stored sums, the counter is skipped if it can't be read.
+func (p *Publisher) publishCounters(counters map[string]int64, deltas bool) {
+	if len(counters) == 0 || !p.hub.active() {
+		return
+	}
+
+	metrics := make([]httpModels.Metric, 0, len(counters))
+	for name, value := range counters {
+		if deltas {
+			sum, err := p.Storage.GetCounterMetric(name)
+			if err != nil {
+				continue
+			}
+			value = sum
+		}
+		metrics = append(metrics, httpModels.Metric{ID: name, MType: httpModels.CounterMetric, Delta: &value})
+	}
+	p.hub.Publish(time.Now(), metrics...)
+}
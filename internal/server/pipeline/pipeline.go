@@ -0,0 +1,369 @@
+package humaypipeline
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"strings"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+// operations of derived metrics.
+const (
+	OpSum = "sum"
+	OpSub = "sub"
+	OpMul = "mul"
+	OpDiv = "div"
+)
+
+// invalidChars of names are replaced when the replacement is set.
+var invalidChars = regexp.MustCompile(`[^A-Za-z0-9_.:-]`)
+
+type Config struct {
+	// lowercase names.
+	Lowercase bool `yaml:"lowercase,omitempty" json:"lowercase,omitempty"`
+	// replacement of characters out of letters, digits and _.:- in names, they are kept if empty.
+	Replace string `yaml:"replace,omitempty" json:"replace,omitempty"`
+	// regexp of valid names after the normalisation, every name is valid if empty.
+	NamePattern string `yaml:"name_pattern,omitempty" json:"name_pattern,omitempty"`
+	// regexps of accepted names, every name is accepted if empty.
+	Allow []string `yaml:"allow,omitempty" json:"allow,omitempty"`
+	// regexps of rejected names.
+	Deny []string `yaml:"deny,omitempty" json:"deny,omitempty"`
+	// conversions of values, the first matching one applies.
+	Units []Unit `yaml:"units,omitempty" json:"units,omitempty"`
+	// limits of values after the conversion, every matching one applies.
+	Ranges []Range `yaml:"ranges,omitempty" json:"ranges,omitempty"`
+	// gauges computed from other gauges written with them.
+	Derived []Derived `yaml:"derived,omitempty" json:"derived,omitempty"`
+}
+
+// Unit converts the value to value*scale+offset and sets the unit label.
+type Unit struct {
+	// regexp of the whole name.
+	Match string `yaml:"match" json:"match"`
+	// gauge or counter, both if empty.
+	Type   string  `yaml:"type,omitempty" json:"type,omitempty"`
+	Scale  float64 `yaml:"scale,omitempty" json:"scale,omitempty"`
+	Offset float64 `yaml:"offset,omitempty" json:"offset,omitempty"`
+	Unit   string  `yaml:"unit,omitempty" json:"unit,omitempty"`
+}
+
+// Range rejects values out of the limits, the counter delta is checked for counters.
+type Range struct {
+	Match string   `yaml:"match" json:"match"`
+	Type  string   `yaml:"type,omitempty" json:"type,omitempty"`
+	Min   *float64 `yaml:"min,omitempty" json:"min,omitempty"`
+	Max   *float64 `yaml:"max,omitempty" json:"max,omitempty"`
+}
+
+// Derived is the gauge computed by the operation from the gauges of the arguments.
+type Derived struct {
+	Name string   `yaml:"name" json:"name"`
+	Op   string   `yaml:"op" json:"op"`
+	Args []string `yaml:"args" json:"args"`
+	// multiplier of the result, 1 by default.
+	Scale float64 `yaml:"scale,omitempty" json:"scale,omitempty"`
+}
+
+// Reader returns stored gauges for arguments of derived metrics missing in the request.
+type Reader interface {
+	GetGaugeMetric(name string) (float64, error)
+}
+
+type matcher struct {
+	pattern *regexp.Regexp
+	mType   string
+}
+
+func newMatcher(pattern, mType string) (matcher, error) {
+	re, err := compile(pattern)
+	if err != nil {
+		return matcher{}, err
+	}
+	if mType != "" && mType != httpModels.GaugeMetric && mType != httpModels.CounterMetric {
+		return matcher{}, fmt.Errorf("unknown type %q", mType)
+	}
+
+	return matcher{pattern: re, mType: mType}, nil
+}
+
+func (m matcher) matches(metric *httpModels.Metric) bool {
+	return (m.mType == "" || m.mType == metric.MType) && m.pattern.MatchString(metric.ID)
+}
+
+// compile matches the whole name.
+func compile(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile("^(?:" + pattern + ")$")
+}
+
+type unit struct {
+	matcher
+	Unit
+}
+
+type valueRange struct {
+	matcher
+	Range
+}
+
+// Pipeline normalises, filters and converts metrics of every write request before they are stored.
+type Pipeline struct {
+	lowercase   bool
+	replace     string
+	namePattern *regexp.Regexp
+	allow       []*regexp.Regexp
+	deny        []*regexp.Regexp
+	units       []unit
+	ranges      []valueRange
+	derived     []Derived
+}
+
+// New compiles the config, nil config gives nil pipeline which passes metrics as they are.
+func New(config *Config) (*Pipeline, error) {
+	if config == nil {
+		return nil, nil
+	}
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+
+	p := &Pipeline{
+		lowercase: config.Lowercase,
+		replace:   config.Replace,
+		derived:   config.Derived,
+	}
+	if config.NamePattern != "" {
+		p.namePattern, _ = compile(config.NamePattern)
+	}
+	for _, pattern := range config.Allow {
+		re, _ := compile(pattern)
+		p.allow = append(p.allow, re)
+	}
+	for _, pattern := range config.Deny {
+		re, _ := compile(pattern)
+		p.deny = append(p.deny, re)
+	}
+	for _, u := range config.Units {
+		m, _ := newMatcher(u.Match, u.Type)
+		if u.Scale == 0 {
+			u.Scale = 1
+		}
+		p.units = append(p.units, unit{matcher: m, Unit: u})
+	}
+	for _, r := range config.Ranges {
+		m, _ := newMatcher(r.Match, r.Type)
+		p.ranges = append(p.ranges, valueRange{matcher: m, Range: r})
+	}
+
+	return p, nil
+}
+
+// Validate checks patterns, conversions and operations.
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(field, pattern string) {
+		_, err := compile(pattern)
+		errs = append(errs, humayConfig.Check(err == nil, field, "invalid pattern %q: %v", pattern, err))
+	}
+
+	if c.NamePattern != "" {
+		check("name_pattern", c.NamePattern)
+	}
+	for i, pattern := range c.Allow {
+		check(fmt.Sprintf("allow[%d]", i), pattern)
+	}
+	for i, pattern := range c.Deny {
+		check(fmt.Sprintf("deny[%d]", i), pattern)
+	}
+	for i, u := range c.Units {
+		field := fmt.Sprintf("units[%d]", i)
+		_, err := newMatcher(u.Match, u.Type)
+		errs = append(errs,
+			humayConfig.Check(err == nil, field, "%v", err),
+			humayConfig.Check(u.Type != httpModels.CounterMetric || u.Offset == 0, field, "offset can't be applied to counter deltas"),
+		)
+	}
+	for i, r := range c.Ranges {
+		field := fmt.Sprintf("ranges[%d]", i)
+		_, err := newMatcher(r.Match, r.Type)
+		errs = append(errs,
+			humayConfig.Check(err == nil, field, "%v", err),
+			humayConfig.Check(r.Min == nil || r.Max == nil || *r.Min <= *r.Max, field, "min is greater than max"),
+		)
+	}
+	for i, d := range c.Derived {
+		field := fmt.Sprintf("derived[%d]", i)
+		errs = append(errs, humayConfig.Check(strings.TrimSpace(d.Name) != "", field, "name is required"))
+		switch d.Op {
+		case OpSum, OpMul:
+			errs = append(errs, humayConfig.Check(len(d.Args) >= 1, field, "%s needs arguments", d.Op))
+		case OpSub, OpDiv:
+			errs = append(errs, humayConfig.Check(len(d.Args) == 2, field, "%s needs two arguments", d.Op))
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown operation %q", field, d.Op))
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Process changes the metric in place, the error tells why the metric is rejected.
+func (p *Pipeline) Process(metric *httpModels.Metric) error {
+	if p == nil {
+		return nil
+	}
+
+	// normalisation.
+	if p.lowercase {
+		metric.ID = strings.ToLower(metric.ID)
+	}
+	if p.replace != "" {
+		metric.ID = invalidChars.ReplaceAllString(metric.ID, p.replace)
+	}
+	if p.namePattern != nil && !p.namePattern.MatchString(metric.ID) {
+		return fmt.Errorf("name %s does not match %s", metric.ID, p.namePattern)
+	}
+
+	// allow and deny lists.
+	if len(p.allow) > 0 && !matchAny(p.allow, metric.ID) {
+		return fmt.Errorf("metric %s is not allowed", metric.ID)
+	}
+	if matchAny(p.deny, metric.ID) {
+		return fmt.Errorf("metric %s is denied", metric.ID)
+	}
+
+	// conversion.
+	for _, u := range p.units {
+		if !u.matches(metric) {
+			continue
+		}
+		switch {
+		case metric.Value != nil:
+			value := *metric.Value*u.Scale + u.Offset
+			metric.Value = &value
+		case metric.Delta != nil:
+			delta := int64(math.Round(float64(*metric.Delta) * u.Scale))
+			metric.Delta = &delta
+		}
+		if u.Unit.Unit != "" {
+			labels := make(map[string]string, len(metric.Labels)+1)
+			maps.Copy(labels, metric.Labels)
+			labels["unit"] = u.Unit.Unit
+			metric.Labels = labels
+		}
+		break
+	}
+
+	// range checks.
+	for _, r := range p.ranges {
+		if !r.matches(metric) {
+			continue
+		}
+		value := value(metric)
+		if r.Min != nil && value < *r.Min {
+			return fmt.Errorf("value %v of %s is less than %v", value, metric.ID, *r.Min)
+		}
+		if r.Max != nil && value > *r.Max {
+			return fmt.Errorf("value %v of %s is greater than %v", value, metric.ID, *r.Max)
+		}
+	}
+
+	return nil
+}
+
+// Derive returns gauges derived from the processed metrics.
+// A derived gauge is computed if one of its arguments is written,
+// other arguments are taken from the reader.
+func (p *Pipeline) Derive(metrics []*httpModels.Metric, reader Reader) []*httpModels.Metric {
+	if p == nil || len(p.derived) == 0 {
+		return nil
+	}
+
+	gauges := make(map[string]float64)
+	for _, metric := range metrics {
+		if metric.MType == httpModels.GaugeMetric && metric.Value != nil {
+			gauges[metric.ID] = *metric.Value
+		}
+	}
+
+	var derived []*httpModels.Metric
+	for _, d := range p.derived {
+		written := false
+		args := make([]float64, 0, len(d.Args))
+		for _, name := range d.Args {
+			value, ok := gauges[name]
+			if ok {
+				written = true
+			} else {
+				stored, err := reader.GetGaugeMetric(name)
+				if err != nil {
+					break
+				}
+				value = stored
+			}
+			args = append(args, value)
+		}
+		if !written || len(args) != len(d.Args) {
+			continue
+		}
+
+		value, ok := compute(d.Op, args)
+		if !ok {
+			continue
+		}
+		if d.Scale != 0 {
+			value *= d.Scale
+		}
+		gauges[d.Name] = value
+		derived = append(derived, &httpModels.Metric{ID: d.Name, MType: httpModels.GaugeMetric, Value: &value})
+	}
+
+	return derived
+}
+
+func compute(op string, args []float64) (float64, bool) {
+	result := args[0]
+	for _, arg := range args[1:] {
+		switch op {
+		case OpSum:
+			result += arg
+		case OpSub:
+			result -= arg
+		case OpMul:
+			result *= arg
+		case OpDiv:
+			if arg == 0 {
+				return 0, false
+			}
+			result /= arg
+		}
+	}
+
+	return result, !math.IsNaN(result) && !math.IsInf(result, 0)
+}
+
+func value(metric *httpModels.Metric) float64 {
+	if metric.Value != nil {
+		return *metric.Value
+	}
+	if metric.Delta != nil {
+		return float64(*metric.Delta)
+	}
+
+	return 0
+}
+
+func matchAny(patterns []*regexp.Regexp, name string) bool {
+	for _, pattern := range patterns {
+		if pattern.MatchString(name) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,130 @@
+package humaypipeline
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+func gauge(name string, value float64) *httpModels.Metric {
+	return &httpModels.Metric{ID: name, MType: httpModels.GaugeMetric, Value: &value}
+}
+
+func counter(name string, delta int64) *httpModels.Metric {
+	return &httpModels.Metric{ID: name, MType: httpModels.CounterMetric, Delta: &delta}
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+type reader map[string]float64
+
+func (r reader) GetGaugeMetric(name string) (float64, error) {
+	value, ok := r[name]
+	if !ok {
+		return 0, errors.New("not found")
+	}
+
+	return value, nil
+}
+
+func TestProcess(t *testing.T) {
+	pipeline, err := New(&Config{
+		Lowercase:   true,
+		Replace:     "_",
+		NamePattern: `[a-z][a-z0-9_]*`,
+		Allow:       []string{`heap.*`, `cpu.*`, `poll_count`, `total_alloc`},
+		Deny:        []string{`heap_released`},
+		Units: []Unit{
+			{Match: `heap.*`, Type: httpModels.GaugeMetric, Scale: 1.0 / 1024, Unit: "KiB"},
+			{Match: `poll_count`, Scale: 2},
+		},
+		Ranges: []Range{
+			{Match: `cpu.*`, Min: float(0), Max: float(100)},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		metric  *httpModels.Metric
+		want    *httpModels.Metric
+		wantErr string
+	}{
+		{
+			name:   "normalise and convert",
+			metric: gauge("Heap Alloc", 2048),
+			want:   &httpModels.Metric{ID: "heap_alloc", MType: httpModels.GaugeMetric, Value: float(2), Labels: map[string]string{"unit": "KiB"}},
+		},
+		{name: "counter scale", metric: counter("Poll Count", 3), want: counter("poll_count", 6)},
+		{name: "invalid name", metric: gauge("1cpu", 1), wantErr: "does not match"},
+		{name: "not allowed", metric: gauge("Alloc", 1), wantErr: "is not allowed"},
+		{name: "denied", metric: gauge("Heap Released", 1), wantErr: "is denied"},
+		{name: "kept characters", metric: gauge("heap.released", 1), wantErr: "does not match"},
+		{name: "in range", metric: gauge("CPU1", 100), want: gauge("cpu1", 100)},
+		{name: "out of range", metric: gauge("CPU1", 101), wantErr: "greater than 100"},
+		{name: "negative", metric: gauge("CPU1", -1), wantErr: "less than 0"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := pipeline.Process(test.metric)
+			if test.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.want, test.metric)
+		})
+	}
+
+	// nil pipeline passes metrics as they are.
+	var empty *Pipeline
+	metric := gauge("Heap Alloc", 1)
+	assert.NoError(t, empty.Process(metric))
+	assert.Equal(t, gauge("Heap Alloc", 1), metric)
+}
+
+func TestDerive(t *testing.T) {
+	pipeline, err := New(&Config{
+		Derived: []Derived{
+			{Name: "HeapUsage", Op: OpDiv, Args: []string{"HeapInuse", "HeapSys"}, Scale: 100},
+			{Name: "HeapFree", Op: OpSub, Args: []string{"HeapSys", "HeapInuse"}},
+			{Name: "HeapTotal", Op: OpSum, Args: []string{"HeapFree", "HeapInuse"}},
+		},
+	})
+	require.NoError(t, err)
+
+	stored := reader{"HeapSys": 200}
+	got := pipeline.Derive([]*httpModels.Metric{gauge("HeapInuse", 50), counter("PollCount", 1)}, stored)
+	assert.Equal(t, []*httpModels.Metric{gauge("HeapUsage", 25), gauge("HeapFree", 150), gauge("HeapTotal", 200)}, got)
+
+	// nothing is derived without written arguments or with missing ones.
+	assert.Empty(t, pipeline.Derive([]*httpModels.Metric{gauge("Alloc", 1)}, stored))
+	assert.Empty(t, pipeline.Derive([]*httpModels.Metric{gauge("HeapInuse", 1)}, reader{}))
+	// division by zero.
+	got = pipeline.Derive([]*httpModels.Metric{gauge("HeapInuse", 1), gauge("HeapSys", 0)}, stored)
+	assert.Equal(t, []*httpModels.Metric{gauge("HeapFree", -1), gauge("HeapTotal", 0)}, got)
+}
+
+func TestValidate(t *testing.T) {
+	err := (&Config{
+		NamePattern: "(",
+		Deny:        []string{"["},
+		Units:       []Unit{{Match: "a", Type: httpModels.CounterMetric, Offset: 1}},
+		Ranges:      []Range{{Match: "a", Min: float(2), Max: float(1)}},
+		Derived:     []Derived{{Name: "a", Op: OpDiv, Args: []string{"b"}}, {Name: "c", Op: "pow"}},
+	}).Validate()
+	require.Error(t, err)
+	for _, field := range []string{"name_pattern:", "deny[0]:", "units[0]: offset", "ranges[0]: min", "derived[0]: div needs two", `derived[1]: unknown operation "pow"`} {
+		assert.Contains(t, err.Error(), field)
+	}
+
+	_, err = New(&Config{Allow: []string{"("}})
+	assert.Error(t, err)
+}
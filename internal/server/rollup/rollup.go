@@ -0,0 +1,470 @@
+package humayrollup
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+// resolutions of the stored data.
+const (
+	Raw    = "raw"
+	Minute = "1m"
+	Hour   = "1h"
+)
+
+const (
+	defaultInterval = 60
+	defaultRaw      = 24 * 60 * 60
+	defaultMinute   = 30 * 24 * 60 * 60
+	defaultHour     = 365 * 24 * 60 * 60
+)
+
+// longest ranges answered with raw samples and minutes, longer ones get coarser data.
+const (
+	maxRawSpan    = time.Hour
+	maxMinuteSpan = 48 * time.Hour
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// how often closed minutes and hours are rolled up.
+	Interval humayConfig.Seconds `yaml:"interval,omitempty" json:"interval,omitempty"`
+	// how long raw samples, minutes and hours are kept.
+	Raw    humayConfig.Seconds `yaml:"raw,omitempty" json:"raw,omitempty"`
+	Minute humayConfig.Seconds `yaml:"minute,omitempty" json:"minute,omitempty"`
+	Hour   humayConfig.Seconds `yaml:"hour,omitempty" json:"hour,omitempty"`
+	// file the data is saved to on every rollup and on stop, and restored from on start.
+	File string `yaml:"file,omitempty" json:"file,omitempty"`
+}
+
+// Validate checks that every resolution is kept not shorter than the finer one.
+func (c *Config) Validate() error {
+	raw, minute, hour := c.retentions()
+	return errors.Join(
+		humayConfig.Check(minute >= raw, "minute", "must not be shorter than raw %s", raw),
+		humayConfig.Check(hour >= minute, "hour", "must not be shorter than minute %s", minute),
+	)
+}
+
+func (c *Config) retentions() (raw, minute, hour time.Duration) {
+	raw, minute, hour = defaultRaw*time.Second, defaultMinute*time.Second, defaultHour*time.Second
+	if c.Raw > 0 {
+		raw = c.Raw.Duration()
+	}
+	if c.Minute > 0 {
+		minute = c.Minute.Duration()
+	}
+	if c.Hour > 0 {
+		hour = c.Hour.Duration()
+	}
+
+	return raw, minute, hour
+}
+
+// Point is the raw sample or the aggregate of the minute or the hour.
+// Gauges have min, max and avg, counters have the sum of increments and its rate per second.
+type Point struct {
+	// time of the sample or the start of the bucket in unix milliseconds.
+	Time int64    `json:"t"`
+	Last float64  `json:"last"`
+	Min  *float64 `json:"min,omitempty"`
+	Max  *float64 `json:"max,omitempty"`
+	Avg  *float64 `json:"avg,omitempty"`
+	Sum  *float64 `json:"sum,omitempty"`
+	Rate *float64 `json:"rate,omitempty"`
+}
+
+// Range is the data of the metric between from and to in the resolution.
+type Range struct {
+	ID         string  `json:"id"`
+	MType      string  `json:"type"`
+	Resolution string  `json:"resolution"`
+	From       int64   `json:"from"`
+	To         int64   `json:"to"`
+	Points     []Point `json:"points"`
+}
+
+type sample struct {
+	Time  int64   `json:"t"`
+	Value float64 `json:"v"`
+}
+
+// bucket sums values of gauges and increments of counters.
+type bucket struct {
+	Start int64   `json:"t"`
+	Count int     `json:"n"`
+	Min   float64 `json:"min"`
+	Max   float64 `json:"max"`
+	Sum   float64 `json:"sum"`
+	Last  float64 `json:"last"`
+}
+
+func (b *bucket) add(other bucket) {
+	if b.Count == 0 || other.Min < b.Min {
+		b.Min = other.Min
+	}
+	if b.Count == 0 || other.Max > b.Max {
+		b.Max = other.Max
+	}
+	b.Count += other.Count
+	b.Sum += other.Sum
+	b.Last = other.Last
+}
+
+type series struct {
+	ID      string   `json:"id"`
+	MType   string   `json:"type"`
+	Raw     []sample `json:"raw,omitempty"`
+	Minutes []bucket `json:"minutes,omitempty"`
+	Hours   []bucket `json:"hours,omitempty"`
+	// raw samples and minutes before these times in unix milliseconds are rolled up.
+	RawRolled    int64 `json:"raw_rolled"`
+	MinuteRolled int64 `json:"minute_rolled"`
+	// counter value before the not rolled samples, the first sample has no increment.
+	Prev *float64 `json:"prev,omitempty"`
+}
+
+// Rollup keeps raw samples of every metric and their minute and hour aggregates.
+type Rollup struct {
+	mx       sync.RWMutex
+	series   map[string]*series
+	interval time.Duration
+	raw      time.Duration
+	minute   time.Duration
+	hour     time.Duration
+	file     string
+	saveMx   sync.Mutex
+	done     chan struct{}
+	once     sync.Once
+	logger   *zap.Logger
+}
+
+func NewRollup(config *Config, logger *zap.Logger) *Rollup {
+	r := &Rollup{
+		series:   make(map[string]*series),
+		interval: defaultInterval * time.Second,
+		done:     make(chan struct{}),
+		logger:   logger,
+	}
+	if config == nil {
+		config = &Config{}
+	}
+	r.raw, r.minute, r.hour = config.retentions()
+	if config.Interval > 0 {
+		r.interval = config.Interval.Duration()
+	}
+	r.file = config.File
+
+	return r
+}
+
+func key(mType, id string) string {
+	return mType + "/" + id
+}
+
+// Record adds the stored value of the metric, samples older than the rolled up minutes are dropped.
+func (r *Rollup) Record(metric *httpModels.Metric, at time.Time) {
+	var value float64
+	switch {
+	case metric.Delta != nil:
+		value = float64(*metric.Delta)
+	case metric.Value != nil:
+		value = *metric.Value
+	default:
+		return
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	s, ok := r.series[key(metric.MType, metric.ID)]
+	if !ok {
+		s = &series{ID: metric.ID, MType: metric.MType}
+		r.series[key(metric.MType, metric.ID)] = s
+	}
+	if at.UnixMilli() < s.RawRolled {
+		return
+	}
+	s.Raw = append(s.Raw, sample{Time: at.UnixMilli(), Value: value})
+}
+
+// Compact rolls up the closed minutes and hours and drops the data older than its retention.
+func (r *Rollup) Compact(now time.Time) {
+	minuteEnd := now.Truncate(time.Minute).UnixMilli()
+	hourEnd := now.Truncate(time.Hour).UnixMilli()
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	for k, s := range r.series {
+		s.rollRaw(minuteEnd)
+		s.rollMinutes(hourEnd)
+
+		// the data is dropped only after it is rolled up.
+		rawBefore := min(now.Add(-r.raw).UnixMilli(), s.RawRolled)
+		s.Raw = s.Raw[sort.Search(len(s.Raw), func(i int) bool {
+			return s.Raw[i].Time >= rawBefore
+		}):]
+		s.Minutes = trim(s.Minutes, min(now.Add(-r.minute).UnixMilli(), s.MinuteRolled))
+		s.Hours = trim(s.Hours, now.Add(-r.hour).UnixMilli())
+		if len(s.Raw) == 0 && len(s.Minutes) == 0 && len(s.Hours) == 0 {
+			delete(r.series, k)
+		}
+	}
+}
+
+// clone returns the copy of the series which is not changed by later writes and rollups.
+func (s *series) clone() *series {
+	c := *s
+	c.Raw = slices.Clone(s.Raw)
+	c.Minutes = slices.Clone(s.Minutes)
+	c.Hours = slices.Clone(s.Hours)
+	if s.Prev != nil {
+		prev := *s.Prev
+		c.Prev = &prev
+	}
+
+	return &c
+}
+
+// rollRaw adds raw samples before the end to the minutes.
+func (s *series) rollRaw(end int64) {
+	for _, smp := range s.Raw {
+		if smp.Time < s.RawRolled {
+			continue
+		}
+		if smp.Time >= end {
+			break
+		}
+
+		value := smp.Value
+		if s.MType == httpModels.CounterMetric {
+			// the stored sum less than the previous one means the counter was reset.
+			switch {
+			case s.Prev == nil:
+				value = 0
+			case smp.Value >= *s.Prev:
+				value = smp.Value - *s.Prev
+			}
+			prev := smp.Value
+			s.Prev = &prev
+		}
+
+		start := smp.Time - smp.Time%time.Minute.Milliseconds()
+		if len(s.Minutes) == 0 || s.Minutes[len(s.Minutes)-1].Start != start {
+			s.Minutes = append(s.Minutes, bucket{Start: start})
+		}
+		s.Minutes[len(s.Minutes)-1].add(bucket{Count: 1, Min: smp.Value, Max: smp.Value, Sum: value, Last: smp.Value})
+	}
+	if end > s.RawRolled {
+		s.RawRolled = end
+	}
+}
+
+// rollMinutes adds minutes before the end to the hours.
+func (s *series) rollMinutes(end int64) {
+	for _, minute := range s.Minutes {
+		if minute.Start < s.MinuteRolled {
+			continue
+		}
+		if minute.Start >= end {
+			break
+		}
+
+		start := minute.Start - minute.Start%time.Hour.Milliseconds()
+		if len(s.Hours) == 0 || s.Hours[len(s.Hours)-1].Start != start {
+			s.Hours = append(s.Hours, bucket{Start: start})
+		}
+		s.Hours[len(s.Hours)-1].add(minute)
+	}
+	if end > s.MinuteRolled {
+		s.MinuteRolled = end
+	}
+}
+
+func trim(buckets []bucket, before int64) []bucket {
+	return buckets[sort.Search(len(buckets), func(i int) bool {
+		return buckets[i].Start >= before
+	}):]
+}
+
+// Resolution is the finest one that is kept for the start of the range and is not too detailed for its span.
+func (r *Rollup) Resolution(now, from, to time.Time) string {
+	age, span := now.Sub(from), to.Sub(from)
+	switch {
+	case age <= r.raw && span <= maxRawSpan:
+		return Raw
+	case age <= r.minute && span <= maxMinuteSpan:
+		return Minute
+	default:
+		return Hour
+	}
+}
+
+// Query returns the data of the metric from the inclusive start to the exclusive end,
+// the resolution is chosen by the range if it is empty.
+// Minutes and hours are only returned when they are closed and rolled up.
+func (r *Rollup) Query(mType, id string, from, to time.Time, resolution string) (Range, bool) {
+	if resolution == "" {
+		resolution = r.Resolution(time.Now(), from, to)
+	}
+	result := Range{
+		ID:         id,
+		MType:      mType,
+		Resolution: resolution,
+		From:       from.UnixMilli(),
+		To:         to.UnixMilli(),
+		Points:     make([]Point, 0),
+	}
+
+	r.mx.RLock()
+	defer r.mx.RUnlock()
+
+	s, ok := r.series[key(mType, id)]
+	if !ok {
+		return result, false
+	}
+
+	switch resolution {
+	case Raw:
+		for _, smp := range s.Raw {
+			if smp.Time >= result.From && smp.Time < result.To {
+				result.Points = append(result.Points, Point{Time: smp.Time, Last: smp.Value})
+			}
+		}
+	case Minute:
+		result.Points = points(s.Minutes, mType, time.Minute, result.From, result.To)
+	case Hour:
+		result.Points = points(s.Hours, mType, time.Hour, result.From, result.To)
+	}
+
+	return result, true
+}
+
+func points(buckets []bucket, mType string, width time.Duration, from, to int64) []Point {
+	list := make([]Point, 0)
+	for _, b := range buckets {
+		if b.Start < from || b.Start >= to {
+			continue
+		}
+
+		point := Point{Time: b.Start, Last: b.Last}
+		if mType == httpModels.CounterMetric {
+			sum, rate := b.Sum, b.Sum/width.Seconds()
+			point.Sum, point.Rate = &sum, &rate
+		} else {
+			minimum, maximum, avg := b.Min, b.Max, b.Sum/float64(b.Count)
+			point.Min, point.Max, point.Avg = &minimum, &maximum, &avg
+		}
+		list = append(list, point)
+	}
+
+	return list
+}
+
+// Restore loads the data saved to the file, a missing file is not an error.
+func (r *Rollup) Restore() error {
+	if r.file == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(r.file)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed read rollups file %s: %v", r.file, err)
+	}
+
+	var list []*series
+	if err = json.Unmarshal(data, &list); err != nil {
+		return fmt.Errorf("failed parse rollups file %s: %v", r.file, err)
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+	for _, s := range list {
+		r.series[key(s.MType, s.ID)] = s
+	}
+
+	return nil
+}
+
+// save writes the data to the temporary file and moves it over the file.
+func (r *Rollup) save() error {
+	if r.file == "" {
+		return nil
+	}
+	r.saveMx.Lock()
+	defer r.saveMx.Unlock()
+
+	// writes wait for the lock, so only the copy is made under it.
+	r.mx.RLock()
+	list := make([]*series, 0, len(r.series))
+	for _, s := range r.series {
+		list = append(list, s.clone())
+	}
+	r.mx.RUnlock()
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		return fmt.Errorf("failed marshal rollups: %v", err)
+	}
+
+	tmp := r.file + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed write rollups file %s: %v", tmp, err)
+	}
+	if err = os.Rename(tmp, r.file); err != nil {
+		return fmt.Errorf("failed replace rollups file %s: %v", r.file, err)
+	}
+
+	return nil
+}
+
+// Start rolls the data up and saves it to the file on every tick, so a crash loses one interval at most.
+func (r *Rollup) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case now := <-ticker.C:
+			r.Compact(now)
+			if err := r.save(); err != nil {
+				r.logger.Sugar().Errorf("failed save rollups: %v", err)
+			}
+		case <-ctx.Done():
+			return nil
+		case <-r.done:
+			return nil
+		}
+	}
+}
+
+// Stop ends the rollups and saves the data to the file.
+func (r *Rollup) Stop(ctx context.Context) error {
+	var err error
+	r.once.Do(func() {
+		close(r.done)
+		r.Compact(time.Now())
+		err = r.save()
+	})
+	if err != nil {
+		r.logger.Sugar().Errorf("failed save rollups: %v", err)
+	}
+
+	return err
+}
@@ -0,0 +1,187 @@
+package humayrollup
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+func gauge(value float64) *httpModels.Metric {
+	return &httpModels.Metric{ID: "Alloc", MType: httpModels.GaugeMetric, Value: &value}
+}
+
+func counter(sum int64) *httpModels.Metric {
+	return &httpModels.Metric{ID: "PollCount", MType: httpModels.CounterMetric, Delta: &sum}
+}
+
+func float(v float64) *float64 {
+	return &v
+}
+
+func TestRollup(t *testing.T) {
+	r := NewRollup(&Config{Raw: 2 * 60 * 60, Minute: 3 * 60 * 60, Hour: 24 * 60 * 60}, zap.NewNop())
+	start := time.Date(2024, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	// two minutes of the first hour and one of the second, the counter is reset in the second minute.
+	for i, at := range []time.Duration{0, 20 * time.Second, 70 * time.Second, 80 * time.Second, 65 * time.Minute} {
+		r.Record(gauge([]float64{1, 3, 5, 7, 9}[i]), start.Add(at))
+		r.Record(counter([]int64{10, 16, 4, 10, 30}[i]), start.Add(at))
+	}
+
+	r.Compact(start.Add(66 * time.Minute))
+
+	got, ok := r.Query(httpModels.GaugeMetric, "Alloc", start, start.Add(2*time.Hour), Minute)
+	require.True(t, ok)
+	assert.Equal(t, []Point{
+		{Time: start.UnixMilli(), Last: 3, Min: float(1), Max: float(3), Avg: float(2)},
+		{Time: start.Add(time.Minute).UnixMilli(), Last: 7, Min: float(5), Max: float(7), Avg: float(6)},
+		{Time: start.Add(65 * time.Minute).UnixMilli(), Last: 9, Min: float(9), Max: float(9), Avg: float(9)},
+	}, got.Points)
+
+	got, _ = r.Query(httpModels.CounterMetric, "PollCount", start, start.Add(2*time.Hour), Minute)
+	assert.Equal(t, []Point{
+		{Time: start.UnixMilli(), Last: 16, Sum: float(6), Rate: float(0.1)},
+		{Time: start.Add(time.Minute).UnixMilli(), Last: 10, Sum: float(10), Rate: float(10.0 / 60)},
+		{Time: start.Add(65 * time.Minute).UnixMilli(), Last: 30, Sum: float(20), Rate: float(20.0 / 60)},
+	}, got.Points)
+
+	// only the closed hour is rolled up.
+	got, _ = r.Query(httpModels.GaugeMetric, "Alloc", start, start.Add(2*time.Hour), Hour)
+	assert.Equal(t, []Point{{Time: start.UnixMilli(), Last: 7, Min: float(1), Max: float(7), Avg: float(4)}}, got.Points)
+	got, _ = r.Query(httpModels.CounterMetric, "PollCount", start, start.Add(2*time.Hour), Hour)
+	assert.Equal(t, []Point{{Time: start.UnixMilli(), Last: 10, Sum: float(16), Rate: float(16.0 / 3600)}}, got.Points)
+
+	got, _ = r.Query(httpModels.GaugeMetric, "Alloc", start.Add(time.Minute), start.Add(2*time.Minute), Raw)
+	assert.Equal(t, []Point{{Time: start.Add(70 * time.Second).UnixMilli(), Last: 5}, {Time: start.Add(80 * time.Second).UnixMilli(), Last: 7}}, got.Points)
+
+	// late samples of the rolled minutes are dropped.
+	r.Record(gauge(100), start.Add(30*time.Second))
+	got, _ = r.Query(httpModels.GaugeMetric, "Alloc", start, start.Add(time.Minute), Raw)
+	assert.Len(t, got.Points, 2)
+
+	_, ok = r.Query(httpModels.GaugeMetric, "Unknown", start, start.Add(time.Hour), "")
+	assert.False(t, ok)
+
+	// raw samples and minutes out of their retention are dropped, hours are kept.
+	r.Compact(start.Add(4 * time.Hour))
+	got, _ = r.Query(httpModels.GaugeMetric, "Alloc", start, start.Add(4*time.Hour), Raw)
+	assert.Empty(t, got.Points)
+	got, _ = r.Query(httpModels.GaugeMetric, "Alloc", start, start.Add(4*time.Hour), Minute)
+	assert.Len(t, got.Points, 1)
+	got, _ = r.Query(httpModels.GaugeMetric, "Alloc", start, start.Add(4*time.Hour), Hour)
+	assert.Len(t, got.Points, 2)
+
+	r.Compact(start.Add(30 * time.Hour))
+	_, ok = r.Query(httpModels.GaugeMetric, "Alloc", start, start.Add(30*time.Hour), Hour)
+	assert.False(t, ok)
+}
+
+func TestResolution(t *testing.T) {
+	r := NewRollup(nil, zap.NewNop())
+	now := time.Now()
+
+	tests := []struct {
+		name string
+		from time.Duration
+		to   time.Duration
+		want string
+	}{
+		{name: "last hour", from: time.Hour, want: Raw},
+		{name: "hour a day ago", from: 24 * time.Hour, to: 23 * time.Hour, want: Raw},
+		{name: "last day", from: 24 * time.Hour, want: Minute},
+		{name: "hour a week ago", from: 7 * 24 * time.Hour, to: 7*24*time.Hour - time.Hour, want: Minute},
+		{name: "last week", from: 7 * 24 * time.Hour, want: Hour},
+		{name: "day two months ago", from: 60 * 24 * time.Hour, to: 59 * 24 * time.Hour, want: Hour},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.want, r.Resolution(now, now.Add(-test.from), now.Add(-test.to)))
+		})
+	}
+}
+
+func TestSaveRestore(t *testing.T) {
+	config := &Config{Enabled: true, File: t.TempDir() + "/rollups.json"}
+	r := NewRollup(config, zap.NewNop())
+	require.NoError(t, r.Restore())
+	now := time.Now()
+	r.Record(counter(5), now.Add(-2*time.Minute))
+	r.Record(counter(8), now.Add(-time.Minute))
+	require.NoError(t, r.Stop(context.Background()))
+
+	restored := NewRollup(config, zap.NewNop())
+	require.NoError(t, restored.Restore())
+	r.Record(counter(9), now)
+	restored.Record(counter(9), now)
+	restored.Compact(now.Add(time.Minute))
+	r.Compact(now.Add(time.Minute))
+
+	want, _ := r.Query(httpModels.CounterMetric, "PollCount", now.Add(-time.Hour), now.Add(time.Hour), Minute)
+	got, ok := restored.Query(httpModels.CounterMetric, "PollCount", now.Add(-time.Hour), now.Add(time.Hour), Minute)
+	require.True(t, ok)
+	assert.Equal(t, want.Points, got.Points)
+
+	assert.Error(t, (&Config{Raw: 2 * 24 * 60 * 60, Minute: 24 * 60 * 60}).Validate())
+}
+
+func TestSaveOnTick(t *testing.T) {
+	config := &Config{Enabled: true, File: t.TempDir() + "/rollups.json"}
+	r := NewRollup(config, zap.NewNop())
+	r.interval = 10 * time.Millisecond
+	r.Record(counter(5), time.Now())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Start(ctx)
+	}()
+
+	// the data is on the disk without a graceful stop.
+	require.Eventually(t, func() bool {
+		restored := NewRollup(config, zap.NewNop())
+		if restored.Restore() != nil {
+			return false
+		}
+		_, ok := restored.Query(httpModels.CounterMetric, "PollCount", time.Now().Add(-time.Hour), time.Now().Add(time.Hour), Raw)
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	select {
+	case err := <-done:
+		assert.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("rollups are not stopped by the context")
+	}
+}
+
+func TestSaveWhileRecording(t *testing.T) {
+	config := &Config{Enabled: true, File: t.TempDir() + "/rollups.json"}
+	r := NewRollup(config, zap.NewNop())
+	now := time.Now()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := range 100 {
+			r.Record(counter(int64(i)), now.Add(time.Duration(i)*time.Millisecond))
+		}
+	}()
+	for range 10 {
+		require.NoError(t, r.save())
+	}
+	<-done
+	require.NoError(t, r.save())
+
+	restored := NewRollup(config, zap.NewNop())
+	require.NoError(t, restored.Restore())
+	got, ok := restored.Query(httpModels.CounterMetric, "PollCount", now.Add(-time.Minute), now.Add(time.Minute), Raw)
+	require.True(t, ok)
+	assert.Len(t, got.Points, 100)
+}
@@ -15,6 +15,34 @@ const (
 	createGaugeTableQuery   = "CREATE TABLE gauge_metrics(name text NOT NULL UNIQUE, value double precision NOT NULL)"
 	createCounterTableQuery = "CREATE TABLE counter_metrics (name text NOT NULL UNIQUE, value bigint NOT NULL)"
 	initTimeout             = 10 * time.Second
+	// notify listeners about every changed metric, see Listen.
+	createNotifyFunctionQuery = `
+	CREATE OR REPLACE FUNCTION humay_notify_change() RETURNS trigger AS $$
+	BEGIN
+		IF TG_LEVEL = 'STATEMENT' THEN
+			PERFORM pg_notify('humay_metrics', TG_TABLE_NAME || ':');
+		ELSIF TG_OP = 'DELETE' THEN
+			PERFORM pg_notify('humay_metrics', TG_TABLE_NAME || ':' || OLD.name);
+		ELSE
+			PERFORM pg_notify('humay_metrics', TG_TABLE_NAME || ':' || NEW.name);
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql
+	`
+	// CREATE OR REPLACE TRIGGER needs PostgreSQL 14, missing triggers are dropped and created instead.
+	existTriggerQuery        = `SELECT EXISTS (SELECT 1 FROM pg_trigger WHERE tgname = '%s') AS trigger_exist`
+	dropTriggerQuery         = "DROP TRIGGER IF EXISTS %s ON %s"
+	createNotifyTriggerQuery = `
+	CREATE TRIGGER humay_notify_%[1]s
+	AFTER INSERT OR UPDATE OR DELETE ON %[1]s
+	FOR EACH ROW EXECUTE PROCEDURE humay_notify_change()
+	`
+	createTruncateTriggerQuery = `
+	CREATE TRIGGER humay_truncate_%[1]s
+	AFTER TRUNCATE ON %[1]s
+	FOR EACH STATEMENT EXECUTE PROCEDURE humay_notify_change()
+	`
 )
 
 func (s *PGStorage) initDB() error {
@@ -42,6 +70,31 @@ func (s *PGStorage) initDB() error {
 				initCommands = append(initCommands, createGaugeTableQuery)
 			}
 
+			if !s.checkTableExist(tokenTable) {
+				initCommands = append(initCommands, createTokenTableQuery)
+			}
+
+			// triggers are created once, the next starts only check them.
+			var triggerCommands []string
+			for _, table := range []string{counterTable, gaugeTable} {
+				for trigger, query := range map[string]string{
+					"humay_notify_" + table:   createNotifyTriggerQuery,
+					"humay_truncate_" + table: createTruncateTriggerQuery,
+				} {
+					if !s.checkTriggerExist(trigger) {
+						triggerCommands = append(
+							triggerCommands,
+							fmt.Sprintf(dropTriggerQuery, trigger, table),
+							fmt.Sprintf(query, table),
+						)
+					}
+				}
+			}
+			if len(triggerCommands) > 0 {
+				initCommands = append(initCommands, createNotifyFunctionQuery)
+				initCommands = append(initCommands, triggerCommands...)
+			}
+
 			if len(initCommands) > 0 {
 				tx, err := s.dbConnect.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 				if err != nil {
@@ -77,3 +130,11 @@ func (s *PGStorage) checkTableExist(table string) bool {
 
 	return result
 }
+
+func (s *PGStorage) checkTriggerExist(trigger string) bool {
+	var result bool
+	row := s.dbConnect.QueryRow(fmt.Sprintf(existTriggerQuery, trigger))
+	row.Scan(&result)
+
+	return result
+}
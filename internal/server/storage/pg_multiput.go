@@ -147,3 +147,85 @@ func putMetrics[T Number](db *sql.DB, table, query string, metrics map[string]T)
 
 	return nil
 }
+
+// ReplaceMetrics drops all stored metrics and saves the given ones in one transaction.
+func (s *PGStorage) ReplaceMetrics(gauges map[string]float64, counters map[string]int64) error {
+	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	defer cancel()
+	backoff := retry.WithMaxRetries(
+		maxRetries,
+		retry.WithCappedDuration(
+			expectIncrease,
+			retry.NewFibonacci(startExpect),
+		),
+	)
+
+	if err := retry.Do(
+		ctx,
+		backoff,
+		func(ctx context.Context) error {
+			tx, err := s.dbConnect.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+			if err != nil {
+				return fmt.Errorf("failed init DB transaction: %v", err)
+			}
+
+			for _, table := range []string{gaugeTable, counterTable} {
+				if _, err = tx.Exec(fmt.Sprintf("DELETE FROM %s", table)); err != nil {
+					tx.Rollback()
+					return fmt.Errorf("failed clear table %s: %v", table, err)
+				}
+			}
+
+			if err = insertValues(tx, gaugeTable, gauges); err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			if err = insertValues(tx, counterTable, counters); err != nil {
+				tx.Rollback()
+				return err
+			}
+
+			if err = tx.Commit(); err != nil {
+				return fmt.Errorf("failed commit query result: %v", err)
+			}
+
+			return nil
+		},
+	); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// rows in one insert, Postgres allows at most 65535 parameters in a query.
+const insertChunk = 1000
+
+func insertValues[T Number](tx *sql.Tx, table string, metrics map[string]T) error {
+	args := make([]any, 0, 2*min(len(metrics), insertChunk))
+	values := make([]string, 0, min(len(metrics), insertChunk))
+	flush := func() error {
+		if len(values) == 0 {
+			return nil
+		}
+		if _, err := tx.Exec(fmt.Sprintf(insertQuery, table, strings.Join(values, ",")), args...); err != nil {
+			return fmt.Errorf("failed insert into %s: %v", table, err)
+		}
+		args, values = args[:0], values[:0]
+		return nil
+	}
+
+	for name, value := range metrics {
+		i := len(args) + 1
+		values = append(values, fmt.Sprintf("($%d, $%d::%s)", i, i+1, valueType[table]))
+		args = append(args, name, value)
+		if len(values) == insertChunk {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+
+	return flush()
+}
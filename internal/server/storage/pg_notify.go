@@ -0,0 +1,68 @@
+package humaystorage
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	notifyChannel        = "humay_metrics"
+	listenMinReconnect   = 1 * time.Second
+	listenMaxReconnect   = 1 * time.Minute
+	listenerPingInterval = 1 * time.Minute
+)
+
+var tableMetricType = map[string]string{
+	counterTable: "counter",
+	gaugeTable:   "gauge",
+}
+
+// MetricChange is a metric changed in the database by any server.
+// Empty Name means all metrics of the type, empty MType means all metrics,
+// e.g. after reconnect, when notifications could be lost.
+type MetricChange struct {
+	MType string
+	Name  string
+}
+
+// Listen calls onChange for every metric changed in the database until ctx is done.
+func (s *PGStorage) Listen(ctx context.Context, onChange func(MetricChange)) error {
+	listener := pq.NewListener(s.dsn, listenMinReconnect, listenMaxReconnect, nil)
+	defer listener.Close()
+
+	if err := listener.Listen(notifyChannel); err != nil {
+		return fmt.Errorf("failed listen channel %s: %v", notifyChannel, err)
+	}
+
+	ticker := time.NewTicker(listenerPingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case notification := <-listener.Notify:
+			// nil notification is sent after reconnect.
+			if notification == nil {
+				onChange(MetricChange{})
+				continue
+			}
+			onChange(parseNotification(notification.Extra))
+		case <-ticker.C:
+			go listener.Ping()
+		}
+	}
+}
+
+func parseNotification(payload string) MetricChange {
+	table, name, ok := strings.Cut(payload, ":")
+	mType, known := tableMetricType[table]
+	if !ok || !known {
+		return MetricChange{}
+	}
+
+	return MetricChange{MType: mType, Name: name}
+}
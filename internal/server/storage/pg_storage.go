@@ -27,6 +27,7 @@ type Number interface {
 type PGStorage struct {
 	storageType string
 	dbConnect   *sql.DB
+	dsn         string
 }
 
 func NewPGStorage(dsn string) (*PGStorage, error) {
@@ -38,6 +39,7 @@ func NewPGStorage(dsn string) (*PGStorage, error) {
 	pgStorage := &PGStorage{
 		storageType: postgresDriver,
 		dbConnect:   db,
+		dsn:         dsn,
 	}
 
 	err = pgStorage.CheckDBConnect()
@@ -269,3 +271,46 @@ func updateMetric[T Number](db *sql.DB, table, name string, value T) error {
 
 	return nil
 }
+
+func (s *PGStorage) DumpMetrics() (map[string]float64, map[string]int64, error) {
+	gauges, err := selectAll[float64](s.dbConnect, gaugeTable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	counters, err := selectAll[int64](s.dbConnect, counterTable)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return gauges, counters, nil
+}
+
+func selectAll[T Number](db *sql.DB, table string) (map[string]T, error) {
+	sql, args, err := sq.Select("name", "value").From(table).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select query for %s: %v", table, err)
+	}
+
+	rows, err := db.Query(sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed select metrics from %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	metrics := make(map[string]T)
+	for rows.Next() {
+		var name string
+		var value T
+		if err = rows.Scan(&name, &value); err != nil {
+			return nil, fmt.Errorf("failed scan metric from %s: %v", table, err)
+		}
+		metrics[name] = value
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed read metrics from %s: %v", table, err)
+	}
+
+	return metrics, nil
+}
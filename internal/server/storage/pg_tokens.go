@@ -0,0 +1,117 @@
+package humaystorage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/lib/pq"
+
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+)
+
+const (
+	tokenTable            = "api_tokens"
+	createTokenTableQuery = "CREATE TABLE api_tokens (id text NOT NULL PRIMARY KEY, name text NOT NULL, scopes text[] NOT NULL, secret_hash text NOT NULL, created_at timestamptz NOT NULL)"
+)
+
+var tokenColumns = []string{"id", "name", "scopes", "secret_hash", "created_at"}
+
+func (s *PGStorage) CreateToken(token *humayAuth.Token) error {
+	sql, args, err := sq.Insert(tokenTable).
+		Columns(tokenColumns...).
+		Values(token.ID, token.Name, pq.Array(token.Scopes), token.SecretHash, token.CreatedAt).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate insert query for token %s: %v", token.ID, err)
+	}
+
+	if _, err = s.dbConnect.Exec(sql, args...); err != nil {
+		return fmt.Errorf("failed insert token %s: %v", token.ID, err)
+	}
+
+	return nil
+}
+
+func (s *PGStorage) GetToken(id string) (*humayAuth.Token, error) {
+	query, args, err := sq.Select(tokenColumns...).From(tokenTable).Where(sq.Eq{"id": id}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select query for token %s: %v", id, err)
+	}
+
+	token, err := scanToken(s.dbConnect.QueryRow(query, args...))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, humayAuth.ErrTokenNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed select token %s: %v", id, err)
+	}
+
+	return token, nil
+}
+
+func (s *PGStorage) ListTokens() ([]*humayAuth.Token, error) {
+	sql, args, err := sq.Select(tokenColumns...).From(tokenTable).OrderBy("created_at", "id").PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("failed generate select query for tokens: %v", err)
+	}
+
+	rows, err := s.dbConnect.Query(sql, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed select tokens: %v", err)
+	}
+	defer rows.Close()
+
+	var tokens []*humayAuth.Token
+	for rows.Next() {
+		token, err := scanToken(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed scan token: %v", err)
+		}
+		tokens = append(tokens, token)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed read tokens: %v", err)
+	}
+
+	return tokens, nil
+}
+
+func (s *PGStorage) DeleteToken(id string) error {
+	sql, args, err := sq.Delete(tokenTable).Where(sq.Eq{"id": id}).PlaceholderFormat(sq.Dollar).ToSql()
+	if err != nil {
+		return fmt.Errorf("failed generate delete query for token %s: %v", id, err)
+	}
+
+	result, err := s.dbConnect.Exec(sql, args...)
+	if err != nil {
+		return fmt.Errorf("failed delete token %s: %v", id, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed get count of the affected rows: %v", err)
+	}
+	if n == 0 {
+		return humayAuth.ErrTokenNotFound
+	}
+
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanToken(row scanner) (*humayAuth.Token, error) {
+	token := &humayAuth.Token{}
+	err := row.Scan(&token.ID, &token.Name, pq.Array(&token.Scopes), &token.SecretHash, &token.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
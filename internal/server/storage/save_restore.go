@@ -1,23 +1,72 @@
 package humaystorage
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/sethvargo/go-retry"
 )
 
 const (
-	saveTimeout    = 10 * time.Second
-	expectIncrease = 2 * time.Second
-	startExpect    = 1 * time.Second
-	maxRetries     = 4
+	saveTimeout       = 10 * time.Second
+	expectIncrease    = 2 * time.Second
+	startExpect       = 1 * time.Second
+	maxRetries        = 4
+	snapshotMagic     = "#humay-snapshot"
+	snapshotVersion   = "v1"
+	defaultGeneration = 3
+	// saves after every write keep one generation per period, not one per write.
+	autoSaveRotation = time.Minute
 )
 
+var ErrBadChecksum = errors.New("snapshot checksum mismatch")
+
+// snapshot header: `#humay-snapshot v1 sha256=<hex> size=<bytes> seq=<last wal record>`.
+type snapshotHeader struct {
+	checksum string
+	size     int
+	seq      uint64
+}
+
+func (h snapshotHeader) String() string {
+	return fmt.Sprintf("%s %s sha256=%s size=%d seq=%d\n", snapshotMagic, snapshotVersion, h.checksum, h.size, h.seq)
+}
+
+// SetGenerations sets how many previous snapshots are kept next to the storage file.
+func (s *MemStorage) SetGenerations(n int) {
+	if n < 0 {
+		n = 0
+	}
+	s.generations = n
+}
+
 func (s *MemStorage) Save() error {
+	return s.save(true)
+}
+
+// autoSave saves the storage after a write, generations are rotated once in autoSaveRotation.
+func (s *MemStorage) autoSave() error {
+	return s.save(false)
+}
+
+// save writes the snapshot and compacts the log under one lock,
+// so an older snapshot never replaces a newer one and the log is never compacted past the file.
+// A snapshot equal to the written one is skipped.
+func (s *MemStorage) save(rotate bool) error {
+	s.saveMx.Lock()
+	defer s.saveMx.Unlock()
+
 	ctx, cancel := context.WithTimeout(context.Background(), saveTimeout)
 	defer cancel()
 	backoff := retry.WithMaxRetries(
@@ -28,30 +77,29 @@ func (s *MemStorage) Save() error {
 		),
 	)
 
+	s.mx.RLock()
+	buf, err := json.Marshal(s)
+	seq := s.seq
+	s.mx.RUnlock()
+	if err != nil {
+		return fmt.Errorf("failed marshal storage: %v", err)
+	}
+	sum := sha256.Sum256(buf)
+	if seq < s.savedSeq || seq == s.savedSeq && sum == s.savedSum {
+		return nil
+	}
+
+	generations := s.generations
+	if !rotate && time.Since(s.rotatedAt) < autoSaveRotation {
+		generations = 0
+	}
+
 	if err := retry.Do(
 		ctx,
 		backoff,
 		func(ctx context.Context) error {
-			s.mx.RLock()
-			buf, err := json.Marshal(s)
-			if err != nil {
-				return err
-			}
-			s.mx.RUnlock()
-
-			file, err := os.OpenFile(s.storageFile, os.O_WRONLY|os.O_CREATE, 0666)
-			if err != nil {
-				return err
-			}
-			defer file.Close()
-
-			n, err := file.Write(buf)
-			if err != nil {
-				return err
-			}
-
-			if n == 0 {
-				return errors.New("nothing is saved")
+			if err := writeSnapshot(s.storageFile, buf, seq, generations); err != nil {
+				return retry.RetryableError(err)
 			}
 
 			return nil
@@ -59,15 +107,232 @@ func (s *MemStorage) Save() error {
 	); err != nil {
 		return err
 	}
+	s.savedSeq, s.savedSum = seq, sum
+	if generations > 0 {
+		s.rotatedAt = time.Now()
+	}
+
+	// the file covers everything up to its seq, so the log can be compacted.
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.wal != nil {
+		return s.wal.compact(s.savedSeq)
+	}
 
 	return nil
 }
 
+// Restore loads the newest valid snapshot and replays the write-ahead log on top of it.
+// If the file is damaged, older generations are tried one by one.
 func (s *MemStorage) Restore(filePath string) error {
-	buf, err := os.ReadFile(filePath)
+	var errs []error
+	loaded := false
+	for i := 0; i <= s.generations && !loaded; i++ {
+		buf, header, err := readSnapshot(generationFile(filePath, i))
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		s.mx.Lock()
+		err = json.Unmarshal(buf, s)
+		if err == nil {
+			s.seq = header.seq
+		}
+		s.mx.Unlock()
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed unmarshal snapshot %s: %v", generationFile(filePath, i), err))
+			continue
+		}
+
+		loaded = true
+	}
+
+	replayed, err := s.replayWAL(filePath)
+	if err != nil {
+		return err
+	}
+
+	if loaded || replayed > 0 {
+		return nil
+	}
+
+	return errors.Join(errs...)
+}
+
+// write data to temporary file, sync it and rename over the previous snapshot.
+func writeSnapshot(storageFile string, data []byte, seq uint64, generations int) (err error) {
+	dir := filepath.Dir(storageFile)
+	tmp, err := os.CreateTemp(dir, filepath.Base(storageFile)+".tmp-*")
 	if err != nil {
+		return fmt.Errorf("failed create temporary file: %v", err)
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	sum := sha256.Sum256(data)
+	header := snapshotHeader{
+		checksum: hex.EncodeToString(sum[:]),
+		size:     len(data),
+		seq:      seq,
+	}
+
+	w := bufio.NewWriter(tmp)
+	if _, err = w.WriteString(header.String()); err != nil {
+		return fmt.Errorf("failed write snapshot header: %v", err)
+	}
+	if _, err = w.Write(data); err != nil {
+		return fmt.Errorf("failed write snapshot: %v", err)
+	}
+	if err = w.Flush(); err != nil {
+		return fmt.Errorf("failed write snapshot: %v", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		return fmt.Errorf("failed sync snapshot: %v", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed close snapshot: %v", err)
+	}
+
+	if err = rotateGenerations(storageFile, generations); err != nil {
 		return err
 	}
 
-	return json.Unmarshal(buf, s)
+	if err = os.Rename(tmp.Name(), storageFile); err != nil {
+		return fmt.Errorf("failed rename snapshot: %v", err)
+	}
+
+	return syncDir(dir)
+}
+
+// shift file -> file.1 -> file.2 ... and drop the oldest one.
+func rotateGenerations(storageFile string, generations int) error {
+	if generations == 0 {
+		return nil
+	}
+
+	for i := generations - 1; i >= 0; i-- {
+		from := generationFile(storageFile, i)
+		if _, err := os.Stat(from); err != nil {
+			continue
+		}
+
+		to := generationFile(storageFile, i+1)
+		if i == 0 {
+			// keep the current snapshot in place until the new one is renamed over it.
+			if err := copyFile(from, to); err != nil {
+				return fmt.Errorf("failed keep snapshot generation: %v", err)
+			}
+			continue
+		}
+
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("failed rotate snapshot generation: %v", err)
+		}
+	}
+
+	return nil
+}
+
+func generationFile(storageFile string, generation int) string {
+	if generation == 0 {
+		return storageFile
+	}
+
+	return storageFile + "." + strconv.Itoa(generation)
+}
+
+func copyFile(from, to string) error {
+	data, err := os.ReadFile(from)
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(to, data, 0600)
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("failed open storage directory: %v", err)
+	}
+	defer d.Close()
+
+	if err = d.Sync(); err != nil {
+		return fmt.Errorf("failed sync storage directory: %v", err)
+	}
+
+	return nil
+}
+
+// read snapshot and check its checksum. Files without header are accepted as is.
+func readSnapshot(filePath string) ([]byte, snapshotHeader, error) {
+	var header snapshotHeader
+	buf, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, header, err
+	}
+
+	if !bytes.HasPrefix(buf, []byte(snapshotMagic)) {
+		return buf, header, nil
+	}
+
+	line, data, ok := bytes.Cut(buf, []byte("\n"))
+	if !ok {
+		return nil, header, fmt.Errorf("snapshot %s: %w", filePath, ErrBadChecksum)
+	}
+
+	header, err = parseSnapshotHeader(string(line))
+	if err != nil {
+		return nil, header, fmt.Errorf("snapshot %s: %v", filePath, err)
+	}
+
+	sum := sha256.Sum256(data)
+	if len(data) != header.size || hex.EncodeToString(sum[:]) != header.checksum {
+		return nil, header, fmt.Errorf("snapshot %s: %w", filePath, ErrBadChecksum)
+	}
+
+	return data, header, nil
+}
+
+func parseSnapshotHeader(line string) (snapshotHeader, error) {
+	var header snapshotHeader
+
+	fields := strings.Fields(line)
+	if len(fields) < 2 || fields[0] != snapshotMagic {
+		return header, errors.New("wrong snapshot header")
+	}
+	if fields[1] != snapshotVersion {
+		return header, fmt.Errorf("unsupported snapshot version %s", fields[1])
+	}
+
+	for _, field := range fields[2:] {
+		key, value, _ := strings.Cut(field, "=")
+		switch key {
+		case "sha256":
+			header.checksum = value
+		case "size":
+			size, err := strconv.Atoi(value)
+			if err != nil {
+				return header, fmt.Errorf("wrong snapshot size %s", value)
+			}
+			header.size = size
+		case "seq":
+			seq, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return header, fmt.Errorf("wrong snapshot sequence %s", value)
+			}
+			header.seq = seq
+		}
+	}
+
+	if header.checksum == "" {
+		return header, errors.New("absent snapshot checksum")
+	}
+
+	return header, nil
 }
@@ -2,22 +2,52 @@ package humaystorage
 
 import (
 	"context"
+	"crypto/sha256"
 	"errors"
 	"fmt"
 	"strconv"
 	"sync"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
+
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
 )
 
+// Storage keeps gauges and counters, the server wraps it by buffers, caches and telemetry.
+type Storage interface {
+	GetGaugeMetric(name string) (float64, error)
+	PutGaugeMetric(name string, value float64) error
+	PutGaugeMetrics(map[string]float64) error
+	GetCounterMetric(name string) (int64, error)
+	PutCounterMetric(name string, value int64) error
+	PutCounterMetrics(map[string]int64) error
+	GetAllMetrics() map[string]map[string]string
+	DumpMetrics() (map[string]float64, map[string]int64, error)
+	ReplaceMetrics(gauges map[string]float64, counters map[string]int64) error
+	CheckDBConnect() error
+	GetType() string
+	Close() error
+}
+
 type MemStorage struct {
 	mx             sync.RWMutex
 	autosave       bool
+	saveMx         sync.Mutex
+	savedSeq       uint64
+	savedSum       [sha256.Size]byte
+	rotatedAt      time.Time
+	errMx          sync.Mutex
+	saveErr        error
 	storageType    string
 	storageFile    string
-	GaugeMetrics   map[string]float64 `json:"gauge_metrics,omitempty"`
-	CounterMetrics map[string]int64   `json:"counter_metrics,omitempty"`
+	generations    int
+	wal            *writeAheadLog
+	seq            uint64
+	GaugeMetrics   map[string]float64          `json:"gauge_metrics,omitempty"`
+	CounterMetrics map[string]int64            `json:"counter_metrics,omitempty"`
+	APITokens      map[string]*humayAuth.Token `json:"api_tokens,omitempty"`
 	dsn            string
 }
 
@@ -26,8 +56,10 @@ func NewStorage(storageFile string, dsn string) *MemStorage {
 		autosave:       false,
 		storageType:    "struct",
 		storageFile:    storageFile,
+		generations:    defaultGeneration,
 		GaugeMetrics:   make(map[string]float64),
 		CounterMetrics: make(map[string]int64),
+		APITokens:      make(map[string]*humayAuth.Token),
 		dsn:            dsn,
 	}
 }
@@ -40,7 +72,24 @@ func (s *MemStorage) SetAutoSave() {
 	s.autosave = true
 }
 
+// CheckAutoSave returns the error of the last save made after a write.
+func (s *MemStorage) CheckAutoSave(ctx context.Context) error {
+	s.errMx.Lock()
+	defer s.errMx.Unlock()
+	if s.saveErr != nil {
+		return fmt.Errorf("last save failed: %v", s.saveErr)
+	}
+
+	return nil
+}
+
 func (s *MemStorage) Close() error {
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	if s.wal != nil {
+		return s.wal.close()
+	}
+
 	return nil
 }
 
@@ -56,16 +105,7 @@ func (s *MemStorage) GetGaugeMetric(name string) (value float64, err error) {
 }
 
 func (s *MemStorage) PutGaugeMetric(name string, value float64) (err error) {
-	defer func() {
-		if s.autosave {
-			s.Save()
-		}
-	}()
-	s.mx.Lock()
-	defer s.mx.Unlock()
-	s.GaugeMetrics[name] = value
-
-	return
+	return s.commitMetrics(false, map[string]float64{name: value}, nil)
 }
 
 func (s *MemStorage) GetCounterMetric(name string) (value int64, err error) {
@@ -80,16 +120,7 @@ func (s *MemStorage) GetCounterMetric(name string) (value int64, err error) {
 }
 
 func (s *MemStorage) PutCounterMetric(name string, value int64) (err error) {
-	defer func() {
-		if s.autosave {
-			s.Save()
-		}
-	}()
-	s.mx.Lock()
-	defer s.mx.Unlock()
-	s.CounterMetrics[name] = s.CounterMetrics[name] + value
-
-	return
+	return s.commitMetrics(false, nil, map[string]int64{name: value})
 }
 
 func (s *MemStorage) GetAllMetrics() map[string]map[string]string {
@@ -138,23 +169,71 @@ func (s *MemStorage) CheckDBConnect() error {
 }
 
 func (s *MemStorage) PutGaugeMetrics(metrics map[string]float64) (err error) {
-	for name, value := range metrics {
-		err = s.PutGaugeMetric(name, value)
-		if err != nil {
+	return s.commitMetrics(false, metrics, nil)
+}
+
+func (s *MemStorage) PutCounterMetrics(metrics map[string]int64) (err error) {
+	return s.commitMetrics(false, nil, metrics)
+}
+
+// write the operations to the log first and apply them only if the log accepted them.
+func (s *MemStorage) commitMetrics(reset bool, gauges map[string]float64, counters map[string]int64) error {
+	defer func() {
+		if s.autosave {
+			err := s.autoSave()
+			s.errMx.Lock()
+			s.saveErr = err
+			s.errMx.Unlock()
+		}
+	}()
+	s.mx.Lock()
+	defer s.mx.Unlock()
+
+	records := make([]walRecord, 0, len(gauges)+len(counters)+1)
+	seq := s.seq
+	if reset {
+		seq++
+		records = append(records, walRecord{Seq: seq, Op: walOpReset})
+	}
+	for name, value := range gauges {
+		seq++
+		records = append(records, walRecord{Seq: seq, Op: walOpGauge, Name: name, Value: value})
+	}
+	for name, delta := range counters {
+		seq++
+		records = append(records, walRecord{Seq: seq, Op: walOpCounter, Name: name, Delta: delta})
+	}
+
+	if s.wal != nil {
+		if err := s.wal.append(records); err != nil {
 			return err
 		}
 	}
 
+	for _, record := range records {
+		s.applyWALRecord(record)
+	}
+
 	return nil
 }
 
-func (s *MemStorage) PutCounterMetrics(metrics map[string]int64) (err error) {
-	for name, value := range metrics {
-		err = s.PutCounterMetric(name, value)
-		if err != nil {
-			return err
-		}
+func (s *MemStorage) DumpMetrics() (map[string]float64, map[string]int64, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	gauges := make(map[string]float64, len(s.GaugeMetrics))
+	for name, value := range s.GaugeMetrics {
+		gauges[name] = value
 	}
 
-	return nil
+	counters := make(map[string]int64, len(s.CounterMetrics))
+	for name, value := range s.CounterMetrics {
+		counters[name] = value
+	}
+
+	return gauges, counters, nil
+}
+
+// ReplaceMetrics drops all stored metrics and saves the given ones instead.
+func (s *MemStorage) ReplaceMetrics(gauges map[string]float64, counters map[string]int64) error {
+	return s.commitMetrics(true, gauges, counters)
 }
@@ -1,7 +1,11 @@
 package humaystorage
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
@@ -70,3 +74,207 @@ func TestCounterMetric(t *testing.T) {
 		time.Sleep(time.Second)
 	}
 }
+
+func TestSaveRestore(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := NewStorage(storageFile, "")
+	assert.NoError(t, storage.PutGaugeMetric("Alloc", 1.5))
+	assert.NoError(t, storage.PutCounterMetric("PollCount", 10))
+	assert.NoError(t, storage.Save())
+
+	restored := NewStorage(storageFile, "")
+	assert.NoError(t, restored.Restore(storageFile))
+	assert.Equal(t, storage.GaugeMetrics, restored.GaugeMetrics)
+	assert.Equal(t, storage.CounterMetrics, restored.CounterMetrics)
+
+	// shorter snapshot must not keep the tail of the previous one.
+	short := NewStorage(storageFile, "")
+	assert.NoError(t, short.PutGaugeMetric("A", 1))
+	assert.NoError(t, short.Save())
+
+	restored = NewStorage(storageFile, "")
+	assert.NoError(t, restored.Restore(storageFile))
+	assert.Equal(t, map[string]float64{"A": 1}, restored.GaugeMetrics)
+	assert.Empty(t, restored.CounterMetrics)
+}
+
+func TestRestoreBrokenSnapshot(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := NewStorage(storageFile, "")
+	assert.NoError(t, storage.PutGaugeMetric("A", 1))
+	assert.NoError(t, storage.Save())
+	assert.NoError(t, storage.PutGaugeMetric("A", 2))
+	assert.NoError(t, storage.Save())
+
+	// damage the newest snapshot.
+	data, err := os.ReadFile(storageFile)
+	assert.NoError(t, err)
+	data[len(data)-2] = '9'
+	assert.NoError(t, os.WriteFile(storageFile, data, 0600))
+
+	_, _, err = readSnapshot(storageFile)
+	assert.ErrorIs(t, err, ErrBadChecksum)
+
+	// restore falls back to the previous generation.
+	restored := NewStorage(storageFile, "")
+	assert.NoError(t, restored.Restore(storageFile))
+	assert.Equal(t, map[string]float64{"A": 1}, restored.GaugeMetrics)
+
+	// without generations there is nothing to fall back to.
+	restored = NewStorage(storageFile, "")
+	restored.SetGenerations(0)
+	assert.Error(t, restored.Restore(storageFile))
+}
+
+func TestSnapshotGenerations(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := NewStorage(storageFile, "")
+	storage.SetGenerations(2)
+	for i := range 5 {
+		assert.NoError(t, storage.PutGaugeMetric("A", float64(i)))
+		assert.NoError(t, storage.Save())
+	}
+
+	for generation, value := range []float64{4, 3, 2} {
+		data, _, err := readSnapshot(generationFile(storageFile, generation))
+		assert.NoError(t, err)
+		assert.Contains(t, string(data), fmt.Sprintf(`"A":%v`, value))
+	}
+
+	_, err := os.Stat(generationFile(storageFile, 3))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestAutoSaveConcurrent(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := NewStorage(storageFile, "")
+	storage.SetAutoSave()
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, storage.PutCounterMetric("C", 1))
+		}()
+	}
+	wg.Wait()
+	assert.NoError(t, storage.CheckAutoSave(context.Background()))
+
+	// the last snapshot holds every write.
+	restored := NewStorage(storageFile, "")
+	assert.NoError(t, restored.Restore(storageFile))
+	assert.Equal(t, map[string]int64{"C": 20}, restored.CounterMetrics)
+
+	// writes within a minute keep a single generation.
+	_, err := os.Stat(generationFile(storageFile, 2))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestWALReplay(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := NewStorage(storageFile, "")
+	assert.NoError(t, storage.EnableWAL())
+	assert.NoError(t, storage.PutGaugeMetric("A", 1))
+	assert.NoError(t, storage.PutCounterMetrics(map[string]int64{"C": 2, "D": 3}))
+	assert.NoError(t, storage.Save())
+	assert.NoError(t, storage.PutGaugeMetric("A", 5))
+	assert.NoError(t, storage.PutCounterMetric("C", 10))
+
+	// only records after the last snapshot stay in the log.
+	records, err := readWAL(walFile(storageFile))
+	assert.NoError(t, err)
+	assert.Len(t, records, 2)
+
+	// crash: nothing is saved, the tail of the log is torn.
+	file, err := os.OpenFile(walFile(storageFile), os.O_WRONLY|os.O_APPEND, 0600)
+	assert.NoError(t, err)
+	_, err = file.WriteString(`0000 {"seq":100,"op":"gauge","na`)
+	assert.NoError(t, err)
+	assert.NoError(t, file.Close())
+
+	restored := NewStorage(storageFile, "")
+	assert.NoError(t, restored.Restore(storageFile))
+	assert.Equal(t, map[string]float64{"A": 5}, restored.GaugeMetrics)
+	assert.Equal(t, map[string]int64{"C": 12, "D": 3}, restored.CounterMetrics)
+
+	// the torn tail is dropped when the log is enabled again.
+	assert.NoError(t, restored.EnableWAL())
+	assert.NoError(t, restored.PutCounterMetric("C", 1))
+	assert.NoError(t, restored.Close())
+
+	again := NewStorage(storageFile, "")
+	assert.NoError(t, again.Restore(storageFile))
+	assert.Equal(t, map[string]int64{"C": 13, "D": 3}, again.CounterMetrics)
+}
+
+func TestWALConcurrentSaves(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := NewStorage(storageFile, "")
+	assert.NoError(t, storage.EnableWAL())
+	var wg sync.WaitGroup
+	for i := range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, storage.PutCounterMetric("C", 1))
+			// the saver and token changes save at the same time.
+			if i%2 == 0 {
+				assert.NoError(t, storage.Save())
+			} else {
+				assert.NoError(t, storage.saveTokens())
+			}
+		}()
+	}
+	wg.Wait()
+
+	// the snapshot and the log stay contiguous.
+	restored := NewStorage(storageFile, "")
+	assert.NoError(t, restored.Restore(storageFile))
+	assert.Equal(t, map[string]int64{"C": 20}, restored.CounterMetrics)
+}
+
+func TestWALWithoutRestore(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := NewStorage(storageFile, "")
+	assert.NoError(t, storage.EnableWAL())
+	assert.NoError(t, storage.PutCounterMetric("C", 200))
+
+	// the next run starts empty and crashes without a snapshot.
+	fresh := NewStorage(storageFile, "")
+	assert.NoError(t, fresh.EnableWAL())
+	assert.NoError(t, fresh.PutCounterMetric("C", 1))
+
+	restored := NewStorage(storageFile, "")
+	assert.NoError(t, restored.Restore(storageFile))
+	assert.Equal(t, map[string]int64{"C": 1}, restored.CounterMetrics)
+}
+
+func TestWALAfterFallback(t *testing.T) {
+	storageFile := filepath.Join(t.TempDir(), "metrics.json")
+
+	storage := NewStorage(storageFile, "")
+	assert.NoError(t, storage.EnableWAL())
+	for i := range 3 {
+		assert.NoError(t, storage.PutGaugeMetric("A", float64(i+1)))
+		if i < 2 {
+			assert.NoError(t, storage.Save())
+		}
+	}
+
+	// damage the newest snapshot, the log is already compacted past the previous one.
+	data, err := os.ReadFile(storageFile)
+	assert.NoError(t, err)
+	data[len(data)-2] = '9'
+	assert.NoError(t, os.WriteFile(storageFile, data, 0600))
+
+	restored := NewStorage(storageFile, "")
+	assert.Error(t, restored.Restore(storageFile))
+	assert.Equal(t, map[string]float64{"A": 1}, restored.GaugeMetrics)
+}
@@ -0,0 +1,70 @@
+package humaystorage
+
+import (
+	"fmt"
+	"sort"
+
+	humayAuth "github.com/zvfkjytytw/humay/internal/server/auth"
+)
+
+// tokens are not written to the log, so the snapshot is saved right after every change.
+func (s *MemStorage) CreateToken(token *humayAuth.Token) error {
+	s.mx.Lock()
+	if _, ok := s.APITokens[token.ID]; ok {
+		s.mx.Unlock()
+		return fmt.Errorf("token %s already exists", token.ID)
+	}
+	stored := *token
+	s.APITokens[token.ID] = &stored
+	s.mx.Unlock()
+
+	return s.saveTokens()
+}
+
+func (s *MemStorage) GetToken(id string) (*humayAuth.Token, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	token, ok := s.APITokens[id]
+	if !ok {
+		return nil, humayAuth.ErrTokenNotFound
+	}
+	found := *token
+
+	return &found, nil
+}
+
+func (s *MemStorage) ListTokens() ([]*humayAuth.Token, error) {
+	s.mx.RLock()
+	defer s.mx.RUnlock()
+	tokens := make([]*humayAuth.Token, 0, len(s.APITokens))
+	for _, token := range s.APITokens {
+		found := *token
+		tokens = append(tokens, &found)
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		return tokens[i].CreatedAt.Before(tokens[j].CreatedAt) ||
+			tokens[i].CreatedAt.Equal(tokens[j].CreatedAt) && tokens[i].ID < tokens[j].ID
+	})
+
+	return tokens, nil
+}
+
+func (s *MemStorage) DeleteToken(id string) error {
+	s.mx.Lock()
+	if _, ok := s.APITokens[id]; !ok {
+		s.mx.Unlock()
+		return humayAuth.ErrTokenNotFound
+	}
+	delete(s.APITokens, id)
+	s.mx.Unlock()
+
+	return s.saveTokens()
+}
+
+func (s *MemStorage) saveTokens() error {
+	if s.storageFile == "" {
+		return nil
+	}
+
+	return s.Save()
+}
@@ -0,0 +1,261 @@
+package humaystorage
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+const (
+	walSuffix    = ".wal"
+	walOpGauge   = "gauge"
+	walOpCounter = "counter"
+	walOpReset   = "reset"
+)
+
+// walRecord is one put operation. Counter records keep the delta, not the result.
+type walRecord struct {
+	Seq   uint64  `json:"seq"`
+	Op    string  `json:"op"`
+	Name  string  `json:"name"`
+	Value float64 `json:"value,omitempty"`
+	Delta int64   `json:"delta,omitempty"`
+}
+
+// writeAheadLog is an append-only file of records: `<crc32> <json>\n` per line.
+type writeAheadLog struct {
+	path string
+	file *os.File
+}
+
+func walFile(storageFile string) string {
+	return storageFile + walSuffix
+}
+
+func openWAL(path string) (*writeAheadLog, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed open write-ahead log: %v", err)
+	}
+
+	return &writeAheadLog{
+		path: path,
+		file: file,
+	}, nil
+}
+
+// append writes records and syncs the file once for the whole batch.
+func (l *writeAheadLog) append(records []walRecord) error {
+	buf := &bytes.Buffer{}
+	for _, record := range records {
+		if err := encodeWALRecord(buf, record); err != nil {
+			return err
+		}
+	}
+
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed write to write-ahead log: %v", err)
+	}
+
+	if err := l.file.Sync(); err != nil {
+		return fmt.Errorf("failed sync write-ahead log: %v", err)
+	}
+
+	return nil
+}
+
+// compact drops the records already covered by the snapshot with sequence seq.
+func (l *writeAheadLog) compact(seq uint64) error {
+	records, err := readWAL(l.path)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	for _, record := range records {
+		if record.Seq <= seq {
+			continue
+		}
+		if err := encodeWALRecord(buf, record); err != nil {
+			return err
+		}
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("failed create temporary write-ahead log: %v", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed write temporary write-ahead log: %v", err)
+	}
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed sync temporary write-ahead log: %v", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("failed close temporary write-ahead log: %v", err)
+	}
+
+	if err = l.file.Close(); err != nil {
+		return fmt.Errorf("failed close write-ahead log: %v", err)
+	}
+	if err = os.Rename(tmp.Name(), l.path); err != nil {
+		return fmt.Errorf("failed replace write-ahead log: %v", err)
+	}
+
+	file, err := os.OpenFile(l.path, os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return fmt.Errorf("failed reopen write-ahead log: %v", err)
+	}
+	l.file = file
+
+	return syncDir(filepath.Dir(l.path))
+}
+
+func (l *writeAheadLog) close() error {
+	return l.file.Close()
+}
+
+func encodeWALRecord(buf *bytes.Buffer, record walRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed marshal write-ahead log record: %v", err)
+	}
+
+	buf.WriteString(fmt.Sprintf("%08x ", crc32.ChecksumIEEE(data)))
+	buf.Write(data)
+	buf.WriteByte('\n')
+
+	return nil
+}
+
+// readWAL returns all valid records. Reading stops at the first damaged line,
+// which is what a crash in the middle of a write leaves behind.
+func readWAL(path string) ([]walRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed open write-ahead log: %v", err)
+	}
+	defer file.Close()
+
+	var records []walRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		sum, data, ok := bytes.Cut(scanner.Bytes(), []byte(" "))
+		if !ok {
+			break
+		}
+
+		crc, err := strconv.ParseUint(string(sum), 16, 32)
+		if err != nil || uint32(crc) != crc32.ChecksumIEEE(data) {
+			break
+		}
+
+		var record walRecord
+		if err := json.Unmarshal(data, &record); err != nil {
+			break
+		}
+		records = append(records, record)
+	}
+
+	return records, nil
+}
+
+// EnableWAL makes every put durable through the write-ahead log next to the storage file.
+// The current state is saved first, so the log always starts on top of a fresh snapshot.
+// Sequence numbers continue from the highest one on disk, so records of a previous run
+// that was not restored are dropped by the compaction and never replayed.
+func (s *MemStorage) EnableWAL() error {
+	s.autosave = false
+	s.mx.Lock()
+	if last := lastSeq(s.storageFile, s.generations); last > s.seq {
+		s.seq = last
+	}
+	s.mx.Unlock()
+	if err := s.Save(); err != nil {
+		return fmt.Errorf("failed save snapshot before write-ahead log: %v", err)
+	}
+
+	wal, err := openWAL(walFile(s.storageFile))
+	if err != nil {
+		return err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	s.wal = wal
+
+	return wal.compact(s.seq)
+}
+
+// apply put operation to the maps. Caller must hold the lock.
+func (s *MemStorage) applyWALRecord(record walRecord) {
+	switch record.Op {
+	case walOpGauge:
+		s.GaugeMetrics[record.Name] = record.Value
+	case walOpCounter:
+		s.CounterMetrics[record.Name] += record.Delta
+	case walOpReset:
+		s.GaugeMetrics = make(map[string]float64)
+		s.CounterMetrics = make(map[string]int64)
+	}
+	if record.Seq > s.seq {
+		s.seq = record.Seq
+	}
+}
+
+// replay records from the write-ahead log that are newer than the loaded snapshot.
+func (s *MemStorage) replayWAL(filePath string) (int, error) {
+	records, err := readWAL(walFile(filePath))
+	if err != nil {
+		return 0, err
+	}
+
+	s.mx.Lock()
+	defer s.mx.Unlock()
+	replayed := 0
+	for _, record := range records {
+		if record.Seq <= s.seq {
+			continue
+		}
+		// the log was compacted past the loaded snapshot, e.g. after a fallback to an older generation.
+		if replayed == 0 && record.Seq != s.seq+1 {
+			return 0, fmt.Errorf("write-ahead log starts at record %d after snapshot record %d, it is not replayed", record.Seq, s.seq)
+		}
+		s.applyWALRecord(record)
+		replayed++
+	}
+
+	return replayed, nil
+}
+
+// lastSeq returns the highest sequence number of the snapshots and the write-ahead log on disk.
+func lastSeq(storageFile string, generations int) uint64 {
+	var last uint64
+	for i := 0; i <= generations; i++ {
+		_, header, err := readSnapshot(generationFile(storageFile, i))
+		if err == nil && header.seq > last {
+			last = header.seq
+		}
+	}
+
+	records, _ := readWAL(walFile(storageFile))
+	for _, record := range records {
+		if record.Seq > last {
+			last = record.Seq
+		}
+	}
+
+	return last
+}
@@ -0,0 +1,93 @@
+package humaytelemetry
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// prefix of the names in the Prometheus format.
+const exposedPrefix = "humay_"
+
+// Handler answers with all metrics of the registry in the Prometheus text format.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		buf := &bytes.Buffer{}
+		r.WritePrometheus(buf)
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		w.WriteHeader(http.StatusOK)
+		w.Write(buf.Bytes())
+	})
+}
+
+// WritePrometheus writes all metrics of the registry in the Prometheus text format.
+func (r *Registry) WritePrometheus(w io.Writer) {
+	gauges := runtimeGauges()
+	gauges["uptime_seconds"] = time.Since(r.started).Seconds()
+	for _, name := range sortedKeys(gauges, func(a, b string) bool { return a < b }) {
+		fmt.Fprintf(w, "# TYPE %s%s gauge\n%s%s %s\n", exposedPrefix, name, exposedPrefix, name, formatFloat(gauges[name]))
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	requests := sortedKeys(r.requests, func(a, b requestKey) bool {
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	fmt.Fprintf(w, "# TYPE %shttp_requests_total counter\n", exposedPrefix)
+	for _, key := range requests {
+		fmt.Fprintf(w, "%shttp_requests_total{%s} %d\n", exposedPrefix, key.labels(), r.requests[key].count)
+	}
+	fmt.Fprintf(w, "# TYPE %shttp_request_duration_seconds histogram\n", exposedPrefix)
+	for _, key := range requests {
+		writeHistogram(w, "http_request_duration_seconds", key.labels(), r.requests[key])
+	}
+
+	operations := sortedKeys(r.storage, func(a, b string) bool { return a < b })
+	fmt.Fprintf(w, "# TYPE %sstorage_errors_total counter\n", exposedPrefix)
+	for _, operation := range operations {
+		fmt.Fprintf(w, "%sstorage_errors_total{operation=%q} %d\n", exposedPrefix, operation, r.storage[operation].errors)
+	}
+	fmt.Fprintf(w, "# TYPE %sstorage_operation_duration_seconds histogram\n", exposedPrefix)
+	for _, operation := range operations {
+		writeHistogram(w, "storage_operation_duration_seconds", fmt.Sprintf("operation=%q", operation), r.storage[operation].latency)
+	}
+
+	fmt.Fprintf(w, "# TYPE %ssnapshot_errors_total counter\n%ssnapshot_errors_total %d\n", exposedPrefix, exposedPrefix, r.snapshots.errors)
+	fmt.Fprintf(w, "# TYPE %ssnapshot_duration_seconds histogram\n", exposedPrefix)
+	writeHistogram(w, "snapshot_duration_seconds", "", r.snapshots.latency)
+}
+
+func (k requestKey) labels() string {
+	return fmt.Sprintf("route=%q,method=%q,status=%q", k.route, k.method, k.status)
+}
+
+func writeHistogram(w io.Writer, name, labels string, h *Histogram) {
+	separator := ""
+	if labels != "" {
+		separator = ","
+	}
+	for i, bound := range latencyBuckets {
+		fmt.Fprintf(w, "%s%s_bucket{%s%sle=%q} %d\n", exposedPrefix, name, labels, separator, formatFloat(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s%s_bucket{%s%sle=\"+Inf\"} %d\n", exposedPrefix, name, labels, separator, h.count)
+	if labels != "" {
+		labels = "{" + labels + "}"
+	}
+	fmt.Fprintf(w, "%s%s_sum%s %s\n", exposedPrefix, name, labels, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s%s_count%s %d\n", exposedPrefix, name, labels, h.count)
+}
+
+func formatFloat(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,24 @@
+package humaytelemetry
+
+import (
+	"runtime"
+)
+
+// runtimeGauges are stats of the Go runtime without the prefix.
+func runtimeGauges() map[string]float64 {
+	var stats runtime.MemStats
+	runtime.ReadMemStats(&stats)
+
+	return map[string]float64{
+		"go_goroutines":          float64(runtime.NumGoroutine()),
+		"go_heap_alloc_bytes":    float64(stats.HeapAlloc),
+		"go_heap_objects":        float64(stats.HeapObjects),
+		"go_sys_bytes":           float64(stats.Sys),
+		"go_gc_total":            float64(stats.NumGC),
+		"go_gc_pause_seconds":    float64(stats.PauseTotalNs) / 1e9,
+		"go_gc_cpu_fraction":     stats.GCCPUFraction,
+		"go_next_gc_bytes":       float64(stats.NextGC),
+		"go_stack_inuse_bytes":   float64(stats.StackInuse),
+		"go_heap_released_bytes": float64(stats.HeapReleased),
+	}
+}
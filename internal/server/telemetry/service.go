@@ -0,0 +1,122 @@
+package humaytelemetry
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+const readHeaderTimeout = 5 * time.Second
+
+// Server exposes /metrics on the internal address apart from the API.
+type Server struct {
+	server *http.Server
+	logger *zap.Logger
+}
+
+func NewServer(address string, registry *Registry, logger *zap.Logger) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", registry.Handler())
+
+	return &Server{
+		server: &http.Server{
+			Addr:              address,
+			Handler:           mux,
+			ReadHeaderTimeout: readHeaderTimeout,
+		},
+		logger: logger,
+	}
+}
+
+func (s *Server) Start(ctx context.Context) error {
+	err := s.server.ListenAndServe()
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
+		s.logger.Sugar().Errorf("failed start telemetry server: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Server) Stop(ctx context.Context) error {
+	return s.server.Shutdown(ctx)
+}
+
+// Reporter stores the summary of the registry as ordinary metrics under the reserved prefix.
+type Reporter struct {
+	storage  humayStorage.Storage
+	registry *Registry
+	interval humayConfig.Seconds
+	// counters already stored, the storage sums deltas.
+	stored map[string]int64
+	done   chan struct{}
+	once   sync.Once
+	logger *zap.Logger
+}
+
+func NewReporter(storage humayStorage.Storage, registry *Registry, interval humayConfig.Seconds, logger *zap.Logger) *Reporter {
+	return &Reporter{
+		storage:  storage,
+		registry: registry,
+		interval: interval,
+		stored:   make(map[string]int64),
+		done:     make(chan struct{}),
+		logger:   logger,
+	}
+}
+
+func (r *Reporter) Start(ctx context.Context) error {
+	ticker := time.NewTicker(r.interval.Duration())
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := r.Report(); err != nil {
+				r.logger.Sugar().Errorf("failed store telemetry: %v", err)
+			}
+		case <-r.done:
+			return nil
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (r *Reporter) Stop(ctx context.Context) error {
+	r.once.Do(
+		func() {
+			close(r.done)
+		},
+	)
+	return nil
+}
+
+// Report stores gauges and the growth of counters since the previous report.
+func (r *Reporter) Report() error {
+	summary := r.registry.Summary()
+
+	err := r.storage.PutGaugeMetrics(summary.Gauges)
+	if err != nil {
+		return err
+	}
+
+	deltas := make(map[string]int64, len(summary.Counters))
+	for name, value := range summary.Counters {
+		deltas[name] = value - r.stored[name]
+	}
+	err = r.storage.PutCounterMetrics(deltas)
+	if err != nil {
+		return err
+	}
+	r.stored = summary.Counters
+
+	return nil
+}
@@ -0,0 +1,105 @@
+package humaytelemetry
+
+import (
+	"time"
+
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+// InstrumentedStorage measures latency and errors of every storage operation.
+// Errors of reads include absent metrics.
+type InstrumentedStorage struct {
+	humayStorage.Storage
+	registry *Registry
+}
+
+func NewInstrumentedStorage(storage humayStorage.Storage, registry *Registry) *InstrumentedStorage {
+	return &InstrumentedStorage{
+		Storage:  storage,
+		registry: registry,
+	}
+}
+
+func (s *InstrumentedStorage) observe(operation string, start time.Time, err error) {
+	s.registry.ObserveStorage(operation, time.Since(start), err)
+}
+
+func (s *InstrumentedStorage) GetGaugeMetric(name string) (float64, error) {
+	start := time.Now()
+	value, err := s.Storage.GetGaugeMetric(name)
+	s.observe("get_gauge", start, err)
+
+	return value, err
+}
+
+func (s *InstrumentedStorage) PutGaugeMetric(name string, value float64) error {
+	start := time.Now()
+	err := s.Storage.PutGaugeMetric(name, value)
+	s.observe("put_gauge", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) PutGaugeMetrics(metrics map[string]float64) error {
+	start := time.Now()
+	err := s.Storage.PutGaugeMetrics(metrics)
+	s.observe("put_gauges", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) GetCounterMetric(name string) (int64, error) {
+	start := time.Now()
+	value, err := s.Storage.GetCounterMetric(name)
+	s.observe("get_counter", start, err)
+
+	return value, err
+}
+
+func (s *InstrumentedStorage) PutCounterMetric(name string, value int64) error {
+	start := time.Now()
+	err := s.Storage.PutCounterMetric(name, value)
+	s.observe("put_counter", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) PutCounterMetrics(metrics map[string]int64) error {
+	start := time.Now()
+	err := s.Storage.PutCounterMetrics(metrics)
+	s.observe("put_counters", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) GetAllMetrics() map[string]map[string]string {
+	start := time.Now()
+	metrics := s.Storage.GetAllMetrics()
+	s.observe("get_all", start, nil)
+
+	return metrics
+}
+
+func (s *InstrumentedStorage) DumpMetrics() (map[string]float64, map[string]int64, error) {
+	start := time.Now()
+	gauges, counters, err := s.Storage.DumpMetrics()
+	s.observe("dump", start, err)
+
+	return gauges, counters, err
+}
+
+func (s *InstrumentedStorage) ReplaceMetrics(gauges map[string]float64, counters map[string]int64) error {
+	start := time.Now()
+	err := s.Storage.ReplaceMetrics(gauges, counters)
+	s.observe("replace", start, err)
+
+	return err
+}
+
+func (s *InstrumentedStorage) CheckDBConnect() error {
+	start := time.Now()
+	err := s.Storage.CheckDBConnect()
+	s.observe("ping", start, err)
+
+	return err
+}
@@ -0,0 +1,200 @@
+package humaytelemetry
+
+import (
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+)
+
+// ReservedPrefix starts the names of the metrics of the server itself,
+// other senders can't write them.
+const ReservedPrefix = "_humay_"
+
+type Config struct {
+	// address of the separate listener with /metrics, empty disables it.
+	Address string `yaml:"address,omitempty" json:"address,omitempty"`
+	// seconds between storing the summary as ordinary metrics, 0 disables it.
+	StoreInterval humayConfig.Seconds `yaml:"store_interval,omitempty" json:"store_interval,omitempty"`
+}
+
+// upper bounds of latency buckets in seconds.
+var latencyBuckets = []float64{0.0005, 0.001, 0.0025, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Histogram counts observations by buckets.
+type Histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+func newHistogram() *Histogram {
+	return &Histogram{counts: make([]uint64, len(latencyBuckets))}
+}
+
+func (h *Histogram) observe(seconds float64) {
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += seconds
+	h.count++
+}
+
+type requestKey struct {
+	route  string
+	method string
+	status string
+}
+
+type operationStats struct {
+	latency *Histogram
+	errors  uint64
+}
+
+// Registry collects metrics of the server itself.
+// Nil registry ignores observations, so components work without it.
+type Registry struct {
+	mx        sync.Mutex
+	started   time.Time
+	requests  map[requestKey]*Histogram
+	storage   map[string]*operationStats
+	snapshots *operationStats
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		started:   time.Now(),
+		requests:  make(map[requestKey]*Histogram),
+		storage:   make(map[string]*operationStats),
+		snapshots: &operationStats{latency: newHistogram()},
+	}
+}
+
+// ObserveRequest counts the answered request of the route pattern.
+func (r *Registry) ObserveRequest(route, method string, status int, duration time.Duration) {
+	if r == nil {
+		return
+	}
+
+	key := requestKey{route: route, method: method, status: strconv.Itoa(status)}
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	h, ok := r.requests[key]
+	if !ok {
+		h = newHistogram()
+		r.requests[key] = h
+	}
+	h.observe(duration.Seconds())
+}
+
+// ObserveStorage counts the storage operation and its error.
+func (r *Registry) ObserveStorage(operation string, duration time.Duration, err error) {
+	if r == nil {
+		return
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	stats, ok := r.storage[operation]
+	if !ok {
+		stats = &operationStats{latency: newHistogram()}
+		r.storage[operation] = stats
+	}
+	observeOperation(stats, duration, err)
+}
+
+// ObserveSnapshot counts saving of the storage file.
+func (r *Registry) ObserveSnapshot(duration time.Duration, err error) {
+	if r == nil {
+		return
+	}
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	observeOperation(r.snapshots, duration, err)
+}
+
+func observeOperation(stats *operationStats, duration time.Duration, err error) {
+	stats.latency.observe(duration.Seconds())
+	if err != nil {
+		stats.errors++
+	}
+}
+
+// Summary are totals of the registry which are stored as ordinary metrics.
+type Summary struct {
+	Gauges   map[string]float64
+	Counters map[string]int64
+}
+
+// Summary returns totals over all routes and operations with runtime stats.
+func (r *Registry) Summary() Summary {
+	summary := Summary{
+		Gauges:   make(map[string]float64),
+		Counters: make(map[string]int64),
+	}
+	for name, value := range runtimeGauges() {
+		summary.Gauges[ReservedPrefix+name] = value
+	}
+	summary.Gauges[ReservedPrefix+"uptime_seconds"] = time.Since(r.started).Seconds()
+
+	r.mx.Lock()
+	defer r.mx.Unlock()
+
+	var requests, failed uint64
+	var requestSeconds float64
+	for key, h := range r.requests {
+		requests += h.count
+		requestSeconds += h.sum
+		if key.status >= "500" {
+			failed += h.count
+		}
+	}
+	summary.Counters[ReservedPrefix+"http_requests_total"] = int64(requests)
+	summary.Counters[ReservedPrefix+"http_server_errors_total"] = int64(failed)
+	summary.Gauges[ReservedPrefix+"http_request_seconds_avg"] = average(requestSeconds, requests)
+
+	var operations, errors uint64
+	var operationSeconds float64
+	for _, stats := range r.storage {
+		operations += stats.latency.count
+		operationSeconds += stats.latency.sum
+		errors += stats.errors
+	}
+	summary.Counters[ReservedPrefix+"storage_operations_total"] = int64(operations)
+	summary.Counters[ReservedPrefix+"storage_errors_total"] = int64(errors)
+	summary.Gauges[ReservedPrefix+"storage_operation_seconds_avg"] = average(operationSeconds, operations)
+
+	summary.Counters[ReservedPrefix+"snapshots_total"] = int64(r.snapshots.latency.count)
+	summary.Counters[ReservedPrefix+"snapshot_errors_total"] = int64(r.snapshots.errors)
+	summary.Gauges[ReservedPrefix+"snapshot_seconds_avg"] = average(r.snapshots.latency.sum, r.snapshots.latency.count)
+
+	return summary
+}
+
+func average(sum float64, count uint64) float64 {
+	if count == 0 {
+		return 0
+	}
+
+	return sum / float64(count)
+}
+
+func sortedKeys[K comparable, V any](m map[K]V, less func(a, b K) bool) []K {
+	keys := make([]K, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return less(keys[i], keys[j])
+	})
+
+	return keys
+}
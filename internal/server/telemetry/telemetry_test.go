@@ -0,0 +1,91 @@
+package humaytelemetry
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+func TestWritePrometheus(t *testing.T) {
+	registry := NewRegistry()
+	registry.ObserveRequest("/update", "POST", 200, 3*time.Millisecond)
+	registry.ObserveRequest("/update", "POST", 200, 2*time.Second)
+	registry.ObserveRequest("/value", "POST", 404, time.Millisecond)
+	registry.ObserveStorage("put_gauge", time.Millisecond, errors.New("failed"))
+	registry.ObserveSnapshot(20*time.Millisecond, nil)
+
+	buf := &bytes.Buffer{}
+	registry.WritePrometheus(buf)
+	text := buf.String()
+
+	tests := []string{
+		`humay_http_requests_total{route="/update",method="POST",status="200"} 2`,
+		`humay_http_requests_total{route="/value",method="POST",status="404"} 1`,
+		`humay_http_request_duration_seconds_bucket{route="/update",method="POST",status="200",le="0.005"} 1`,
+		`humay_http_request_duration_seconds_bucket{route="/update",method="POST",status="200",le="2.5"} 2`,
+		`humay_http_request_duration_seconds_bucket{route="/update",method="POST",status="200",le="+Inf"} 2`,
+		`humay_http_request_duration_seconds_count{route="/update",method="POST",status="200"} 2`,
+		`humay_storage_errors_total{operation="put_gauge"} 1`,
+		`humay_storage_operation_duration_seconds_count{operation="put_gauge"} 1`,
+		`humay_snapshot_errors_total 0`,
+		`humay_snapshot_duration_seconds_bucket{le="0.025"} 1`,
+		`humay_snapshot_duration_seconds_count 1`,
+		`# TYPE humay_go_goroutines gauge`,
+		`# TYPE humay_uptime_seconds gauge`,
+	}
+	for _, line := range tests {
+		assert.Contains(t, text, line+"\n")
+	}
+}
+
+func TestReporter(t *testing.T) {
+	storage := humayStorage.NewStorage(t.TempDir()+"/metrics.json", "")
+	registry := NewRegistry()
+	instrumented := NewInstrumentedStorage(storage, registry)
+	reporter := NewReporter(storage, registry, 1, nil)
+
+	_, err := instrumented.GetGaugeMetric("Alloc")
+	assert.Error(t, err)
+	require.NoError(t, instrumented.PutGaugeMetric("Alloc", 1))
+	registry.ObserveRequest("/update", "POST", 500, time.Millisecond)
+
+	require.NoError(t, reporter.Report())
+	require.NoError(t, instrumented.PutCounterMetric("PollCount", 1))
+	require.NoError(t, reporter.Report())
+
+	tests := []struct {
+		name  string
+		value int64
+	}{
+		{name: ReservedPrefix + "storage_operations_total", value: 3},
+		{name: ReservedPrefix + "storage_errors_total", value: 1},
+		{name: ReservedPrefix + "http_requests_total", value: 1},
+		{name: ReservedPrefix + "http_server_errors_total", value: 1},
+		{name: ReservedPrefix + "snapshots_total", value: 0},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			value, err := storage.GetCounterMetric(test.name)
+			assert.NoError(t, err)
+			assert.Equal(t, test.value, value)
+		})
+	}
+
+	_, err = storage.GetGaugeMetric(ReservedPrefix + "go_goroutines")
+	assert.NoError(t, err)
+}
+
+func TestNilRegistry(t *testing.T) {
+	var registry *Registry
+	assert.NotPanics(t, func() {
+		registry.ObserveRequest("/", "GET", 200, time.Millisecond)
+		registry.ObserveStorage("ping", time.Millisecond, nil)
+		registry.ObserveSnapshot(time.Millisecond, nil)
+	})
+}
@@ -0,0 +1,294 @@
+package humaywritebuffer
+
+import (
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	humayConfig "github.com/zvfkjytytw/humay/internal/common/config"
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+const (
+	defaultFlushInterval  = 5
+	defaultMaxBatch       = 1000
+	defaultQueueSize      = 1000
+	defaultEnqueueTimeout = 1000
+)
+
+var (
+	ErrBufferFull   = errors.New("write buffer is full")
+	ErrBufferClosed = errors.New("write buffer is closed")
+)
+
+type Config struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// time in milliseconds to collect puts into one batch.
+	FlushInterval humayConfig.Milliseconds `yaml:"flush_interval,omitempty" json:"flush_interval,omitempty"`
+	// maximum number of puts in one batch.
+	MaxBatch int32 `yaml:"max_batch,omitempty" json:"max_batch,omitempty"`
+	// maximum number of puts waiting for a batch.
+	QueueSize int32 `yaml:"queue_size,omitempty" json:"queue_size,omitempty"`
+	// time in milliseconds to wait for a place in the full queue.
+	EnqueueTimeout humayConfig.Milliseconds `yaml:"enqueue_timeout,omitempty" json:"enqueue_timeout,omitempty"`
+}
+
+type Stats struct {
+	QueueDepth    int   `json:"queue_depth"`
+	QueueCapacity int   `json:"queue_capacity"`
+	Batches       int64 `json:"batches"`
+	Puts          int64 `json:"puts"`
+	Metrics       int64 `json:"metrics"`
+	Rejected      int64 `json:"rejected"`
+	Failed        int64 `json:"failed"`
+	LastBatchPuts int64 `json:"last_batch_puts"`
+	// duration of the last commit in nanoseconds.
+	LastCommitDuration int64 `json:"last_commit_duration_ns"`
+}
+
+// put request waiting for the batch commit.
+type request struct {
+	gauges   map[string]float64
+	counters map[string]int64
+	replace  bool
+	result   chan error
+}
+
+// WriteBuffer collects puts for a short time, merges them and commits them as one batch.
+// Every put waits for the commit of its batch, so reads right after a put see the new value.
+type WriteBuffer struct {
+	humayStorage.Storage
+	queue          chan *request
+	flushInterval  time.Duration
+	maxBatch       int
+	enqueueTimeout time.Duration
+	done           chan struct{}
+	stopped        chan struct{}
+	once           sync.Once
+
+	batches            atomic.Int64
+	puts               atomic.Int64
+	metrics            atomic.Int64
+	rejected           atomic.Int64
+	failed             atomic.Int64
+	lastBatchPuts      atomic.Int64
+	lastCommitDuration atomic.Int64
+}
+
+func NewWriteBuffer(storage humayStorage.Storage, config *Config) *WriteBuffer {
+	flushInterval := config.FlushInterval
+	if flushInterval <= 0 {
+		flushInterval = defaultFlushInterval
+	}
+	maxBatch := config.MaxBatch
+	if maxBatch <= 0 {
+		maxBatch = defaultMaxBatch
+	}
+	queueSize := config.QueueSize
+	if queueSize <= 0 {
+		queueSize = defaultQueueSize
+	}
+	enqueueTimeout := config.EnqueueTimeout
+	if enqueueTimeout <= 0 {
+		enqueueTimeout = defaultEnqueueTimeout
+	}
+
+	b := &WriteBuffer{
+		Storage:        storage,
+		queue:          make(chan *request, queueSize),
+		flushInterval:  time.Duration(flushInterval) * time.Millisecond,
+		maxBatch:       int(maxBatch),
+		enqueueTimeout: time.Duration(enqueueTimeout) * time.Millisecond,
+		done:           make(chan struct{}),
+		stopped:        make(chan struct{}),
+	}
+	go b.run()
+
+	return b
+}
+
+func (b *WriteBuffer) PutGaugeMetric(name string, value float64) error {
+	return b.put(&request{gauges: map[string]float64{name: value}})
+}
+
+func (b *WriteBuffer) PutGaugeMetrics(metrics map[string]float64) error {
+	return b.put(&request{gauges: metrics})
+}
+
+func (b *WriteBuffer) PutCounterMetric(name string, value int64) error {
+	return b.put(&request{counters: map[string]int64{name: value}})
+}
+
+func (b *WriteBuffer) PutCounterMetrics(metrics map[string]int64) error {
+	return b.put(&request{counters: metrics})
+}
+
+// ReplaceMetrics is committed after all puts queued before it.
+func (b *WriteBuffer) ReplaceMetrics(gauges map[string]float64, counters map[string]int64) error {
+	return b.put(&request{gauges: gauges, counters: counters, replace: true})
+}
+
+// Close commits queued puts and closes the underlying storage.
+func (b *WriteBuffer) Close() error {
+	b.once.Do(func() {
+		close(b.done)
+	})
+	<-b.stopped
+
+	return b.Storage.Close()
+}
+
+func (b *WriteBuffer) Stats() Stats {
+	return Stats{
+		QueueDepth:         len(b.queue),
+		QueueCapacity:      cap(b.queue),
+		Batches:            b.batches.Load(),
+		Puts:               b.puts.Load(),
+		Metrics:            b.metrics.Load(),
+		Rejected:           b.rejected.Load(),
+		Failed:             b.failed.Load(),
+		LastBatchPuts:      b.lastBatchPuts.Load(),
+		LastCommitDuration: b.lastCommitDuration.Load(),
+	}
+}
+
+func (b *WriteBuffer) put(req *request) error {
+	req.result = make(chan error, 1)
+
+	select {
+	case <-b.done:
+		return ErrBufferClosed
+	default:
+	}
+
+	// wait for a place in the queue no longer than enqueue timeout.
+	select {
+	case b.queue <- req:
+	default:
+		timer := time.NewTimer(b.enqueueTimeout)
+		defer timer.Stop()
+		select {
+		case b.queue <- req:
+		case <-timer.C:
+			b.rejected.Add(1)
+			return ErrBufferFull
+		case <-b.done:
+			return ErrBufferClosed
+		}
+	}
+
+	select {
+	case err := <-req.result:
+		return err
+	case <-b.stopped:
+		// the request could be committed by the final flush.
+		select {
+		case err := <-req.result:
+			return err
+		default:
+			return ErrBufferClosed
+		}
+	}
+}
+
+func (b *WriteBuffer) run() {
+	defer close(b.stopped)
+
+	for {
+		select {
+		case req := <-b.queue:
+			b.commit(b.collect(req))
+		case <-b.done:
+			for {
+				select {
+				case req := <-b.queue:
+					b.commit([]*request{req})
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// collect requests until flush interval ends, batch is full or a replace request comes.
+func (b *WriteBuffer) collect(first *request) []*request {
+	batch := []*request{first}
+	if first.replace {
+		return batch
+	}
+
+	timer := time.NewTimer(b.flushInterval)
+	defer timer.Stop()
+	for len(batch) < b.maxBatch {
+		select {
+		case req := <-b.queue:
+			batch = append(batch, req)
+			if req.replace {
+				return batch
+			}
+		case <-timer.C:
+			return batch
+		case <-b.done:
+			return batch
+		}
+	}
+
+	return batch
+}
+
+func (b *WriteBuffer) commit(batch []*request) {
+	start := time.Now()
+	gauges := make(map[string]float64)
+	counters := make(map[string]int64)
+	var replace *request
+	for _, req := range batch {
+		if req.replace {
+			replace = req
+			continue
+		}
+		for name, value := range req.gauges {
+			gauges[name] = value
+		}
+		for name, delta := range req.counters {
+			counters[name] += delta
+		}
+	}
+
+	// every put gets only the errors of its own metrics, so a put of counters that are
+	// committed is not retried and counted twice because of failed gauges.
+	var countersErr, gaugesErr error
+	if len(counters) > 0 {
+		countersErr = b.Storage.PutCounterMetrics(counters)
+	}
+	if len(gauges) > 0 {
+		gaugesErr = b.Storage.PutGaugeMetrics(gauges)
+	}
+
+	for _, req := range batch {
+		if req == replace {
+			continue
+		}
+		var err error
+		if len(req.counters) > 0 {
+			err = countersErr
+		}
+		if len(req.gauges) > 0 {
+			err = errors.Join(err, gaugesErr)
+		}
+		req.result <- err
+	}
+	if replace != nil {
+		replace.result <- b.Storage.ReplaceMetrics(replace.gauges, replace.counters)
+	}
+
+	b.batches.Add(1)
+	b.puts.Add(int64(len(batch)))
+	b.metrics.Add(int64(len(gauges) + len(counters)))
+	b.lastBatchPuts.Store(int64(len(batch)))
+	b.lastCommitDuration.Store(time.Since(start).Nanoseconds())
+	if countersErr != nil || gaugesErr != nil {
+		b.failed.Add(1)
+	}
+}
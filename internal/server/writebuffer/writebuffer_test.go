@@ -0,0 +1,112 @@
+package humaywritebuffer
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	humayStorage "github.com/zvfkjytytw/humay/internal/server/storage"
+)
+
+type countingStorage struct {
+	*humayStorage.MemStorage
+	mx      sync.Mutex
+	commits int
+	delay   time.Duration
+}
+
+func (s *countingStorage) PutCounterMetrics(metrics map[string]int64) error {
+	s.mx.Lock()
+	s.commits++
+	s.mx.Unlock()
+	time.Sleep(s.delay)
+
+	return s.MemStorage.PutCounterMetrics(metrics)
+}
+
+func TestWriteBufferMergesPuts(t *testing.T) {
+	storage := &countingStorage{MemStorage: humayStorage.NewStorage("", "")}
+	buffer := NewWriteBuffer(storage, &Config{FlushInterval: 50})
+	defer buffer.Close()
+
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, buffer.PutCounterMetric("PollCount", 2))
+		}()
+	}
+	wg.Wait()
+
+	value, err := buffer.GetCounterMetric("PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(40), value)
+	assert.Less(t, storage.commits, 20)
+	assert.Equal(t, int64(20), buffer.Stats().Puts)
+}
+
+func TestWriteBufferBackpressure(t *testing.T) {
+	storage := &countingStorage{
+		MemStorage: humayStorage.NewStorage("", ""),
+		delay:      200 * time.Millisecond,
+	}
+	buffer := NewWriteBuffer(storage, &Config{FlushInterval: 1, MaxBatch: 1, QueueSize: 1, EnqueueTimeout: 10})
+
+	results := make(chan error, 5)
+	for range 5 {
+		go func() {
+			results <- buffer.PutCounterMetric("PollCount", 1)
+		}()
+	}
+
+	var full int
+	for range 5 {
+		if err := <-results; err != nil {
+			assert.ErrorIs(t, err, ErrBufferFull)
+			full++
+		}
+	}
+	assert.Positive(t, full)
+	assert.Equal(t, int64(full), buffer.Stats().Rejected)
+
+	assert.NoError(t, buffer.Close())
+	assert.ErrorIs(t, buffer.PutCounterMetric("PollCount", 1), ErrBufferClosed)
+}
+
+type failingGauges struct {
+	*humayStorage.MemStorage
+}
+
+func (s *failingGauges) PutGaugeMetrics(map[string]float64) error {
+	return errors.New("gauges are not saved")
+}
+
+func TestWriteBufferPartialFailure(t *testing.T) {
+	storage := &failingGauges{MemStorage: humayStorage.NewStorage("", "")}
+	buffer := NewWriteBuffer(storage, &Config{FlushInterval: 50})
+	defer buffer.Close()
+
+	var wg sync.WaitGroup
+	var counterErr, gaugeErr error
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		counterErr = buffer.PutCounterMetric("PollCount", 2)
+	}()
+	go func() {
+		defer wg.Done()
+		gaugeErr = buffer.PutGaugeMetric("Alloc", 1)
+	}()
+	wg.Wait()
+
+	// the committed counter is not reported as failed, so it is not sent again.
+	assert.NoError(t, counterErr)
+	assert.Error(t, gaugeErr)
+	value, err := buffer.GetCounterMetric("PollCount")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), value)
+}
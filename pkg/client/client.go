@@ -0,0 +1,308 @@
+// Package humayclient pushes metrics to the humay server and reads them back.
+package humayclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/sethvargo/go-retry"
+
+	humayHTTPClient "github.com/zvfkjytytw/humay/internal/common/http/client"
+	httpModels "github.com/zvfkjytytw/humay/internal/common/http/models"
+)
+
+const (
+	Gauge   = httpModels.GaugeMetric
+	Counter = httpModels.CounterMetric
+)
+
+var ErrBadSignature = humayHTTPClient.ErrBadSignature
+
+// Metric is a gauge with Value or a counter with Delta.
+type Metric = httpModels.Metric
+
+func NewGauge(name string, value float64) Metric {
+	return Metric{ID: name, MType: Gauge, Value: &value}
+}
+
+func NewCounter(name string, delta int64) Metric {
+	return Metric{ID: name, MType: Counter, Delta: &delta}
+}
+
+// MetricResult is the result of one metric of Push.
+// Metric holds the stored value if the metric is saved.
+type MetricResult = httpModels.MetricResult
+
+// Error is the error answered by the server.
+type Error struct {
+	Status   int    `json:"-"`
+	Code     string `json:"code"`
+	Message  string `json:"message"`
+	MetricID string `json:"metric_id,omitempty"`
+}
+
+func (e *Error) Error() string {
+	if e.MetricID != "" {
+		return fmt.Sprintf("humay: %d %s: metric %s: %s", e.Status, e.Code, e.MetricID, e.Message)
+	}
+
+	return fmt.Sprintf("humay: %d %s: %s", e.Status, e.Code, e.Message)
+}
+
+type Client struct {
+	baseURL *url.URL
+	client  *http.Client
+	opts    *options
+}
+
+// New returns client of the server. Address is a URL or host:port,
+// the scheme is https if TLS is configured and http otherwise.
+func New(address string, opts ...Option) (*Client, error) {
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
+
+	if !strings.Contains(address, "://") {
+		scheme := "http"
+		if o.tlsConfig != nil {
+			scheme = "https"
+		}
+		address = scheme + "://" + address
+	}
+	baseURL, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("wrong server address %s: %v", address, err)
+	}
+	baseURL.Path = strings.TrimSuffix(baseURL.Path, "/")
+
+	client := o.httpClient
+	if client == nil {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = o.tlsConfig
+		client = &http.Client{
+			Transport: transport,
+			Timeout:   o.timeout,
+		}
+	}
+
+	return &Client{
+		baseURL: baseURL,
+		client:  client,
+		opts:    o,
+	}, nil
+}
+
+func (c *Client) PushGauge(ctx context.Context, name string, value float64) error {
+	_, err := c.pushOne(ctx, NewGauge(name, value))
+	return err
+}
+
+// PushCounter adds delta to the counter and returns the stored sum.
+func (c *Client) PushCounter(ctx context.Context, name string, delta int64) (int64, error) {
+	metric, err := c.pushOne(ctx, NewCounter(name, delta))
+	if err != nil {
+		return 0, err
+	}
+
+	return *metric.Delta, nil
+}
+
+// Push saves the batch. Results are in the order of metrics.
+// If some metrics are rejected, results are returned with *Error of status 207 or 422.
+func (c *Client) Push(ctx context.Context, metrics []Metric) ([]MetricResult, error) {
+	status, body, err := c.do(ctx, http.MethodPost, httpModels.UpdatesHandler, metrics, http.StatusMultiStatus, http.StatusUnprocessableEntity)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []MetricResult
+	if err = json.Unmarshal(body, &results); err != nil {
+		return nil, fmt.Errorf("failed unmarshal results: %v", err)
+	}
+
+	rejected := 0
+	for _, result := range results {
+		if result.Error != nil {
+			rejected++
+		}
+	}
+	if status != http.StatusOK {
+		return results, &Error{
+			Status:  status,
+			Code:    httpModels.CodeInvalidMetric,
+			Message: fmt.Sprintf("%d of %d metrics are rejected", rejected, len(results)),
+		}
+	}
+
+	return results, nil
+}
+
+func (c *Client) Gauge(ctx context.Context, name string) (float64, error) {
+	metric, err := c.Get(ctx, Gauge, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return *metric.Value, nil
+}
+
+func (c *Client) Counter(ctx context.Context, name string) (int64, error) {
+	metric, err := c.Get(ctx, Counter, name)
+	if err != nil {
+		return 0, err
+	}
+
+	return *metric.Delta, nil
+}
+
+// Get returns the metric with its stored value.
+func (c *Client) Get(ctx context.Context, mType, name string) (*Metric, error) {
+	_, body, err := c.do(ctx, http.MethodPost, httpModels.ValueHandler, Metric{ID: name, MType: mType})
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMetric(body)
+}
+
+// List returns all metrics sorted by type and name.
+func (c *Client) List(ctx context.Context) ([]Metric, error) {
+	_, body, err := c.do(ctx, http.MethodGet, httpModels.ValuesHandler, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var metrics []Metric
+	if err = json.Unmarshal(body, &metrics); err != nil {
+		return nil, fmt.Errorf("failed unmarshal metrics: %v", err)
+	}
+
+	return metrics, nil
+}
+
+// Close closes idle connections.
+func (c *Client) Close() {
+	c.client.CloseIdleConnections()
+}
+
+func (c *Client) pushOne(ctx context.Context, metric Metric) (*Metric, error) {
+	_, body, err := c.do(ctx, http.MethodPost, httpModels.UpdateHandler, metric)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeMetric(body)
+}
+
+func decodeMetric(body []byte) (*Metric, error) {
+	metric := &Metric{}
+	if err := json.Unmarshal(body, metric); err != nil {
+		return nil, fmt.Errorf("failed unmarshal metric: %v", err)
+	}
+	if (metric.MType == Gauge && metric.Value == nil) || (metric.MType == Counter && metric.Delta == nil) {
+		return nil, fmt.Errorf("metric %s has no value", metric.ID)
+	}
+
+	return metric, nil
+}
+
+// do sends the request with retries and returns the body of the successful answer.
+// Statuses of accept are successful too.
+func (c *Client) do(ctx context.Context, method, path string, payload any, accept ...int) (int, []byte, error) {
+	var plain []byte
+	if payload != nil {
+		var err error
+		if plain, err = json.Marshal(payload); err != nil {
+			return 0, nil, fmt.Errorf("failed marshal request: %v", err)
+		}
+	}
+
+	backoff := humayHTTPClient.Backoff(c.opts.retries, c.opts.retryDelay, c.opts.maxDelay)
+
+	var status int
+	var body []byte
+	err := retry.Do(ctx, backoff, func(ctx context.Context) error {
+		var err error
+		status, body, err = c.attempt(ctx, method, path, plain, accept)
+		return err
+	})
+
+	return status, body, err
+}
+
+func (c *Client) attempt(ctx context.Context, method, path string, plain []byte, accept []int) (int, []byte, error) {
+	var reqBody io.Reader
+	if plain != nil {
+		reqBody = bytes.NewReader(plain)
+		if c.opts.gzip {
+			compressed, err := humayHTTPClient.Compress(plain)
+			if err != nil {
+				return 0, nil, err
+			}
+			reqBody = bytes.NewReader(compressed)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL.String()+path, reqBody)
+	if err != nil {
+		return 0, nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	if plain != nil {
+		req.Header.Set("Content-Type", "application/json")
+		if c.opts.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+	}
+	if c.opts.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.opts.token)
+	}
+	if c.opts.agent != "" {
+		req.Header.Set(httpModels.AgentHeader, c.opts.agent)
+	}
+
+	nonce, err := humayHTTPClient.Sign(req, c.opts.hashKey, plain)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return 0, nil, humayHTTPClient.RetryableSend(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed read response: %v", err)
+	}
+
+	if resp.StatusCode/100 != 2 && !slices.Contains(accept, resp.StatusCode) {
+		return resp.StatusCode, nil, c.statusError(ctx, resp, body)
+	}
+
+	if err = humayHTTPClient.Verify(resp, c.opts.hashKey, body, nonce); err != nil {
+		return resp.StatusCode, nil, err
+	}
+
+	return resp.StatusCode, body, nil
+}
+
+// statusError returns the error of the answer, errors of the overloaded server are retried.
+func (c *Client) statusError(ctx context.Context, resp *http.Response, body []byte) error {
+	apiError := &Error{}
+	if err := json.Unmarshal(body, apiError); err != nil || apiError.Code == "" {
+		apiError = &Error{Code: "unknown", Message: strings.TrimSpace(string(body))}
+	}
+	apiError.Status = resp.StatusCode
+
+	return humayHTTPClient.RetryableStatus(ctx, resp, apiError, c.opts.maxDelay)
+}
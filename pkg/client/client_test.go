@@ -0,0 +1,119 @@
+package humayclient
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int
+		calls    int32
+		err      bool
+	}{
+		{name: "success", statuses: []int{http.StatusOK}, calls: 1},
+		{name: "rate limited", statuses: []int{http.StatusTooManyRequests, http.StatusOK}, calls: 2},
+		{name: "unavailable", statuses: []int{http.StatusServiceUnavailable, http.StatusServiceUnavailable, http.StatusOK}, calls: 3},
+		{name: "server error", statuses: []int{http.StatusInternalServerError, http.StatusOK}, calls: 1, err: true},
+		{name: "client error", statuses: []int{http.StatusBadRequest, http.StatusOK}, calls: 1, err: true},
+		{name: "retries are over", statuses: []int{503, 503, 503, 503, 503}, calls: 3, err: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var calls atomic.Int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				status := test.statuses[calls.Add(1)-1]
+				if status == http.StatusTooManyRequests || status == http.StatusServiceUnavailable {
+					w.Header().Set("Retry-After", "0")
+				}
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				if status == http.StatusOK {
+					w.Write([]byte(`{"id":"Alloc","type":"gauge","value":1}`))
+					return
+				}
+				w.Write([]byte(`{"code":"internal","message":"failed"}`))
+			}))
+			defer server.Close()
+
+			client, err := New(server.URL, WithRetries(2, time.Millisecond, 10*time.Millisecond))
+			assert.NoError(t, err)
+			defer client.Close()
+
+			err = client.PushGauge(context.Background(), "Alloc", 1)
+			assert.Equal(t, test.err, err != nil, "%v", err)
+			assert.Equal(t, test.calls, calls.Load())
+		})
+	}
+}
+
+func TestClientRetriesUnsent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	address := server.Listener.Addr().String()
+	server.Close()
+
+	// the connection is refused, nothing reached the server.
+	var dials atomic.Int32
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			dials.Add(1)
+			return (&net.Dialer{}).DialContext(ctx, network, address)
+		},
+	}
+	client, err := New(
+		"http://"+address,
+		WithHTTPClient(&http.Client{Transport: transport}),
+		WithRetries(2, time.Millisecond, 10*time.Millisecond),
+	)
+	assert.NoError(t, err)
+	defer client.Close()
+
+	assert.Error(t, client.PushGauge(context.Background(), "Alloc", 1))
+	assert.Equal(t, int32(3), dials.Load())
+}
+
+func TestClientOptions(t *testing.T) {
+	var encoding, authorization atomic.Value
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		encoding.Store(r.Header.Get("Content-Encoding"))
+		authorization.Store(r.Header.Get("Authorization"))
+		w.WriteHeader(http.StatusOK)
+		w.Write([]byte(`{"id":"PollCount","type":"counter","delta":3}`))
+	}))
+	defer server.Close()
+	ctx := context.Background()
+
+	client, err := New(server.URL, WithGzip(false), WithToken("secret"))
+	assert.NoError(t, err)
+	sum, err := client.PushCounter(ctx, "PollCount", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), sum)
+	assert.Equal(t, "", encoding.Load())
+	assert.Equal(t, "Bearer secret", authorization.Load())
+
+	client, err = New(server.URL)
+	assert.NoError(t, err)
+	_, err = client.PushCounter(ctx, "PollCount", 3)
+	assert.NoError(t, err)
+	assert.Equal(t, "gzip", encoding.Load())
+
+	// the stub does not sign answers.
+	client, err = New(server.URL, WithHashKey("key"))
+	assert.NoError(t, err)
+	_, err = client.PushCounter(ctx, "PollCount", 3)
+	assert.True(t, errors.Is(err, ErrBadSignature))
+
+	client, err = New("localhost:8080")
+	assert.NoError(t, err)
+	assert.Equal(t, "http://localhost:8080", client.baseURL.String())
+}
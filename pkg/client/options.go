@@ -0,0 +1,103 @@
+package humayclient
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+)
+
+const (
+	defaultTimeout    = 10 * time.Second
+	defaultRetries    = 3
+	defaultRetryDelay = time.Second
+	defaultMaxDelay   = 5 * time.Second
+)
+
+type options struct {
+	hashKey    string
+	token      string
+	agent      string
+	tlsConfig  *tls.Config
+	httpClient *http.Client
+	timeout    time.Duration
+	retries    uint64
+	retryDelay time.Duration
+	maxDelay   time.Duration
+	gzip       bool
+}
+
+func defaultOptions() *options {
+	return &options{
+		timeout:    defaultTimeout,
+		retries:    defaultRetries,
+		retryDelay: defaultRetryDelay,
+		maxDelay:   defaultMaxDelay,
+		gzip:       true,
+	}
+}
+
+// Option configures the Client.
+type Option func(*options)
+
+// WithHashKey signs requests and checks signatures of responses with the key.
+func WithHashKey(key string) Option {
+	return func(o *options) {
+		o.hashKey = key
+	}
+}
+
+// WithToken sends the API token as bearer token.
+func WithToken(token string) Option {
+	return func(o *options) {
+		o.token = token
+	}
+}
+
+// WithAgent sets the name of the sender shown by the dashboard of the server.
+func WithAgent(name string) Option {
+	return func(o *options) {
+		o.agent = name
+	}
+}
+
+// WithTLS sets TLS config for https servers, e.g. CA bundle and client certificate.
+func WithTLS(config *tls.Config) Option {
+	return func(o *options) {
+		o.tlsConfig = config
+	}
+}
+
+// WithHTTPClient replaces the HTTP client. WithTLS and WithTimeout are ignored then.
+func WithHTTPClient(client *http.Client) Option {
+	return func(o *options) {
+		o.httpClient = client
+	}
+}
+
+// WithTimeout limits one request.
+func WithTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.timeout = timeout
+	}
+}
+
+// WithRetries sets the number of retries of failed requests and the first and the longest pause between them.
+// Zero retries disables them, zero pauses keep the defaults.
+func WithRetries(retries uint64, delay, maxDelay time.Duration) Option {
+	return func(o *options) {
+		o.retries = retries
+		if delay > 0 {
+			o.retryDelay = delay
+		}
+		if maxDelay > 0 {
+			o.maxDelay = maxDelay
+		}
+	}
+}
+
+// WithGzip enables or disables compression of request bodies. It is enabled by default.
+func WithGzip(enabled bool) Option {
+	return func(o *options) {
+		o.gzip = enabled
+	}
+}